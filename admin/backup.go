@@ -0,0 +1,307 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+// ArchiveVersion is the version of archives created by Backup. Restore only
+// accepts archives of this version or older.
+const ArchiveVersion = 1
+
+// archiveTables are the tables included in an archive ordered so that every
+// table is restored after the tables it refers to
+var archiveTables = []string{
+	"properties",
+	"rooms",
+	"booker",
+	"booker_tags",
+	"machines",
+	"machine_programs",
+	"machine_faults",
+	"maintenance_windows",
+	"slot_sets",
+	"slots",
+	"slots_machines",
+	"slot_overrides",
+	"bookings",
+	"series",
+	"series_occurrences",
+	"holds",
+	"waitlist",
+	"swaps",
+	"check_ins",
+	"no_shows",
+	"late_cancellations",
+	"unlock_attempts",
+	"notification_types",
+	"notifications",
+}
+
+// Archive represents a backup of all laundry data. Values are stored as plain
+// JSON numbers and strings, dates and times as strings, so the archive isn't
+// tied to the database it was created from. Since PINs are stored in plain
+// text in the database the archive holds the PIN of every booker and must be
+// kept as secret as the database itself.
+type Archive struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Tables    []ArchiveTable `json:"tables"`
+}
+
+// ArchiveTable represents all rows in a table with the values in the same
+// order as the columns
+type ArchiveTable struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Backup will read all rows in all tables to an archive. All tables are read
+// within one read only transaction so the archive is a consistent snapshot even
+// if the service is running.
+func Backup() (*Archive, *errors.LaundryError) {
+	db := database.GetSimpleConnection()
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	// Nothing is written so the transaction is always rolled back
+	defer tx.Rollback()
+
+	archive := Archive{
+		Version:   ArchiveVersion,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	for _, table := range archiveTables {
+		t, err := backupTable(tx, table)
+		if err != nil {
+			return nil, errors.New("Could not backup table %s", table).WithStatus(http.StatusInternalServerError).CausedBy(err)
+		}
+
+		archive.Tables = append(archive.Tables, *t)
+	}
+
+	return &archive, nil
+}
+
+// backupTable will read all rows in a table ordered by id
+func backupTable(tx *sql.Tx, table string) (*ArchiveTable, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM `%s` ORDER BY `id`", table))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	t := ArchiveTable{
+		Name:    table,
+		Columns: columns,
+		Rows:    [][]interface{}{},
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		for i, v := range values {
+			values[i] = archiveValue(v, types[i].DatabaseTypeName())
+		}
+
+		t.Rows = append(t.Rows, values)
+	}
+
+	return &t, rows.Err()
+}
+
+// archiveValue will convert a value read from the database to a value stored
+// in the archive
+func archiveValue(v interface{}, typeName string) interface{} {
+	switch value := v.(type) {
+	case []byte:
+		return string(value)
+	case time.Time:
+		if typeName == "DATE" {
+			return value.Format("2006-01-02")
+		}
+
+		return value.Format("2006-01-02 15:04:05")
+	}
+
+	return v
+}
+
+// ReadArchive will read and validate an archive
+func ReadArchive(r io.Reader) (*Archive, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var archive Archive
+	if err := decoder.Decode(&archive); err != nil {
+		return nil, err
+	}
+
+	if err := archive.valid(); err != nil {
+		return nil, err
+	}
+
+	return &archive, nil
+}
+
+// Write will write the archive as JSON to w
+func (a *Archive) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(a)
+}
+
+// valid returns an error if the archive is of an unknown version or holds
+// tables or rows which can't be restored
+func (a *Archive) valid() error {
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d, expected at most %d", a.Version, ArchiveVersion)
+	}
+
+	known := map[string]bool{}
+	for _, table := range archiveTables {
+		known[table] = true
+	}
+
+	for _, t := range a.Tables {
+		if !known[t.Name] {
+			return fmt.Errorf("unknown table '%s' in archive", t.Name)
+		}
+
+		for i, row := range t.Rows {
+			if len(row) != len(t.Columns) {
+				return fmt.Errorf("row %d in table %s has %d values but %d columns", i+1, t.Name, len(row), len(t.Columns))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Restore will insert all rows in the archive keeping their ids. All tables
+// must be empty and nothing is restored if any row fails.
+func (a *Archive) Restore() *errors.LaundryError {
+	if err := a.valid(); err != nil {
+		return errors.New("Invalid archive").CausedBy(err)
+	}
+
+	tx, err := database.GetGoqu().Begin()
+	if err != nil {
+		return errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	if err := a.restore(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.New("Could not commit restore").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	return nil
+}
+
+// restore will insert the rows within a transaction in the order of
+// archiveTables
+func (a *Archive) restore(tx *goqu.TxDatabase) *errors.LaundryError {
+	for _, table := range archiveTables {
+		rows, err := tx.From(table).Count()
+		if err != nil {
+			return errors.New("Could not count rows in %s", table).CausedBy(err)
+		}
+
+		if rows > 0 {
+			return errors.New("Table %s is not empty, restore requires an empty database", table).WithStatus(http.StatusConflict)
+		}
+	}
+
+	for _, table := range archiveTables {
+		for _, t := range a.Tables {
+			if t.Name != table {
+				continue
+			}
+
+			for _, record := range t.records() {
+				if _, err := tx.From(table).Insert(record).Exec(); err != nil {
+					return errors.New("Could not restore row with id %v in %s", record["id"], table).CausedBy(err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// records returns each row in the table as a record to insert
+func (t ArchiveTable) records() []goqu.Record {
+	var records []goqu.Record
+
+	for _, row := range t.Rows {
+		record := goqu.Record{}
+
+		for i, column := range t.Columns {
+			record[column] = restoreValue(row[i])
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// restoreValue will convert a value read from an archive to a value to insert
+func restoreValue(v interface{}) interface{} {
+	number, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+
+	return number.String()
+}
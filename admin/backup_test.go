@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArchive(t *testing.T) {
+	Convey("Given an archive", t, func() {
+		a := Archive{
+			Version: ArchiveVersion,
+			Tables: []ArchiveTable{
+				{
+					Name:    "machines",
+					Columns: []string{"id", "id_rooms", "info", "working", "type", "capacity"},
+					Rows: [][]interface{}{
+						{int64(3), int64(1), "Tumbler", int64(1), "tumbler", "8.0"},
+					},
+				},
+				{
+					Name:    "bookings",
+					Columns: []string{"id", "book_date", "id_slots", "id_booker"},
+					Rows: [][]interface{}{
+						{int64(7), archiveValue(time.Date(2018, 5, 7, 0, 0, 0, 0, time.UTC), "DATE"), int64(2), int64(1)},
+					},
+				},
+			},
+		}
+
+		var buf bytes.Buffer
+		So(a.Write(&buf), ShouldBeNil)
+
+		Convey("The archive can be read again", func() {
+			read, err := ReadArchive(&buf)
+
+			So(err, ShouldBeNil)
+			So(read.Version, ShouldEqual, ArchiveVersion)
+			So(len(read.Tables), ShouldEqual, 2)
+
+			Convey("Ids are kept as integers and other values as strings", func() {
+				records := read.Tables[0].records()
+
+				So(len(records), ShouldEqual, 1)
+				So(records[0]["id"], ShouldEqual, int64(3))
+				So(records[0]["capacity"], ShouldEqual, "8.0")
+				So(read.Tables[1].records()[0]["book_date"], ShouldEqual, "2018-05-07")
+			})
+		})
+	})
+
+	Convey("Given invalid archives", t, func() {
+		for _, archive := range []string{
+			`{"version": 2, "tables": []}`,
+			`{"tables": []}`,
+			`{"version": 1, "tables": [{"name": "users", "columns": ["id"], "rows": [[1]]}]}`,
+			`{"version": 1, "tables": [{"name": "rooms", "columns": ["id", "name"], "rows": [[1]]}]}`,
+		} {
+			_, err := ReadArchive(strings.NewReader(archive))
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestArchiveValue(t *testing.T) {
+	Convey("Given values read from the database", t, func() {
+		at := time.Date(2018, 5, 7, 10, 30, 0, 0, time.UTC)
+
+		Convey("Bytes are strings and times are formatted by column type", func() {
+			So(archiveValue([]byte("07:00:00"), "TIME"), ShouldEqual, "07:00:00")
+			So(archiveValue(at, "DATE"), ShouldEqual, "2018-05-07")
+			So(archiveValue(at, "DATETIME"), ShouldEqual, "2018-05-07 10:30:00")
+			So(archiveValue(nil, "VARCHAR"), ShouldBeNil)
+		})
+	})
+}
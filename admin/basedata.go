@@ -0,0 +1,303 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/errors"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+// BaseData represents generated data to be written to the database or as SQL
+// or JSON. A slot set without an id will be created and used for all slots.
+type BaseData struct {
+	SlotSet     *laundry.SlotSet  `json:"slot_set,omitempty"`
+	Slots       []laundry.Slot    `json:"slots,omitempty"`
+	Machines    []laundry.Machine `json:"machines,omitempty"`
+	Bookers     []laundry.Booker  `json:"bookers,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+}
+
+// Attachment represents machines to add to existing slots, either given by
+// id or all slots in a slot set.
+type Attachment struct {
+	SetID      int   `json:"set_id,omitempty"`
+	SlotIDs    []int `json:"slot_ids,omitempty"`
+	MachineIDs []int `json:"machine_ids"`
+}
+
+// sqlVar is a MySQL user variable written as is in SQL statements
+type sqlVar string
+
+// Save will write all data to the database with the same validation as when
+// using the API. Bookers already existing in the property are skipped.
+func (d *BaseData) Save() *errors.LaundryError {
+	if d.SlotSet != nil && d.SlotSet.ID == 0 {
+		if _, err := laundry.AddSlotSet(d.SlotSet); err != nil {
+			return err
+		}
+	}
+
+	for i := range d.Machines {
+		if _, err := laundry.AddMachine(&d.Machines[i]); err != nil {
+			return err
+		}
+	}
+
+	for i := range d.Slots {
+		s := &d.Slots[i]
+
+		if d.SlotSet != nil {
+			s.SetID.Int64, s.SetID.Valid = int64(d.SlotSet.ID), true
+		}
+
+		if _, err := laundry.AddSlot(s); err != nil {
+			return err
+		}
+	}
+
+	var (
+		bookers  []laundry.Booker
+		existing = map[int][]laundry.Booker{}
+	)
+
+	for i := range d.Bookers {
+		b := &d.Bookers[i]
+
+		if _, ok := existing[b.PropertyID]; !ok {
+			inProperty, err := laundry.GetBookers(b.PropertyID)
+			if err != nil {
+				return err
+			}
+
+			existing[b.PropertyID] = inProperty
+		}
+
+		if hasIdentifier(existing[b.PropertyID], b.Identifier) {
+			continue
+		}
+
+		if _, err := laundry.AddBooker(b); err != nil {
+			return err
+		}
+
+		bookers = append(bookers, *b)
+	}
+
+	d.Bookers = bookers
+
+	for _, a := range d.Attachments {
+		slotIDs := a.SlotIDs
+
+		if a.SetID > 0 {
+			ss, err := laundry.GetSlotSet(a.SetID)
+			if err != nil {
+				return err
+			}
+
+			for _, s := range ss.Slots {
+				slotIDs = append(slotIDs, s.ID)
+			}
+		}
+
+		for _, id := range slotIDs {
+			if _, err := laundry.AttachMachines(id, a.MachineIDs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON will write the data as indented JSON to w
+func (d *BaseData) WriteJSON(w io.Writer) error {
+	jb, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(jb, '\n'))
+
+	return err
+}
+
+// WriteSQL will write the data as MySQL statements to w. Generated rows
+// referring to each other are tied together with user variables holding the
+// last inserted id so the statements may be used with an existing database.
+func (d *BaseData) WriteSQL(w io.Writer) error {
+	var statements []string
+
+	var setID interface{}
+
+	if d.SlotSet != nil {
+		setID = d.SlotSet.ID
+
+		if d.SlotSet.ID == 0 {
+			statements = append(statements,
+				insertSQL("slot_sets", goqu.Record{
+					"id_rooms":   d.SlotSet.RoomID,
+					"name":       d.SlotSet.Name,
+					"valid_from": d.SlotSet.ValidFrom.Format("2006-01-02"),
+					"valid_to":   d.SlotSet.ValidTo,
+				}),
+				"SET @slot_set = LAST_INSERT_ID();",
+			)
+
+			setID = sqlVar("@slot_set")
+		}
+	}
+
+	for _, m := range d.Machines {
+		statements = append(statements, insertSQL("machines", goqu.Record{
+			"id_rooms": m.RoomID,
+			"info":     m.Info,
+			"working":  m.Working,
+			"type":     string(m.Type),
+			"capacity": m.Capacity,
+		}))
+	}
+
+	for _, s := range d.Slots {
+		statements = append(statements, insertSQL("slots", goqu.Record{
+			"id_rooms":     s.RoomID,
+			"id_slot_sets": setID,
+			"week_day":     strconv.Itoa(s.Weekday),
+			"start_time":   s.Start,
+			"end_time":     s.End,
+			"recurring":    true,
+		}))
+
+		if len(s.MachineIDs) == 0 {
+			continue
+		}
+
+		statements = append(statements, "SET @slot = LAST_INSERT_ID();")
+
+		for _, id := range s.MachineIDs {
+			statements = append(statements, insertSQL("slots_machines", goqu.Record{
+				"id_slots":    sqlVar("@slot"),
+				"id_machines": id,
+			}))
+		}
+	}
+
+	for _, b := range d.Bookers {
+		statements = append(statements, insertSQL("booker", goqu.Record{
+			"id_properties": b.PropertyID,
+			"identifier":    b.Identifier,
+			"name":          b.Name,
+			"email":         b.Email,
+			"phone":         b.Phone,
+			"pin":           b.Pin,
+		}))
+	}
+
+	for _, a := range d.Attachments {
+		for _, machineID := range a.MachineIDs {
+			for _, slotID := range a.SlotIDs {
+				statements = append(statements, fmt.Sprintf(
+					"INSERT IGNORE INTO `slots_machines` (`id_machines`, `id_slots`) VALUES (%d, %d);",
+					machineID, slotID,
+				))
+			}
+
+			if a.SetID > 0 {
+				statements = append(statements, fmt.Sprintf(
+					"INSERT IGNORE INTO `slots_machines` (`id_machines`, `id_slots`) SELECT %d, `id` FROM `slots` WHERE `id_slot_sets` = %d;",
+					machineID, a.SetID,
+				))
+			}
+		}
+	}
+
+	for _, s := range statements {
+		if _, err := io.WriteString(w, s+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertSQL will create an insert statement for one record with the columns
+// in alphabetical order
+func insertSQL(table string, record goqu.Record) string {
+	var columns []string
+	for c := range record {
+		columns = append(columns, c)
+	}
+
+	sort.Strings(columns)
+
+	var values []string
+	for i, c := range columns {
+		values = append(values, sqlValue(record[c]))
+		columns[i] = "`" + c + "`"
+	}
+
+	return fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s);", table, strings.Join(columns, ", "), strings.Join(values, ", "))
+}
+
+// sqlValue will format a value as a MySQL literal
+func sqlValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "NULL"
+	case sqlVar:
+		return string(value)
+	case bool:
+		if value {
+			return "1"
+		}
+
+		return "0"
+	case int:
+		return strconv.Itoa(value)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+	case time.Time:
+		return sqlValue(value.Format("2006-01-02 15:04:05"))
+	case laundry.NullString:
+		if !value.Valid {
+			return "NULL"
+		}
+
+		return sqlValue(value.String)
+	case laundry.NullInt64:
+		if !value.Valid {
+			return "NULL"
+		}
+
+		return sqlValue(value.Int64)
+	case laundry.NullTime:
+		if !value.Valid {
+			return "NULL"
+		}
+
+		return sqlValue(value.Time)
+	}
+
+	return sqlValue(fmt.Sprint(v))
+}
+
+// hasIdentifier returns true if any of the bookers has the identifier
+func hasIdentifier(bookers []laundry.Booker, identifier string) bool {
+	for _, b := range bookers {
+		if b.Identifier == identifier {
+			return true
+		}
+	}
+
+	return false
+}
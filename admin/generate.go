@@ -0,0 +1,312 @@
+/*
+Package admin implements the administrative tasks used by the laundry-admin
+command such as generating base data for a new installation.
+*/
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bombsimon/laundry"
+)
+
+// weekdays maps the abbreviation of each weekday to the weekday number used
+// for slots where sunday is 0
+var weekdays = map[string]int{
+	"sun": 0,
+	"mon": 1,
+	"tue": 2,
+	"wed": 3,
+	"thu": 4,
+	"fri": 5,
+	"sat": 6,
+}
+
+// TimetableSpec describes slots of the same length held between opening and
+// closing time at the given weekdays. If closing is before opening the slots
+// continue after midnight.
+type TimetableSpec struct {
+	Weekdays []int
+	Open     time.Duration
+	Close    time.Duration
+	Length   time.Duration
+}
+
+// ParseTimetableSpec will parse a spec such as "mon-fri 07:00-22:00 3h" where
+// the days are a comma separated list of days or day ranges, the hours are the
+// opening hours and the last part is the length of each slot.
+func ParseTimetableSpec(spec string) (TimetableSpec, error) {
+	var ts TimetableSpec
+
+	parts := strings.Fields(spec)
+	if len(parts) != 3 {
+		return ts, fmt.Errorf("invalid spec '%s', expected days, hours and length such as 'mon-fri 07:00-22:00 3h'", spec)
+	}
+
+	days, err := parseWeekdays(parts[0])
+	if err != nil {
+		return ts, err
+	}
+
+	hours := strings.Split(parts[1], "-")
+	if len(hours) != 2 {
+		return ts, fmt.Errorf("invalid opening hours '%s'", parts[1])
+	}
+
+	open, err := parseClock(hours[0])
+	if err != nil {
+		return ts, err
+	}
+
+	closing, err := parseClock(hours[1])
+	if err != nil {
+		return ts, err
+	}
+
+	if closing <= open {
+		closing += 24 * time.Hour
+	}
+
+	length, err := time.ParseDuration(parts[2])
+	if err != nil || length < time.Minute || length%time.Minute != 0 {
+		return ts, fmt.Errorf("invalid slot length '%s'", parts[2])
+	}
+
+	ts.Weekdays = days
+	ts.Open = open
+	ts.Close = closing
+	ts.Length = length
+
+	return ts, nil
+}
+
+// Slots returns the slots described by the spec in the order of it's weekdays.
+// If the opening hours aren't evenly divisible by the slot length the last slot
+// each day ends at closing time. Slots starting after midnight belongs to the
+// next weekday.
+func (ts TimetableSpec) Slots() []laundry.Slot {
+	var slots []laundry.Slot
+
+	for _, day := range ts.Weekdays {
+		for start := ts.Open; start < ts.Close; start += ts.Length {
+			end := start + ts.Length
+			if end > ts.Close {
+				end = ts.Close
+			}
+
+			slots = append(slots, laundry.Slot{
+				Weekday:   (day + int(start/(24*time.Hour))) % 7,
+				Start:     formatClock(start),
+				End:       formatClock(end),
+				Recurring: true,
+			})
+		}
+	}
+
+	return slots
+}
+
+// Timetable returns the slots from all specs. An error is returned if any of
+// the specs overlaps at the same weekday.
+func Timetable(specs []TimetableSpec) ([]laundry.Slot, error) {
+	for i, a := range specs {
+		for _, b := range specs[i+1:] {
+			if day, ok := a.overlaps(b); ok {
+				return nil, fmt.Errorf("opening hours %s-%s and %s-%s overlaps on weekday %d", formatClock(a.Open), formatClock(a.Close), formatClock(b.Open), formatClock(b.Close), day)
+			}
+		}
+	}
+
+	var slots []laundry.Slot
+	for _, ts := range specs {
+		slots = append(slots, ts.Slots()...)
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].Weekday != slots[j].Weekday {
+			return slots[i].Weekday < slots[j].Weekday
+		}
+
+		return slots[i].Start < slots[j].Start
+	})
+
+	return slots, nil
+}
+
+// overlaps returns the first weekday where the opening hours of two specs
+// overlaps, including hours continuing after midnight into the next day.
+func (ts TimetableSpec) overlaps(other TimetableSpec) (int, bool) {
+	week := 7 * 24 * time.Hour
+
+	for _, a := range ts.Weekdays {
+		for _, b := range other.Weekdays {
+			aStart := time.Duration(a)*24*time.Hour + ts.Open
+			bStart := time.Duration(b)*24*time.Hour + other.Open
+
+			for _, shift := range []time.Duration{-week, 0, week} {
+				s := bStart + shift
+				if aStart < s+(other.Close-other.Open) && s < aStart+(ts.Close-ts.Open) {
+					return a, true
+				}
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// parseWeekdays will parse a comma separated list of weekdays or ranges of
+// weekdays such as "mon-fri,sun". Ranges may wrap the week such as "fri-mon".
+func parseWeekdays(s string) ([]int, error) {
+	var (
+		days []int
+		seen = map[int]bool{}
+	)
+
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid weekdays '%s'", part)
+		}
+
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday '%s'", bounds[0])
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return nil, fmt.Errorf("invalid weekday '%s'", bounds[1])
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			if seen[day] {
+				return nil, fmt.Errorf("weekday '%s' is included more than once", part)
+			}
+
+			seen[day] = true
+			days = append(days, day)
+
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// parseClock will parse a time of the day such as 07:00 or 24:00
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", s)
+	}
+
+	hours, hErr := strconv.Atoi(parts[0])
+	minutes, mErr := strconv.Atoi(parts[1])
+
+	if hErr != nil || mErr != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", s)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// formatClock will format a duration since midnight as a time of the day used
+// for slots. Durations past midnight is formatted as the time the next day.
+func formatClock(d time.Duration) string {
+	d %= 24 * time.Hour
+
+	return fmt.Sprintf("%02d:%02d:00", d/time.Hour, (d%time.Hour)/time.Minute)
+}
+
+// ParseApartments will parse a comma separated list of apartment identifiers
+// or ranges of identifiers such as "1001-1012,1101-1112". Numbers in a range
+// keep the number of digits of the first identifier, i.e. 01-12.
+func ParseApartments(s string) ([]string, error) {
+	var (
+		apartments []string
+		seen       = map[string]bool{}
+	)
+
+	add := func(identifier string) error {
+		if seen[identifier] {
+			return fmt.Errorf("apartment '%s' is included more than once", identifier)
+		}
+
+		seen[identifier] = true
+		apartments = append(apartments, identifier)
+
+		return nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.Split(part, "-")
+		if len(bounds) == 1 {
+			if err := add(part); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		first, fErr := strconv.Atoi(bounds[0])
+		last, lErr := strconv.Atoi(bounds[len(bounds)-1])
+
+		if len(bounds) != 2 || fErr != nil || lErr != nil || first > last {
+			return nil, fmt.Errorf("invalid apartment range '%s'", part)
+		}
+
+		for i := first; i <= last; i++ {
+			if err := add(fmt.Sprintf("%0*d", len(bounds[0]), i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(apartments) == 0 {
+		return nil, fmt.Errorf("no apartments in '%s'", s)
+	}
+
+	return apartments, nil
+}
+
+// Machines returns count machines of the same kind. The info may contain %d
+// which is replaced with the number of the machine starting at first,
+// otherwise the number is appended if more than one machine is created.
+func Machines(roomID int, t laundry.MachineType, count, first int, info string, capacity float64) []laundry.Machine {
+	var machines []laundry.Machine
+
+	for i := first; i < first+count; i++ {
+		name := info
+
+		switch {
+		case strings.Contains(info, "%d"):
+			name = fmt.Sprintf(info, i)
+		case count > 1:
+			name = fmt.Sprintf("%s %d", info, i)
+		}
+
+		machines = append(machines, laundry.Machine{
+			RoomID:   roomID,
+			Info:     name,
+			Working:  true,
+			Type:     t,
+			Capacity: capacity,
+		})
+	}
+
+	return machines
+}
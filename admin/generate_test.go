@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseTimetableSpec(t *testing.T) {
+	Convey("Given a spec for weekdays", t, func() {
+		ts, err := ParseTimetableSpec("mon-fri 07:00-22:00 3h")
+
+		Convey("The spec is parsed", func() {
+			So(err, ShouldBeNil)
+			So(ts.Weekdays, ShouldResemble, []int{1, 2, 3, 4, 5})
+			So(ts.Open, ShouldEqual, 7*time.Hour)
+			So(ts.Close, ShouldEqual, 22*time.Hour)
+		})
+
+		Convey("Each day is divided in slots with the last slot ending at closing time", func() {
+			slots := ts.Slots()
+
+			So(len(slots), ShouldEqual, 25)
+			So(slots[0].Start, ShouldEqual, "07:00:00")
+			So(slots[0].End, ShouldEqual, "10:00:00")
+			So(slots[4].Start, ShouldEqual, "19:00:00")
+			So(slots[4].End, ShouldEqual, "22:00:00")
+		})
+	})
+
+	Convey("Given a spec wrapping the week and midnight", t, func() {
+		ts, err := ParseTimetableSpec("sat-sun,wed 20:00-02:00 2h30m")
+
+		Convey("The slots continue the next day", func() {
+			So(err, ShouldBeNil)
+			So(ts.Weekdays, ShouldResemble, []int{6, 0, 3})
+
+			slots := ts.Slots()
+			So(len(slots), ShouldEqual, 9)
+			So(slots[1].Weekday, ShouldEqual, 6)
+			So(slots[1].Start, ShouldEqual, "22:30:00")
+			So(slots[1].End, ShouldEqual, "01:00:00")
+			So(slots[2].Weekday, ShouldEqual, 0)
+			So(slots[2].Start, ShouldEqual, "01:00:00")
+			So(slots[2].End, ShouldEqual, "02:00:00")
+			So(slots[5].Weekday, ShouldEqual, 1)
+			So(slots[8].Weekday, ShouldEqual, 4)
+		})
+	})
+
+	Convey("Given invalid specs", t, func() {
+		for _, spec := range []string{
+			"mon-fri 07:00-22:00",
+			"monday 07:00-22:00 3h",
+			"mon,mon 07:00-22:00 3h",
+			"mon 7-22 3h",
+			"mon 07:00-25:00 3h",
+			"mon 07:00-22:00 30s",
+		} {
+			_, err := ParseTimetableSpec(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestTimetable(t *testing.T) {
+	Convey("Given specs for weekdays and weekends", t, func() {
+		weekdays, _ := ParseTimetableSpec("mon-fri 07:00-22:00 3h")
+		weekends, _ := ParseTimetableSpec("sat,sun 08:00-20:00 4h")
+
+		slots, err := Timetable([]TimetableSpec{weekdays, weekends})
+
+		Convey("The slots are ordered by weekday and time", func() {
+			So(err, ShouldBeNil)
+			So(len(slots), ShouldEqual, 31)
+			So(slots[0].Weekday, ShouldEqual, 0)
+			So(slots[3].Weekday, ShouldEqual, 1)
+			So(slots[3].Start, ShouldEqual, "07:00:00")
+		})
+	})
+
+	Convey("Given specs overlapping after midnight", t, func() {
+		late, _ := ParseTimetableSpec("fri 20:00-02:00 3h")
+		early, _ := ParseTimetableSpec("sat 01:00-05:00 2h")
+
+		_, err := Timetable([]TimetableSpec{late, early})
+
+		Convey("An error is returned", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseApartments(t *testing.T) {
+	Convey("Given ranges and single apartments", t, func() {
+		apartments, err := ParseApartments("1001-1003, 1101-1102,A1,08-10")
+
+		Convey("All apartments are returned keeping leading zeros", func() {
+			So(err, ShouldBeNil)
+			So(apartments, ShouldResemble, []string{"1001", "1002", "1003", "1101", "1102", "A1", "08", "09", "10"})
+		})
+	})
+
+	Convey("Given invalid patterns", t, func() {
+		for _, pattern := range []string{"1012-1001", "1001-10a", "1001-1003,1002", "", "1-2-3"} {
+			_, err := ParseApartments(pattern)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestMachines(t *testing.T) {
+	Convey("Given machines with and without a number format", t, func() {
+		washers := Machines(1, laundry.MachineWasher, 2, 3, "Washer", 8)
+		dryers := Machines(1, laundry.MachineDryer, 1, 1, "Dryer %d (left)", 0)
+
+		Convey("The machines are numbered", func() {
+			So(washers[0].Info, ShouldEqual, "Washer 3")
+			So(washers[1].Info, ShouldEqual, "Washer 4")
+			So(washers[1].Working, ShouldBeTrue)
+			So(dryers[0].Info, ShouldEqual, "Dryer 1 (left)")
+		})
+	})
+}
+
+func TestWriteSQL(t *testing.T) {
+	Convey("Given a new slot set with slots and machines", t, func() {
+		d := BaseData{
+			SlotSet: &laundry.SlotSet{RoomID: 1, Name: "Owner's set", ValidFrom: time.Date(2018, 5, 7, 0, 0, 0, 0, time.UTC)},
+			Slots: []laundry.Slot{
+				{RoomID: 1, Weekday: 1, Start: "07:00:00", End: "10:00:00", MachineIDs: []int{1, 2}},
+			},
+			Bookers: []laundry.Booker{
+				{PropertyID: 1, Identifier: "1001"},
+			},
+			Attachments: []Attachment{
+				{SetID: 2, MachineIDs: []int{3}},
+			},
+		}
+
+		var buf bytes.Buffer
+		err := d.WriteSQL(&buf)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+		Convey("Slots refer to the created slot set", func() {
+			So(err, ShouldBeNil)
+			So(lines[0], ShouldEqual, "INSERT INTO `slot_sets` (`id_rooms`, `name`, `valid_from`, `valid_to`) VALUES (1, 'Owner\\'s set', '2018-05-07', NULL);")
+			So(lines[1], ShouldEqual, "SET @slot_set = LAST_INSERT_ID();")
+			So(lines[2], ShouldContainSubstring, "VALUES ('10:00:00', 1, @slot_set, 1, '07:00:00', '1');")
+		})
+
+		Convey("Machines refer to the created slot", func() {
+			So(lines[3], ShouldEqual, "SET @slot = LAST_INSERT_ID();")
+			So(lines[4], ShouldEqual, "INSERT INTO `slots_machines` (`id_machines`, `id_slots`) VALUES (1, @slot);")
+		})
+
+		Convey("Bookers and attachments are included", func() {
+			So(lines[6], ShouldEqual, "INSERT INTO `booker` (`email`, `id_properties`, `identifier`, `name`, `phone`, `pin`) VALUES (NULL, 1, '1001', NULL, NULL, NULL);")
+			So(lines[7], ShouldContainSubstring, "WHERE `id_slot_sets` = 2;")
+		})
+	})
+}
@@ -1,13 +1,19 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/config"
 	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/lock"
 	"github.com/bombsimon/laundry/middleware"
 	"github.com/gorilla/mux"
 )
@@ -15,83 +21,95 @@ import (
 // LaundryAPI represents an API to the laundry service
 type LaundryAPI struct {
 	version string
+	lock    lock.Lock
 }
 
-// New will create a new LaundryAPI and add the passed Laundry service
-// in the internal field laundry.
-func New() *LaundryAPI {
-	api := LaundryAPI{"v1"}
+// New will create a new LaundryAPI unlocking doors with the passed lock
+func New(l lock.Lock) *LaundryAPI {
+	api := LaundryAPI{"v1", l}
 
 	return &api
 }
 
-// GetBookers is the HTTP handler to get bookers
-func (api *LaundryAPI) GetBookers(w http.ResponseWriter, r *http.Request) {
-	b, err := laundry.GetBookers()
+func (api *LaundryAPI) GetProperties(w http.ResponseWriter, r *http.Request) {
+	p, err := laundry.GetProperties()
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(b)
+	jb, _ := json.Marshal(p)
 	w.Write(jb)
 }
 
-// AddBooker is the HTTP handler to add a booker
-func (api *LaundryAPI) AddBooker(w http.ResponseWriter, r *http.Request) {
-	var inRequest laundry.Booker
+func (api *LaundryAPI) AddProperty(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
+	var inRequest laundry.Property
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	b, err := laundry.AddBooker(&inRequest)
+	p, err := laundry.AddProperty(&inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(b)
+	jb, _ := json.Marshal(p)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetBooker(w http.ResponseWriter, r *http.Request) {
-	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) GetProperty(w http.ResponseWriter, r *http.Request) {
+	propertyID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	b, err := laundry.GetBooker(bookerId)
+	p, err := laundry.GetProperty(propertyID)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(b)
+	jb, _ := json.Marshal(p)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) UpdateBooker(w http.ResponseWriter, r *http.Request) {
-	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) UpdateProperty(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	var inRequest laundry.Booker
+	propertyID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.Property
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	b, err := laundry.UpdateBooker(bookerId, &inRequest)
+	p, err := laundry.UpdateProperty(propertyID, &inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(b)
+	jb, _ := json.Marshal(p)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) RemoveBooker(w http.ResponseWriter, r *http.Request) {
-	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) RemoveProperty(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	if err := laundry.RemoveBookerByID(bookerId); err != nil {
+	propertyID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemovePropertyByID(propertyID); err != nil {
 		renderError(err, w)
 		return
 	}
@@ -102,81 +120,91 @@ func (api *LaundryAPI) RemoveBooker(w http.ResponseWriter, r *http.Request) {
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetBookerBookings(w http.ResponseWriter, r *http.Request) {
-	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) GetRooms(w http.ResponseWriter, r *http.Request) {
+	propertyID, _ := strconv.Atoi(mux.Vars(r)["property"])
 
-	bookings, err := laundry.GetBookerBookingsByID(bookerId)
+	rooms, err := laundry.GetRooms(propertyID)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(bookings)
+	jb, _ := json.Marshal(rooms)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetMachines(w http.ResponseWriter, r *http.Request) {
-	m, _ := laundry.GetMachines()
-
-	jb, _ := json.Marshal(m)
-	w.Write(jb)
-
-}
+func (api *LaundryAPI) AddRoom(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-func (api *LaundryAPI) AddMachine(w http.ResponseWriter, r *http.Request) {
-	var inRequest laundry.Machine
+	var inRequest laundry.Room
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	m, err := laundry.AddMachine(&inRequest)
+	if propertyID, err := strconv.Atoi(mux.Vars(r)["property"]); err == nil {
+		inRequest.PropertyID = propertyID
+	}
+
+	room, err := laundry.AddRoom(&inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(m)
+	jb, _ := json.Marshal(room)
 	w.Write(jb)
-
 }
 
-func (api *LaundryAPI) GetMachine(w http.ResponseWriter, r *http.Request) {
-	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) GetRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	m, err := laundry.GetMachine(machineId)
+	room, err := laundry.GetRoom(roomID)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(m)
+	jb, _ := json.Marshal(room)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) UpdateMachine(w http.ResponseWriter, r *http.Request) {
-	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) UpdateRoom(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	var inRequest laundry.Machine
+	roomID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.Room
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	m, err := laundry.UpdateMachine(machineId, &inRequest)
+	room, err := laundry.UpdateRoom(roomID, &inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(m)
+	jb, _ := json.Marshal(room)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) RemoveMachine(w http.ResponseWriter, r *http.Request) {
-	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) RemoveRoom(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	if err := laundry.RemoveMachineByID(machineId); err != nil {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveRoomByID(roomID); err != nil {
 		renderError(err, w)
 		return
 	}
@@ -187,70 +215,164 @@ func (api *LaundryAPI) RemoveMachine(w http.ResponseWriter, r *http.Request) {
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetSlots(w http.ResponseWriter, r *http.Request) {
-	s, err := laundry.GetSlots()
+// GetBookers is the HTTP handler to get bookers
+func (api *LaundryAPI) GetBookers(w http.ResponseWriter, r *http.Request) {
+	propertyID, _ := strconv.Atoi(mux.Vars(r)["property"])
+
+	b, err := laundry.GetBookers(propertyID)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(s)
+	jb, _ := json.Marshal(laundry.VisibleBookers(b, middleware.GetCaller(r)))
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) AddSlot(w http.ResponseWriter, r *http.Request) {
-	var inRequest laundry.Slot
+// AddBooker is the HTTP handler to add a booker
+func (api *LaundryAPI) AddBooker(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Booker
+
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	s, err := laundry.AddSlot(&inRequest)
+	if propertyID, err := strconv.Atoi(mux.Vars(r)["property"]); err == nil {
+		inRequest.PropertyID = propertyID
+	}
+
+	b, err := laundry.AddBooker(&inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(s)
+	jb, _ := json.Marshal(b)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetSlot(w http.ResponseWriter, r *http.Request) {
-	slotId, _ := strconv.Atoi(mux.Vars(r)["id"])
+// ImportBookers is the HTTP handler to import bookers from a CSV file sent as
+// the body or as the file field in a multipart form. With the dry_run query
+// parameter the result is returned without importing anything.
+func (api *LaundryAPI) ImportBookers(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	s, err := laundry.GetSlot(slotId)
+	propertyID, pErr := strconv.Atoi(mux.Vars(r)["property"])
+	if pErr != nil {
+		propertyID, _ = strconv.Atoi(r.URL.Query().Get("property"))
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, fErr := r.FormFile("file")
+		if fErr != nil {
+			renderError(errors.New(fErr).Add("Missing file in form").WithStatus(http.StatusBadRequest), w)
+			return
+		}
+
+		defer file.Close()
+
+		body = file
+	}
+
+	result, err := laundry.ImportBookers(propertyID, body, dryRun)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(s)
+	if !result.Valid && !dryRun {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	jb, _ := json.Marshal(result)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) UpdateSlot(w http.ResponseWriter, r *http.Request) {
-	slotId, _ := strconv.Atoi(mux.Vars(r)["id"])
+// ExportBookers is the HTTP handler to export bookers as a CSV file
+func (api *LaundryAPI) ExportBookers(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	var inRequest laundry.Slot
+	propertyID, pErr := strconv.Atoi(mux.Vars(r)["property"])
+	if pErr != nil {
+		propertyID, _ = strconv.Atoi(r.URL.Query().Get("property"))
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="bookers.csv"`)
+
+	if err := laundry.ExportBookers(propertyID, w); err != nil {
+		renderError(err, w)
+	}
+}
+
+func (api *LaundryAPI) GetBooker(w http.ResponseWriter, r *http.Request) {
+	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooker(bookerId)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	visible := b.VisibleTo(middleware.GetCaller(r))
+	if visible == nil {
+		renderError(errors.New("Authentication required").WithStatus(http.StatusUnauthorized), w)
+		return
+	}
+
+	jb, _ := json.Marshal(visible)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) UpdateBooker(w http.ResponseWriter, r *http.Request) {
+	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerId); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Booker
 	if err := getJSONBody(&inRequest, r.Body); err != nil {
 		renderError(err, w)
 		return
 	}
 
-	s, err := laundry.UpdateSlot(slotId, &inRequest)
+	b, err := laundry.UpdateBooker(bookerId, &inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(s)
+	jb, _ := json.Marshal(b)
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) RemoveSlot(w http.ResponseWriter, r *http.Request) {
-	slotID, _ := strconv.Atoi(mux.Vars(r)["id"])
+func (api *LaundryAPI) RemoveBooker(w http.ResponseWriter, r *http.Request) {
+	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
 
-	if err := laundry.RemoveSlotByID(slotID); err != nil {
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerId); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.RemoveBookerByID(bookerId); err != nil {
 		renderError(err, w)
 		return
 	}
@@ -261,32 +383,1512 @@ func (api *LaundryAPI) RemoveSlot(w http.ResponseWriter, r *http.Request) {
 	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetBookings(w http.ResponseWriter, r *http.Request) {
+func (api *LaundryAPI) GetBookerBookings(w http.ResponseWriter, r *http.Request) {
+	bookerId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerId); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	bookings, err := laundry.GetBookerBookingsByID(bookerId)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(bookings)
+	w.Write(jb)
 }
 
-func (api *LaundryAPI) AddBooking(w http.ResponseWriter, r *http.Request) {
+func (api *LaundryAPI) ExportBooker(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	e, err := laundry.ExportBooker(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="booker-%d.json"`, bookerID))
+
+	jb, _ := json.Marshal(e)
+	w.Write(jb)
 }
 
-func (api *LaundryAPI) GetBooking(w http.ResponseWriter, r *http.Request) {
+func (api *LaundryAPI) ResetCalendarToken(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	b, err := laundry.GetBooker(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	token, err := laundry.ResetCalendarToken(b)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var response = struct {
+		Token string `json:"token"`
+	}{token}
+
+	jb, _ := json.Marshal(&response)
+	w.Write(jb)
 }
 
-func (api *LaundryAPI) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+// GetBookerCalendar is the HTTP handler to get the calendar of a booker. The
+// calendar may be subscribed to with the calendar token of the booker.
+func (api *LaundryAPI) GetBookerCalendar(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooker(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		if tErr := laundry.ValidCalendarToken(b, r.URL.Query().Get("token")); tErr != nil {
+			renderError(tErr, w)
+			return
+		}
+	}
+
+	c, err := laundry.BookerCalendar(b)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	c.Encode(w)
 }
 
-func (api *LaundryAPI) RemoveBooking(w http.ResponseWriter, r *http.Request) {
+func (api *LaundryAPI) GetMachines(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	m, _ := laundry.GetMachines(roomID)
+
+	jb, _ := json.Marshal(m)
+	w.Write(jb)
+
 }
 
-func (api *LaundryAPI) GetSchedule(w http.ResponseWriter, r *http.Request) {
-	start, _ := mux.Vars(r)["start"]
-	end, _ := mux.Vars(r)["end"]
+func (api *LaundryAPI) AddMachine(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Machine
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
 
-	s, err := laundry.GetIntervalSchedule(start, end)
+	if roomID, err := strconv.Atoi(mux.Vars(r)["room"]); err == nil {
+		inRequest.RoomID = roomID
+	}
+
+	m, err := laundry.AddMachine(&inRequest)
 	if err != nil {
 		renderError(err, w)
 		return
 	}
 
-	jb, _ := json.Marshal(s)
+	jb, _ := json.Marshal(m)
+	w.Write(jb)
+
+}
+
+func (api *LaundryAPI) GetMachine(w http.ResponseWriter, r *http.Request) {
+	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	m, err := laundry.GetMachine(machineId)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(m)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) UpdateMachine(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.Machine
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	m, err := laundry.UpdateMachine(machineId, &inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(m)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveMachine(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	machineId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveMachineByID(machineId); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlots(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	s, err := laundry.GetSlots(roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AddSlot(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Slot
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if roomID, err := strconv.Atoi(mux.Vars(r)["room"]); err == nil {
+		inRequest.RoomID = roomID
+	}
+
+	if setID, err := strconv.Atoi(mux.Vars(r)["set"]); err == nil {
+		inRequest.SetID.Int64, inRequest.SetID.Valid = int64(setID), true
+	}
+
+	s, err := laundry.AddSlot(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlot(w http.ResponseWriter, r *http.Request) {
+	slotId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s, err := laundry.GetSlot(slotId)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) UpdateSlot(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	slotId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.Slot
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.UpdateSlot(slotId, &inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveSlot(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	slotID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveSlotByID(slotID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetBookings(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	bookings, err := laundry.GetBookings(roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	laundry.VisibleBookings(*bookings, middleware.GetCaller(r))
+
+	jb, _ := json.Marshal(bookings)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AddBooking(w http.ResponseWriter, r *http.Request) {
+	var inRequest laundry.Bookings
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	caller := middleware.GetCaller(r)
+	if inRequest.BookerID == 0 && caller.Booker != nil {
+		inRequest.BookerID = caller.Booker.ID
+	}
+
+	if err := caller.MayAccessBooker(inRequest.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	b, err := laundry.AddBooking(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(b)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(b.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(b)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) UpdateBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	current, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(current.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Bookings
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	b, err := laundry.UpdateBooking(bookingID, &inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(b)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(b.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.RemoveBookingByID(bookingID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetMachineFaults(w http.ResponseWriter, r *http.Request) {
+	machineID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	f, err := laundry.GetMachineFaults(machineID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(f)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) ReportFault(w http.ResponseWriter, r *http.Request) {
+	caller := middleware.GetCaller(r)
+	if err := caller.MayReportFaults(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	machineID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.Fault
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	// Faults are always reported by the caller, administrators without a
+	// booker report faults anonymously
+	inRequest.BookerID = laundry.NullInt64{}
+	if caller.Booker != nil {
+		inRequest.BookerID = laundry.NullInt64{NullInt64: sql.NullInt64{Int64: int64(caller.Booker.ID), Valid: true}}
+	}
+
+	f, err := laundry.ReportFault(machineID, &inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(f)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetFault(w http.ResponseWriter, r *http.Request) {
+	faultID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	f, err := laundry.GetFault(faultID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(f)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AcknowledgeFault(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	faultID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	f, err := laundry.AcknowledgeFault(faultID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(f)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) ResolveFault(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	faultID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	f, err := laundry.ResolveFault(faultID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(f)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	mw, err := laundry.GetMaintenanceWindows()
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(mw)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AddMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.MaintenanceWindow
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	mw, err := laundry.AddMaintenanceWindow(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(mw)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	windowID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	mw, err := laundry.GetMaintenanceWindow(windowID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(mw)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	windowID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveMaintenanceWindowByID(windowID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	start, _ := mux.Vars(r)["start"]
+	end, _ := mux.Vars(r)["end"]
+
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	filter := laundry.ScheduleFilter{
+		RoomID:      roomID,
+		MachineType: laundry.MachineType(r.URL.Query().Get("type")),
+	}
+
+	s, err := laundry.GetIntervalSchedule(start, end, filter)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	laundry.VisibleSchedule(s, middleware.GetCaller(r))
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetScheduleV2(w http.ResponseWriter, r *http.Request) {
+	start, _ := mux.Vars(r)["start"]
+	end, _ := mux.Vars(r)["end"]
+
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	filter := laundry.ScheduleFilter{
+		RoomID:      roomID,
+		MachineType: laundry.MachineType(r.URL.Query().Get("type")),
+	}
+
+	s, err := laundry.GetSchedule(start, end, filter, middleware.GetCaller(r))
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetRoomCalendar is the HTTP handler to get the schedule of a room as a
+// calendar. Since calendar applications can't authenticate the admin token
+// may be passed as a query parameter.
+func (api *LaundryAPI) GetRoomCalendar(w http.ResponseWriter, r *http.Request) {
+	start, _ := mux.Vars(r)["start"]
+	end, _ := mux.Vars(r)["end"]
+
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		if !laundry.AuthenticateAdmin(r.URL.Query().Get("token")) {
+			renderError(err, w)
+			return
+		}
+	}
+
+	c, err := laundry.RoomCalendar(start, end, roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	c.Encode(w)
+}
+
+// ImportClosures is the HTTP handler to close a room at the dates in an
+// uploaded calendar. The calendar may be sent as the body or as the file
+// field in a multipart form.
+func (api *LaundryAPI) ImportClosures(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, fErr := r.FormFile("file")
+		if fErr != nil {
+			renderError(errors.New(fErr).Add("Missing file in form").WithStatus(http.StatusBadRequest), w)
+			return
+		}
+
+		defer file.Close()
+
+		body = file
+	}
+
+	o, err := laundry.ImportClosures(roomID, body)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(o)
+	w.Write(jb)
+}
+
+// UnlockRoom is the HTTP handler to unlock the door to a room for the
+// authenticated booker during a booked slot
+func (api *LaundryAPI) UnlockRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	caller := middleware.GetCaller(r)
+	if caller.Booker == nil {
+		renderError(errors.New("Authentication required").WithStatus(http.StatusUnauthorized), w)
+		return
+	}
+
+	req := lock.Request{
+		RoomID: roomID,
+		Booker: caller.Booker,
+		At:     time.Now(),
+	}
+
+	if err := api.lock.Unlock(&req); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(map[string]interface{}{
+		"room_id":    req.RoomID,
+		"booking_id": req.BookingID,
+		"until":      req.Until,
+	})
+	w.Write(jb)
+}
+
+// GetUnlockAttempts is the HTTP handler to get all attempts to unlock the door
+// to a room
+func (api *LaundryAPI) GetUnlockAttempts(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	a, err := lock.GetAttempts(roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(a)
+	w.Write(jb)
+}
+
+// GetBookerTags is the HTTP handler to get the tags registered to a booker
+func (api *LaundryAPI) GetBookerTags(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	t, err := laundry.GetBookerTags(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(t)
+	w.Write(jb)
+}
+
+// AddBookerTag is the HTTP handler to register a tag to a booker
+func (api *LaundryAPI) AddBookerTag(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.Tag
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	inRequest.BookerID = bookerID
+
+	t, err := laundry.AddTag(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(t)
+	w.Write(jb)
+}
+
+// RemoveTag is the HTTP handler to remove a tag
+func (api *LaundryAPI) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	tagID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.RemoveTagByID(tagID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(struct{}{})
+	w.Write(jb)
+}
+
+// TagAccess is the HTTP handler called by tag readers to know if the door
+// should be unlocked for a tag. Denied tags are not an error, the answer
+// tells if access is allowed.
+func (api *LaundryAPI) TagAccess(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayReadTags(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest struct {
+		Tag    string `json:"tag"`
+		RoomID int    `json:"room_id"`
+	}
+
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	grace := time.Duration(config.GetConfig().Lock.Grace) * time.Minute
+
+	a, err := lock.TagAccess(inRequest.Tag, inRequest.RoomID, time.Now(), grace)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(a)
+	w.Write(jb)
+}
+
+// PinAccess is the HTTP handler called by PIN pads to know if the door should
+// be unlocked for the apartment identifier and pin entered.
+func (api *LaundryAPI) PinAccess(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayReadTags(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest struct {
+		Identifier string `json:"identifier"`
+		Pin        string `json:"pin"`
+		RoomID     int    `json:"room_id"`
+	}
+
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	grace := time.Duration(config.GetConfig().Lock.Grace) * time.Minute
+
+	a, err := lock.PinAccess(inRequest.Identifier, inRequest.Pin, inRequest.RoomID, time.Now(), grace)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(a)
+	w.Write(jb)
+}
+
+// GetBookingNotifications is the HTTP handler to get the notifications set up
+// for a booking
+func (api *LaundryAPI) GetBookingNotifications(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(b.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	n, err := laundry.GetBookingNotifications(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(n)
+	w.Write(jb)
+}
+
+// CheckIn is the HTTP handler for a booker to check in to a booking from the
+// app, i.e. when the door isn't locked
+func (api *LaundryAPI) CheckIn(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(b.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	grace := time.Duration(config.GetConfig().Lock.Grace) * time.Minute
+
+	c, err := laundry.CheckInToBooking(bookingID, laundry.CheckInAPI, time.Now(), grace)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(c)
+	w.Write(jb)
+}
+
+// GetBookerNoShows is the HTTP handler to get the bookings a booker didn't
+// check in to during the last ?days=, 30 by default
+func (api *LaundryAPI) GetBookerNoShows(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	days := 30
+	if d := r.URL.Query().Get("days"); d != "" {
+		var cErr error
+		if days, cErr = strconv.Atoi(d); cErr != nil || days < 1 {
+			renderError(errors.New("Invalid number of days: %s", d).WithStatus(http.StatusBadRequest), w)
+			return
+		}
+	}
+
+	n, err := laundry.GetBookerNoShows(bookerID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(n)
+	w.Write(jb)
+}
+
+// GetBookerStanding is the HTTP handler to see if a booker is blocked from
+// booking due to no shows and late cancellations
+func (api *LaundryAPI) GetBookerStanding(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.GetBookerStanding(bookerID, time.Now())
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetWaitlist is the HTTP handler to get the waitlist of the booker passed
+// with ?booker=, the authenticated booker by default
+func (api *LaundryAPI) GetWaitlist(w http.ResponseWriter, r *http.Request) {
+	caller := middleware.GetCaller(r)
+
+	bookerID, _ := strconv.Atoi(r.URL.Query().Get("booker"))
+	if bookerID == 0 && caller.Booker != nil {
+		bookerID = caller.Booker.ID
+	}
+
+	if err := caller.MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	wl, err := laundry.GetBookerWaitlist(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(wl)
+	w.Write(jb)
+}
+
+// JoinWaitlist is the HTTP handler to wait in line for a booked slot
+func (api *LaundryAPI) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	var inRequest laundry.Waiting
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	caller := middleware.GetCaller(r)
+	if inRequest.BookerID == 0 && caller.Booker != nil {
+		inRequest.BookerID = caller.Booker.ID
+	}
+
+	if err := caller.MayAccessBooker(inRequest.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	wl, err := laundry.AddWaiting(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(wl)
+	w.Write(jb)
+}
+
+// LeaveWaitlist is the HTTP handler to leave a line
+func (api *LaundryAPI) LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	wl, err := laundry.GetWaiting(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(wl.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.RemoveWaiting(wl); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(struct{}{})
+	w.Write(jb)
+}
+
+// AcceptWaitlistOffer is the HTTP handler to book a slot offered from the
+// waitlist
+func (api *LaundryAPI) AcceptWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	wl, err := laundry.GetWaiting(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(wl.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	b, err := laundry.AcceptWaitlistOffer(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(b)
+	w.Write(jb)
+}
+
+// RequestSwap is the HTTP handler for a booker to request to exchange a
+// booking with the booking passed as booking_id
+func (api *LaundryAPI) RequestSwap(w http.ResponseWriter, r *http.Request) {
+	bookingID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	b, err := laundry.GetBooking(bookingID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(b.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest struct {
+		BookingID int `json:"booking_id"`
+	}
+
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.AddSwap(&laundry.Swap{
+		FromBookingID: bookingID,
+		ToBookingID:   inRequest.BookingID,
+	})
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetBookerSwaps is the HTTP handler to get pending swap requests from or to a
+// booker
+func (api *LaundryAPI) GetBookerSwaps(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.GetBookerSwaps(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetSwap is the HTTP handler to get a swap request for any of the bookers
+func (api *LaundryAPI) GetSwap(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s, err := laundry.GetSwap(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	caller := middleware.GetCaller(r)
+	if !caller.IsBooker(s.ToBookerID) {
+		if err := caller.MayAccessBooker(s.FromBookerID); err != nil {
+			renderError(err, w)
+			return
+		}
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// AcceptSwap is the HTTP handler for the requested booker to accept a swap
+func (api *LaundryAPI) AcceptSwap(w http.ResponseWriter, r *http.Request) {
+	api.answerSwap(w, r, laundry.AcceptSwap, true)
+}
+
+// DeclineSwap is the HTTP handler for the requested booker to decline a swap
+func (api *LaundryAPI) DeclineSwap(w http.ResponseWriter, r *http.Request) {
+	api.answerSwap(w, r, laundry.DeclineSwap, true)
+}
+
+// CancelSwap is the HTTP handler for the requesting booker to cancel a swap
+func (api *LaundryAPI) CancelSwap(w http.ResponseWriter, r *http.Request) {
+	api.answerSwap(w, r, laundry.CancelSwap, false)
+}
+
+// answerSwap will answer a swap request. Only the requested booker may accept
+// or decline while only the requesting booker may cancel.
+func (api *LaundryAPI) answerSwap(w http.ResponseWriter, r *http.Request, answer func(int) (*laundry.Swap, *errors.LaundryError), requested bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s, err := laundry.GetSwap(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	bookerID := s.FromBookerID
+	if requested {
+		bookerID = s.ToBookerID
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err = answer(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// AddHold is the HTTP handler to reserve a slot while the booker confirms the
+// booking. The booker defaults to the authenticated booker.
+func (api *LaundryAPI) AddHold(w http.ResponseWriter, r *http.Request) {
+	var inRequest laundry.Hold
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	caller := middleware.GetCaller(r)
+	if inRequest.BookerID == 0 && caller.Booker != nil {
+		inRequest.BookerID = caller.Booker.ID
+	}
+
+	if err := caller.MayAccessBooker(inRequest.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	h, err := laundry.AddHold(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(h)
+	w.Write(jb)
+}
+
+// RemoveHold is the HTTP handler to release a hold before it expires, i.e.
+// when the booker doesn't confirm the booking
+func (api *LaundryAPI) RemoveHold(w http.ResponseWriter, r *http.Request) {
+	h, err := laundry.GetHold(mux.Vars(r)["token"])
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(h.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.RemoveHold(h); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(struct{}{})
+	w.Write(jb)
+}
+
+// AddSeries is the HTTP handler to book a slot repeatedly. The response holds
+// each occurrence booked so far and why any of them couldn't be booked.
+func (api *LaundryAPI) AddSeries(w http.ResponseWriter, r *http.Request) {
+	var inRequest laundry.Series
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	caller := middleware.GetCaller(r)
+	if inRequest.BookerID == 0 && caller.Booker != nil {
+		inRequest.BookerID = caller.Booker.ID
+	}
+
+	if err := caller.MayAccessBooker(inRequest.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.AddSeries(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetSeries is the HTTP handler to get a series and its occurrences
+func (api *LaundryAPI) GetSeries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s, err := laundry.GetSeries(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(s.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// GetBookerSeries is the HTTP handler to get all series of a booker
+func (api *LaundryAPI) GetBookerSeries(w http.ResponseWriter, r *http.Request) {
+	bookerID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := middleware.GetCaller(r).MayAccessBooker(bookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	s, err := laundry.GetBookerSeries(bookerID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(s)
+	w.Write(jb)
+}
+
+// CancelSeries is the HTTP handler to cancel all future occurrences of a
+// series
+func (api *LaundryAPI) CancelSeries(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s, err := laundry.GetSeries(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(s.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := laundry.CancelSeries(s); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(struct{}{})
+	w.Write(jb)
+}
+
+// CancelOccurrence is the HTTP handler to cancel one occurrence of a series
+func (api *LaundryAPI) CancelOccurrence(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	occurrenceID, _ := strconv.Atoi(mux.Vars(r)["occurrence"])
+
+	s, err := laundry.GetSeries(id)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if err := middleware.GetCaller(r).MayAccessBooker(s.BookerID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	o, err := laundry.CancelOccurrence(id, occurrenceID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(o)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlotOverrides(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	o, err := laundry.GetSlotOverrides(roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(o)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AddSlotOverride(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.SlotOverride
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if roomID, err := strconv.Atoi(mux.Vars(r)["room"]); err == nil {
+		inRequest.RoomID = roomID
+	}
+
+	o, err := laundry.AddSlotOverride(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(o)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlotOverride(w http.ResponseWriter, r *http.Request) {
+	overrideID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	o, err := laundry.GetSlotOverride(overrideID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(o)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveSlotOverride(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	overrideID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveSlotOverrideByID(overrideID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlotSets(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(mux.Vars(r)["room"])
+
+	ss, err := laundry.GetSlotSets(roomID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(ss)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) AddSlotSet(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var inRequest laundry.SlotSet
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	if roomID, err := strconv.Atoi(mux.Vars(r)["room"]); err == nil {
+		inRequest.RoomID = roomID
+	}
+
+	ss, err := laundry.AddSlotSet(&inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(ss)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) GetSlotSet(w http.ResponseWriter, r *http.Request) {
+	setID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	ss, err := laundry.GetSlotSet(setID)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(ss)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) UpdateSlotSet(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	setID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	var inRequest laundry.SlotSet
+	if err := getJSONBody(&inRequest, r.Body); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	ss, err := laundry.UpdateSlotSet(setID, &inRequest)
+	if err != nil {
+		renderError(err, w)
+		return
+	}
+
+	jb, _ := json.Marshal(ss)
+	w.Write(jb)
+}
+
+func (api *LaundryAPI) RemoveSlotSet(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.GetCaller(r).MayAdminister(); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	setID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := laundry.RemoveSlotSetByID(setID); err != nil {
+		renderError(err, w)
+		return
+	}
+
+	var empty = struct{}{}
+
+	jb, _ := json.Marshal(&empty)
 	w.Write(jb)
 }
 
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bombsimon/laundry/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdministration(t *testing.T) {
+	Convey("Given the handlers changing properties, rooms, machines and slots", t, func() {
+		api := New(nil)
+
+		handlers := []struct {
+			name    string
+			method  string
+			handler http.HandlerFunc
+		}{
+			{"AddProperty", http.MethodPost, api.AddProperty},
+			{"UpdateProperty", http.MethodPut, api.UpdateProperty},
+			{"RemoveProperty", http.MethodDelete, api.RemoveProperty},
+			{"AddRoom", http.MethodPost, api.AddRoom},
+			{"UpdateRoom", http.MethodPut, api.UpdateRoom},
+			{"RemoveRoom", http.MethodDelete, api.RemoveRoom},
+			{"AddMachine", http.MethodPost, api.AddMachine},
+			{"UpdateMachine", http.MethodPut, api.UpdateMachine},
+			{"RemoveMachine", http.MethodDelete, api.RemoveMachine},
+			{"AddSlot", http.MethodPost, api.AddSlot},
+			{"UpdateSlot", http.MethodPut, api.UpdateSlot},
+			{"RemoveSlot", http.MethodDelete, api.RemoveSlot},
+			{"AddSlotOverride", http.MethodPost, api.AddSlotOverride},
+			{"RemoveSlotOverride", http.MethodDelete, api.RemoveSlotOverride},
+			{"AddSlotSet", http.MethodPost, api.AddSlotSet},
+			{"UpdateSlotSet", http.MethodPut, api.UpdateSlotSet},
+			{"RemoveSlotSet", http.MethodDelete, api.RemoveSlotSet},
+		}
+
+		for _, h := range handlers {
+			h := h
+
+			Convey("Anonymous callers may not call "+h.name, func() {
+				handler := middleware.Adapt(h.handler, middleware.Authenticate())
+
+				r := httptest.NewRequest(h.method, "/", strings.NewReader(`{"name": "Laundry"}`))
+				w := httptest.NewRecorder()
+
+				handler.ServeHTTP(w, r)
+
+				So(w.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		}
+	})
+}
+
+func TestReportFault(t *testing.T) {
+	Convey("Given an anonymous caller", t, func() {
+		handler := middleware.Adapt(http.HandlerFunc(New(nil).ReportFault), middleware.Authenticate())
+
+		Convey("Faults may not be reported", func() {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"description": "Leaking", "booker_id": 1}`))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			So(w.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package laundry
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// Caller represents who is making a request. Admins may see everything while
+// bookers only may see their own personal data. Readers are RFID tag readers
+// and PIN pads at the laundry room doors. A caller without a booker which isn't
+// an admin or a reader is anonymous.
+type Caller struct {
+	Booker *Booker
+	Admin  bool
+	Reader bool
+}
+
+// IsBooker returns true if the caller is the booker with passed id
+func (c Caller) IsBooker(bookerID int) bool {
+	return c.Booker != nil && c.Booker.ID == bookerID
+}
+
+// MayAccessBooker returns an error unless the caller is an admin or the
+// booker with passed id.
+func (c Caller) MayAccessBooker(bookerID int) *errors.LaundryError {
+	if c.Admin || c.IsBooker(bookerID) {
+		return nil
+	}
+
+	if c.Booker == nil {
+		return errors.New("Authentication required").WithStatus(http.StatusUnauthorized)
+	}
+
+	return errors.New("Not allowed to access booker with id %d", bookerID).WithStatus(http.StatusForbidden)
+}
+
+// MayAdminister returns an error unless the caller is an admin
+func (c Caller) MayAdminister() *errors.LaundryError {
+	if c.Admin {
+		return nil
+	}
+
+	if c.Booker == nil {
+		return errors.New("Authentication required").WithStatus(http.StatusUnauthorized)
+	}
+
+	return errors.New("Only administrators are allowed").WithStatus(http.StatusForbidden)
+}
+
+// MayReportFaults returns an error unless the caller is a booker or an admin
+func (c Caller) MayReportFaults() *errors.LaundryError {
+	if c.Admin || c.Booker != nil {
+		return nil
+	}
+
+	return errors.New("Authentication required").WithStatus(http.StatusUnauthorized)
+}
+
+// MayReadTags returns an error unless the caller is a reader device or an admin
+func (c Caller) MayReadTags() *errors.LaundryError {
+	if c.Admin || c.Reader {
+		return nil
+	}
+
+	if c.Booker == nil {
+		return errors.New("Authentication required").WithStatus(http.StatusUnauthorized)
+	}
+
+	return errors.New("Only reader devices are allowed").WithStatus(http.StatusForbidden)
+}
+
+// AuthenticateBooker will return the booker in the property with the given
+// identifier and pin. Identifiers are only unique within a property. Bookers
+// without a pin can never be authenticated.
+func AuthenticateBooker(propertyID int, identifier, pin string) (*Booker, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var bookers []Booker
+	err := db.From("booker").Where(goqu.Ex{
+		"id_properties": propertyID,
+		"identifier":    identifier,
+	}).ScanStructs(&bookers)
+
+	if err != nil {
+		return nil, errors.New("Could not get bookers").CausedBy(err)
+	}
+
+	for _, b := range bookers {
+		if !b.Pin.Valid || b.Pin.String == "" || b.ErasedAt.Valid {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(b.Pin.String), []byte(pin)) == 1 {
+			booker := b
+			return &booker, nil
+		}
+	}
+
+	return nil, errors.New("Invalid identifier or pin").WithStatus(http.StatusUnauthorized)
+}
+
+// AuthenticateAdmin returns true if the token is the configured admin token
+func AuthenticateAdmin(token string) bool {
+	adminToken := config.GetConfig().Administration.Token
+	if adminToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(adminToken), []byte(token)) == 1
+}
+
+// AuthenticateReader returns true if the token is the configured tag reader
+// token
+func AuthenticateReader(token string) bool {
+	readerToken := config.GetConfig().Lock.ReaderToken
+	if readerToken == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(readerToken), []byte(token)) == 1
+}
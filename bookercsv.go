@@ -0,0 +1,322 @@
+package laundry
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// bookerColumns are the columns used when importing and exporting bookers as
+// CSV. A file may start with a header with these names in any order, without
+// a header the columns are expected in this order.
+var bookerColumns = []string{"identifier", "name", "email", "phone", "pin"}
+
+// Actions taken for each line in a booker import
+const (
+	ImportCreate = "create"
+	ImportUpdate = "update"
+)
+
+// BookerImportLine represents a line in an imported CSV file, what will be
+// done with it and why it's invalid if it is.
+type BookerImportLine struct {
+	Line     int      `json:"line"`
+	Booker   Booker   `json:"booker"`
+	Action   string   `json:"action,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	pinGiven bool
+}
+
+// BookerImport represents the result of a booker import
+type BookerImport struct {
+	DryRun  bool               `json:"dry_run"`
+	Valid   bool               `json:"valid"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Lines   []BookerImportLine `json:"lines"`
+}
+
+// ImportBookers will read bookers from a CSV file and add them to a property.
+// Bookers already existing in the property with the same identifier will be
+// updated, an empty PIN keeps the current PIN. If any line is invalid or any
+// booker can't be saved nothing is imported. With dry run the result is
+// returned without changing anything.
+func ImportBookers(propertyID int, r io.Reader, dryRun bool) (*BookerImport, *errors.LaundryError) {
+	if _, err := GetProperty(propertyID); err != nil {
+		return nil, err
+	}
+
+	lines, pErr := parseBookersCSV(r)
+	if pErr != nil {
+		return nil, errors.New("Invalid CSV file").WithStatus(http.StatusBadRequest).CausedBy(pErr)
+	}
+
+	existing, err := GetBookers(propertyID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := planBookerImport(propertyID, lines, existing)
+	result.DryRun = dryRun
+
+	if dryRun || !result.Valid {
+		return result, nil
+	}
+
+	tx, tErr := database.GetGoqu().Begin()
+	if tErr != nil {
+		return nil, errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(tErr)
+	}
+
+	if err := importBookers(tx, result.Lines); err != nil {
+		tx.Rollback()
+		return result, err
+	}
+
+	if cErr := tx.Commit(); cErr != nil {
+		return nil, errors.New("Could not commit import of bookers").WithStatus(http.StatusInternalServerError).CausedBy(cErr)
+	}
+
+	return result, nil
+}
+
+// importBookers will create or update the booker on each planned line within
+// the transaction. Updated bookers already hold the current PIN unless a new
+// PIN was given.
+func importBookers(tx *goqu.TxDatabase, lines []BookerImportLine) *errors.LaundryError {
+	for i := range lines {
+		l := &lines[i]
+
+		record := goqu.Record{
+			"name":      l.Booker.Name,
+			"email":     l.Booker.Email,
+			"phone":     l.Booker.Phone,
+			"pin":       l.Booker.Pin,
+			"hide_name": l.Booker.HideName,
+		}
+
+		switch l.Action {
+		case ImportCreate:
+			record["id_properties"] = l.Booker.PropertyID
+			record["identifier"] = l.Booker.Identifier
+
+			row, err := tx.From("booker").Insert(record).Exec()
+			if err != nil {
+				return errors.New("Could not create booker").CausedBy(err).Add(fmt.Sprintf("Import stopped at line %d", l.Line))
+			}
+
+			lastID, err := row.LastInsertId()
+			if err != nil {
+				return errors.New(err)
+			}
+
+			l.Booker.ID = int(lastID)
+		case ImportUpdate:
+			update := tx.From("booker").
+				Where(goqu.Ex{
+					"id": l.Booker.ID,
+				}).
+				Update(record)
+
+			if _, err := update.Exec(); err != nil {
+				return errors.New("Could not update booker with ID %d", l.Booker.ID).CausedBy(err).Add(fmt.Sprintf("Import stopped at line %d", l.Line))
+			}
+		}
+	}
+
+	return nil
+}
+
+// ExportBookers will write all bookers in a property as CSV to w. PINs are
+// never exported.
+func ExportBookers(propertyID int, w io.Writer) *errors.LaundryError {
+	bookers, err := GetBookers(propertyID)
+	if err != nil {
+		return err
+	}
+
+	if wErr := writeBookersCSV(w, bookers); wErr != nil {
+		return errors.New("Could not write CSV").WithStatus(http.StatusInternalServerError).CausedBy(wErr)
+	}
+
+	return nil
+}
+
+// parseBookersCSV will read all lines in a CSV file and validate each line by
+// itself. Errors are only returned if the file isn't a CSV file.
+func parseBookersCSV(r io.Reader) ([]BookerImportLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		lines   = []BookerImportLine{}
+		columns = map[string]int{}
+		first   = 0
+	)
+
+	for i, c := range bookerColumns {
+		columns[c] = i
+	}
+
+	if len(records) > 0 && isBookersHeader(records[0]) {
+		columns = map[string]int{}
+		for i, c := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(c))] = i
+		}
+
+		first = 1
+	}
+
+	for i, record := range records[first:] {
+		l := BookerImportLine{
+			Line: i + first + 1,
+		}
+
+		value := func(column string) string {
+			index, ok := columns[column]
+			if !ok || index >= len(record) {
+				return ""
+			}
+
+			return strings.TrimSpace(record[index])
+		}
+
+		if len(record) > len(bookerColumns) {
+			l.Errors = append(l.Errors, fmt.Sprintf("Expected at most %d columns, got %d", len(bookerColumns), len(record)))
+		}
+
+		l.Booker.Identifier = value("identifier")
+		l.Booker.Name = nullString(value("name"))
+		l.Booker.Email = nullString(value("email"))
+		l.Booker.Phone = nullString(value("phone"))
+		l.Booker.Pin = nullString(value("pin"))
+		l.pinGiven = l.Booker.Pin.Valid
+
+		if l.Booker.Identifier == "" {
+			l.Errors = append(l.Errors, "Missing identifier")
+		}
+
+		if l.Booker.Email.Valid && !strings.Contains(l.Booker.Email.String, "@") {
+			l.Errors = append(l.Errors, fmt.Sprintf("Invalid email '%s'", l.Booker.Email.String))
+		}
+
+		if l.Booker.Pin.Valid && strings.Trim(l.Booker.Pin.String, "0123456789") != "" {
+			l.Errors = append(l.Errors, "PIN may only contain digits")
+		}
+
+		lines = append(lines, l)
+	}
+
+	return lines, nil
+}
+
+// isBookersHeader returns true if the record is a header, i.e. has an
+// identifier column
+func isBookersHeader(record []string) bool {
+	for _, c := range record {
+		if strings.EqualFold(strings.TrimSpace(c), "identifier") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// planBookerImport will decide if each line creates or updates a booker based
+// on the existing bookers and reject identifiers occurring more than once.
+func planBookerImport(propertyID int, lines []BookerImportLine, existing []Booker) *BookerImport {
+	result := BookerImport{
+		Valid: true,
+		Lines: lines,
+	}
+
+	var (
+		byIdentifier = map[string]Booker{}
+		seen         = map[string]int{}
+	)
+
+	for _, b := range existing {
+		byIdentifier[b.Identifier] = b
+	}
+
+	for i := range result.Lines {
+		l := &result.Lines[i]
+		l.Booker.PropertyID = propertyID
+
+		if l.Booker.Identifier != "" {
+			if line, ok := seen[l.Booker.Identifier]; ok {
+				l.Errors = append(l.Errors, fmt.Sprintf("Identifier '%s' already used on line %d", l.Booker.Identifier, line))
+			}
+
+			seen[l.Booker.Identifier] = l.Line
+		}
+
+		if len(l.Errors) > 0 {
+			result.Valid = false
+			continue
+		}
+
+		b, ok := byIdentifier[l.Booker.Identifier]
+		if !ok {
+			l.Action = ImportCreate
+			result.Created++
+
+			continue
+		}
+
+		l.Action = ImportUpdate
+		l.Booker.ID = b.ID
+		l.Booker.HideName = b.HideName
+
+		if !l.pinGiven {
+			l.Booker.Pin = b.Pin
+		}
+
+		result.Updated++
+	}
+
+	return &result
+}
+
+// writeBookersCSV will write a header and one line per booker to w
+func writeBookersCSV(w io.Writer, bookers []Booker) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(bookerColumns); err != nil {
+		return err
+	}
+
+	for _, b := range bookers {
+		record := []string{b.Identifier, b.Name.String, b.Email.String, b.Phone.String, ""}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// nullString returns a NullString which is null if s is empty
+func nullString(s string) NullString {
+	var ns NullString
+	ns.String, ns.Valid = s, s != ""
+
+	return ns
+}
@@ -0,0 +1,106 @@
+package laundry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseBookersCSV(t *testing.T) {
+	Convey("Given a CSV file with a header in another order", t, func() {
+		csv := "pin,identifier,name\n1234,1001,Some User\n,1002,\n"
+
+		lines, err := parseBookersCSV(strings.NewReader(csv))
+
+		Convey("Columns are read by name", func() {
+			So(err, ShouldBeNil)
+			So(len(lines), ShouldEqual, 2)
+			So(lines[0].Line, ShouldEqual, 2)
+			So(lines[0].Booker.Identifier, ShouldEqual, "1001")
+			So(lines[0].Booker.Name.String, ShouldEqual, "Some User")
+			So(lines[0].Booker.Pin.String, ShouldEqual, "1234")
+			So(lines[1].Booker.Name.Valid, ShouldBeFalse)
+			So(lines[1].pinGiven, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a CSV file without a header", t, func() {
+		csv := "1001,Some User,some.email@domain.com,070-123,1234\n,No Identifier\n1003,,not-an-email,,12a4\n"
+
+		lines, err := parseBookersCSV(strings.NewReader(csv))
+
+		Convey("Columns are read in order", func() {
+			So(err, ShouldBeNil)
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0].Line, ShouldEqual, 1)
+			So(lines[0].Booker.Phone.String, ShouldEqual, "070-123")
+			So(lines[0].Errors, ShouldBeEmpty)
+		})
+
+		Convey("Each invalid line has its own errors", func() {
+			So(lines[1].Errors, ShouldResemble, []string{"Missing identifier"})
+			So(len(lines[2].Errors), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestPlanBookerImport(t *testing.T) {
+	Convey("Given existing bookers and an import", t, func() {
+		existing := []Booker{
+			{ID: 1, PropertyID: 1, Identifier: "1001", Pin: nullString("1234"), HideName: true},
+		}
+
+		lines, _ := parseBookersCSV(strings.NewReader("identifier,name\n1001,Some User\n1002,Another User\n"))
+		result := planBookerImport(1, lines, existing)
+
+		Convey("Existing bookers are updated and new are created", func() {
+			So(result.Valid, ShouldBeTrue)
+			So(result.Created, ShouldEqual, 1)
+			So(result.Updated, ShouldEqual, 1)
+			So(result.Lines[0].Action, ShouldEqual, ImportUpdate)
+			So(result.Lines[0].Booker.ID, ShouldEqual, 1)
+			So(result.Lines[1].Action, ShouldEqual, ImportCreate)
+			So(result.Lines[1].Booker.PropertyID, ShouldEqual, 1)
+		})
+
+		Convey("Updated bookers keep their PIN and privacy setting", func() {
+			So(result.Lines[0].Booker.Pin.String, ShouldEqual, "1234")
+			So(result.Lines[0].Booker.HideName, ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an import with a duplicate identifier", t, func() {
+		lines, _ := parseBookersCSV(strings.NewReader("1001\n1002\n1001\n"))
+		result := planBookerImport(1, lines, nil)
+
+		Convey("The import is invalid", func() {
+			So(result.Valid, ShouldBeFalse)
+			So(result.Lines[2].Errors, ShouldResemble, []string{"Identifier '1001' already used on line 1"})
+		})
+	})
+}
+
+func TestWriteBookersCSV(t *testing.T) {
+	Convey("Given bookers", t, func() {
+		bookers := []Booker{
+			{Identifier: "1001", Name: nullString("User, Some"), Pin: nullString("1234")},
+		}
+
+		var buf bytes.Buffer
+		err := writeBookersCSV(&buf, bookers)
+
+		Convey("The bookers are written without PIN", func() {
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "identifier,name,email,phone,pin\n1001,\"User, Some\",,,\n")
+		})
+
+		Convey("The file can be imported again", func() {
+			lines, err := parseBookersCSV(&buf)
+
+			So(err, ShouldBeNil)
+			So(lines[0].Booker.Name.String, ShouldEqual, "User, Some")
+		})
+	})
+}
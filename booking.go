@@ -1,11 +1,15 @@
 package laundry
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
 	"time"
 
+	"github.com/bombsimon/laundry/config"
 	"github.com/bombsimon/laundry/database"
 	"github.com/bombsimon/laundry/errors"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	"gopkg.in/doug-martin/goqu.v4"
 	// MySQL driver for goqu
@@ -17,37 +21,45 @@ type BookingsSearch struct {
 	Start  time.Time
 	End    time.Time
 	Booker *Booker
+	RoomID int
 }
 
 // Booker represents a booker
 type Booker struct {
-	ID         int        `db:"id"         json:"id"`
-	Identifier string     `db:"identifier" json:"identifier"` // Apartment number
-	Name       NullString `db:"name"       json:"name"`
-	Email      NullString `db:"email"      json:"email"`
-	Phone      NullString `db:"phone"      json:"phone"`
-	Pin        NullString `db:"pin"        json:"-"`
+	ID            int        `db:"id"             json:"id"`
+	PropertyID    int        `db:"id_properties"  json:"property_id"`
+	Identifier    string     `db:"identifier"     json:"identifier"` // Apartment number
+	Name          NullString `db:"name"           json:"name"`
+	Email         NullString `db:"email"          json:"email"`
+	Phone         NullString `db:"phone"          json:"phone"`
+	Pin           NullString `db:"pin"            json:"-"`
+	HideName      bool       `db:"hide_name"      json:"hide_name"`
+	ErasedAt      NullTime   `db:"erased_at"      json:"erased_at"`
+	CalendarToken NullString `db:"calendar_token" json:"-"`
 }
 
-// Bookings represents a booking
+// Bookings represents a booking. HoldToken is the token of a hold on the slot
+// consumed when the booking is added.
 type Bookings struct {
-	ID       int       `db:"id"        json:"id"`
-	BookDate time.Time `db:"book_date" json:"book_date"`
-	SlotID   int       `db:"id_slots"  json:"slot_id"`
-	BookerID int       `db:"id_booker" json:"booker_id"`
+	ID        int       `db:"id"        json:"id"`
+	BookDate  time.Time `db:"book_date" json:"book_date"`
+	SlotID    int       `db:"id_slots"  json:"slot_id"`
+	BookerID  int       `db:"id_booker" json:"booker_id"`
+	HoldToken string    `db:"-"         json:"hold_token,omitempty"`
 }
 
 // BookerBookingsRow represents the database struct to use when fetching
-// bookings (slots, machines) and booker.
+// bookings, slots and booker. Each column is prefixed with it's table name
+// since the tables share column names.
 type BookerBookingsRow struct {
-	Booker
-	Bookings
-	Slot
-	Machine
+	Booker   `db:"booker"`
+	Bookings `db:"bookings"`
+	Slot     `db:"slots"`
 }
 
 // BookerBookings represents a booking including a Booker structure
 type BookerBookings struct {
+	ID       int       `json:"id"`
 	BookDate time.Time `json:"date"`
 	Slot     Slot      `json:"slot"`
 	Booker   Booker    `json:"booker"`
@@ -75,12 +87,18 @@ func GetBooker(id int) (*Booker, *errors.LaundryError) {
 	return &b, nil
 }
 
-// GetBookers will return a list of all bookers available
-func GetBookers() ([]Booker, *errors.LaundryError) {
+// GetBookers will return a list of all bookers in a property. Erased bookers
+// are never returned.
+func GetBookers(propertyID int) ([]Booker, *errors.LaundryError) {
 	db := database.GetGoqu()
 
+	query := db.From("booker").Where(
+		goqu.I("erased_at").IsNull(),
+		goqu.Ex{"id_properties": propertyID},
+	)
+
 	var bookers []Booker
-	if err := db.From("booker").ScanStructs(&bookers); err != nil {
+	if err := query.ScanStructs(&bookers); err != nil {
 		return bookers, errors.New("Could not get bookers").CausedBy(err)
 	}
 
@@ -95,14 +113,20 @@ func AddBooker(b *Booker) (*Booker, *errors.LaundryError) {
 		return nil, errors.New("Missing identifier in request").WithStatus(http.StatusBadRequest)
 	}
 
+	if _, err := GetProperty(b.PropertyID); err != nil {
+		return nil, err
+	}
+
 	db := database.GetGoqu()
 
 	insert := db.From("booker").Insert(goqu.Record{
-		"identifier": b.Identifier,
-		"name":       b.Name,
-		"email":      b.Email,
-		"phone":      b.Phone,
-		"pin":        b.Pin,
+		"id_properties": b.PropertyID,
+		"identifier":    b.Identifier,
+		"name":          b.Name,
+		"email":         b.Email,
+		"phone":         b.Phone,
+		"pin":           b.Pin,
+		"hide_name":     b.HideName,
 	})
 
 	row, err := insert.Exec()
@@ -128,9 +152,14 @@ func UpdateBooker(bookerID int, ub *Booker) (*Booker, *errors.LaundryError) {
 		return nil, berr
 	}
 
+	if b.ErasedAt.Valid {
+		return nil, errors.New("Booker with ID %d is erased", b.ID).WithStatus(http.StatusGone)
+	}
+
 	b.Name = ub.Name
 	b.Email = ub.Email
 	b.Phone = ub.Phone
+	b.HideName = ub.HideName
 
 	db := database.GetGoqu()
 
@@ -144,6 +173,7 @@ func UpdateBooker(bookerID int, ub *Booker) (*Booker, *errors.LaundryError) {
 			"email":      b.Email,
 			"phone":      b.Phone,
 			"pin":        b.Pin,
+			"hide_name":  b.HideName,
 		})
 
 	if _, err := update.Exec(); err != nil {
@@ -153,20 +183,89 @@ func UpdateBooker(bookerID int, ub *Booker) (*Booker, *errors.LaundryError) {
 	return b, nil
 }
 
-// RemoveBooker will take a Booker and remove the row with corresponding
-// id in the database. A remove will cascade and remove belonging bookings
-// and notifications.
+// RemoveBooker will erase all personal data for a Booker. Future bookings,
+// their notifications, the tags, the series and the waitlist of the booker are
+// removed while past bookings are kept for statistics but can no longer be
+// tied to a person since the booker is anonymised. Nothing is changed unless
+// the booker can be erased completely.
 func RemoveBooker(b *Booker) *errors.LaundryError {
-	db := database.GetGoqu()
+	tx, err := database.GetGoqu().Begin()
+	if err != nil {
+		return errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	if err := removeBooker(tx, b); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.New("Could not commit erasure of booker with id %d", b.ID).WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	return nil
+}
+
+// removeBooker will remove the data of the booker within the transaction
+func removeBooker(tx *goqu.TxDatabase, b *Booker) *errors.LaundryError {
+	delete := tx.From("bookings").
+		Where(
+			goqu.I("id_booker").Eq(b.ID),
+			goqu.I("book_date").Gte(today().Format("2006-01-02")),
+		).
+		Delete()
 
-	delete := db.From("booker").
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove future bookings for booker with id %d", b.ID).CausedBy(err)
+	}
+
+	deleteTags := tx.From("booker_tags").
 		Where(goqu.Ex{
-			"id": b.ID,
+			"id_booker": b.ID,
 		}).
 		Delete()
 
-	if _, err := delete.Exec(); err != nil {
-		return errors.New("Could not remove booker").CausedBy(err)
+	if _, err := deleteTags.Exec(); err != nil {
+		return errors.New("Could not remove tags for booker with id %d", b.ID).CausedBy(err)
+	}
+
+	deleteSeries := tx.From("series").
+		Where(goqu.Ex{
+			"id_booker": b.ID,
+		}).
+		Delete()
+
+	if _, err := deleteSeries.Exec(); err != nil {
+		return errors.New("Could not remove series for booker with id %d", b.ID).CausedBy(err)
+	}
+
+	deleteWaitlist := tx.From("waitlist").
+		Where(goqu.Ex{
+			"id_booker": b.ID,
+		}).
+		Delete()
+
+	if _, err := deleteWaitlist.Exec(); err != nil {
+		return errors.New("Could not remove waitlist entries for booker with id %d", b.ID).CausedBy(err)
+	}
+
+	update := tx.From("booker").
+		Where(goqu.Ex{
+			"id": b.ID,
+		}).
+		Update(goqu.Record{
+			"identifier":     "",
+			"name":           nil,
+			"email":          nil,
+			"phone":          nil,
+			"pin":            nil,
+			"hide_name":      true,
+			"erased_at":      time.Now(),
+			"calendar_token": nil,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return errors.New("Could not erase booker with id %d", b.ID).CausedBy(err)
 	}
 
 	return nil
@@ -187,9 +286,9 @@ func RemoveBookerByID(id int) *errors.LaundryError {
 // not from the past.
 func GetBookerBookings(b *Booker) (*[]BookerBookings, *errors.LaundryError) {
 	bs := BookingsSearch{
-		time.Now(),
-		time.Now().AddDate(10, 0, 0),
-		b,
+		Start:  today(),
+		End:    today().AddDate(10, 0, 0),
+		Booker: b,
 	}
 
 	return SearchBookings(bs)
@@ -206,21 +305,448 @@ func GetBookerBookingsByID(id int) (*[]BookerBookings, *errors.LaundryError) {
 	return GetBookerBookings(b)
 }
 
-// SearchBookings will return a list of BookerBookings based on passed search criteria
-// TODO: This should not be inflated like this, the query is bad.
+// GetBookings will return all future bookings in a room.
+func GetBookings(roomID int) (*[]BookerBookings, *errors.LaundryError) {
+	bs := BookingsSearch{
+		Start:  today(),
+		End:    today().AddDate(10, 0, 0),
+		RoomID: roomID,
+	}
+
+	return SearchBookings(bs)
+}
+
+// CurrentBooking will return the booking a booker has in a room at the given
+// time. The booking is current from grace before the slot starts until grace
+// after it ends. If the booker has no current booking nil is returned.
+func CurrentBooking(bookerID, roomID int, at time.Time, grace time.Duration) (*BookerBookings, *errors.LaundryError) {
+	date := civilDate(at.In(buildingLocation()))
+
+	bs := BookingsSearch{
+		Start:  date.AddDate(0, 0, -1),
+		End:    date.AddDate(0, 0, 1),
+		Booker: &Booker{ID: bookerID},
+		RoomID: roomID,
+	}
+
+	bookings, err := SearchBookings(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	return currentBooking(*bookings, at, grace), nil
+}
+
+// currentBooking returns the first booking held at the given time including
+// the grace period
+func currentBooking(bookings []BookerBookings, at time.Time, grace time.Duration) *BookerBookings {
+	for i, b := range bookings {
+		starts := b.Slot.StartsAt(b.BookDate).Add(-grace)
+		ends := b.Slot.EndsAt(b.BookDate).Add(grace)
+
+		if !at.Before(starts) && at.Before(ends) {
+			return &bookings[i]
+		}
+	}
+
+	return nil
+}
+
+// GetBooking will return a booking based on an id. If the booking is not
+// found or an error fetching the booking occurs, an error will be returned.
+func GetBooking(id int) (*Bookings, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var b Bookings
+	found, err := db.From("bookings").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&b)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Booking with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &b, nil
+}
+
+// AddBooking will validate the passed Bookings and add it to the database if
+// the slot is available at the given date. The booking is created in a
+// transaction and a slot can only be booked once per date so if two bookers
+// book the same slot at once only the first one succeeds.
+func AddBooking(b *Bookings) (*Bookings, *errors.LaundryError) {
+	if err := validBooking(b); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.GetGoqu().Begin()
+	if err != nil {
+		return nil, errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	if err := addBooking(tx, b); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, bookingConflict(err, b, "Could not commit booking")
+	}
+
+	return b, nil
+}
+
+// addBooking will consume the hold of the booking if any and insert the
+// booking within the transaction
+func addBooking(tx *goqu.TxDatabase, b *Bookings) *errors.LaundryError {
+	if err := consumeHold(tx, b); err != nil {
+		return err
+	}
+
+	insert := tx.From("bookings").Insert(goqu.Record{
+		"book_date": b.BookDate.Format("2006-01-02"),
+		"id_slots":  b.SlotID,
+		"id_booker": b.BookerID,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return bookingConflict(err, b, "Could not create booking")
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return errors.New(err)
+	}
+
+	b.ID = int(lastID)
+
+	return nil
+}
+
+// UpdateBooking will move an existing booking to the date and slot of the
+// passed Bookings. The booker of a booking cannot be changed. A booking cannot
+// be moved once its slot has started and moving it away from a slot is the
+// same as cancelling the old slot.
+func UpdateBooking(bookingID int, ub *Bookings) (*Bookings, *errors.LaundryError) {
+	b, err := GetBooking(bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	oldSlot, err := GetSlot(b.SlotID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if !now.Before(oldSlot.StartsAt(b.BookDate)) {
+		return nil, errors.New("Booking with id %d has already started", b.ID).WithStatus(http.StatusConflict)
+	}
+
+	old := *b
+
+	b.BookDate = ub.BookDate
+	b.SlotID = ub.SlotID
+
+	if err := validBooking(b); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	update := db.From("bookings").
+		Where(goqu.Ex{
+			"id": b.ID,
+		}).
+		Update(goqu.Record{
+			"book_date": b.BookDate.Format("2006-01-02"),
+			"id_slots":  b.SlotID,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return nil, bookingConflict(err, b, "Could not update booking")
+	}
+
+	if old.SlotID == b.SlotID && old.BookDate.Equal(b.BookDate) {
+		return b, nil
+	}
+
+	r := Release{
+		BookingID:  old.ID,
+		BookerID:   old.BookerID,
+		Slot:       *oldSlot,
+		BookDate:   old.BookDate,
+		Reason:     ReleaseCancelled,
+		ReleasedAt: now,
+	}
+
+	if err := cancelled(r); err != nil {
+		return nil, err
+	}
+
+	released(r)
+
+	return b, nil
+}
+
+// mysqlDuplicateEntry is the MySQL error number for a row violating a unique
+// constraint
+const mysqlDuplicateEntry = 1062
+
+// isDuplicateEntry returns true if the error is caused by a unique constraint
+func isDuplicateEntry(err error) bool {
+	mErr, ok := err.(*mysql.MySQLError)
+
+	return ok && mErr.Number == mysqlDuplicateEntry
+}
+
+// bookingConflict returns a conflict if the error is caused by the slot
+// already being booked at the date, otherwise an error with passed message
+func bookingConflict(err error, b *Bookings, message string) *errors.LaundryError {
+	if isDuplicateEntry(err) {
+		return errors.New("Slot with id %d is already booked", b.SlotID).WithStatus(http.StatusConflict)
+	}
+
+	return errors.New(message).CausedBy(err)
+}
+
+// isValidationError returns true if the booking was rejected by the rules for
+// bookings and not because a query failed. Errors from failing queries always
+// keep the error causing them.
+func isValidationError(err *errors.LaundryError) bool {
+	return err.Origin == nil && err.Status < http.StatusInternalServerError
+}
+
+// RemoveBooking will remove a booking and it's notifications
+func RemoveBooking(b *Bookings) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("bookings").
+		Where(goqu.Ex{
+			"id": b.ID,
+		}).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove booking with id %d", b.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveBookingByID will cancel a booking by the booking id. If the slot
+// hasn't ended yet it's released to bookers watching it and the booker may be
+// penalised for cancelling late.
+func RemoveBookingByID(id int) *errors.LaundryError {
+	b, err := GetBooking(id)
+	if err != nil {
+		return err
+	}
+
+	slot, err := GetSlot(b.SlotID)
+	if err != nil {
+		return err
+	}
+
+	if err := RemoveBooking(b); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if !now.Before(slot.EndsAt(b.BookDate)) {
+		return nil
+	}
+
+	r := Release{
+		BookingID:  b.ID,
+		BookerID:   b.BookerID,
+		Slot:       *slot,
+		BookDate:   b.BookDate,
+		Reason:     ReleaseCancelled,
+		ReleasedAt: now,
+	}
+
+	if err := cancelled(r); err != nil {
+		return err
+	}
+
+	released(r)
+
+	return nil
+}
+
+// validBooking will make sure that the booker and slot exists, that the slot
+// is held at the booked date and that it's not already booked, held by someone
+// else or closed by an override or maintenance.
+func validBooking(b *Bookings) *errors.LaundryError {
+	if b.BookDate.IsZero() {
+		return errors.New("Missing book date in request").WithStatus(http.StatusBadRequest)
+	}
+
+	// Only the date is relevant for a booking
+	b.BookDate = civilDate(b.BookDate)
+
+	if b.BookDate.Before(today()) {
+		return errors.New("Cannot book a slot in the past").WithStatus(http.StatusBadRequest)
+	}
+
+	booker, err := GetBooker(b.BookerID)
+	if err != nil {
+		return err
+	}
+
+	slot, err := GetSlot(b.SlotID)
+	if err != nil {
+		return err
+	}
+
+	room, err := GetRoom(slot.RoomID)
+	if err != nil {
+		return err
+	}
+
+	// Bookers may only book slots in rooms in their own property
+	if !roomInProperty(*room, booker.PropertyID) {
+		return errors.New("Slot with id %d is not in the property of booker with id %d", slot.ID, booker.ID).WithStatus(http.StatusForbidden)
+	}
+
+	if err := mayBook(booker.ID); err != nil {
+		return err
+	}
+
+	overrides, err := searchSlotOverrides(slot.RoomID, b.BookDate, b.BookDate)
+	if err != nil {
+		return err
+	}
+
+	windows, err := searchMaintenanceWindows(b.BookDate, b.BookDate)
+	if err != nil {
+		return err
+	}
+
+	sets, err := slotSetsByID(slot.RoomID)
+	if err != nil {
+		return err
+	}
+
+	// The slot as it's held at the booked date, if held at all
+	ds := daySlots(b.BookDate, []Slot{*slot}, sets, overrides, windows)
+
+	if len(ds) == 0 {
+		return errors.New("Slot with id %d is not available on %s", slot.ID, b.BookDate.Format("2006-01-02"))
+	}
+
+	if ds[0].Closed {
+		return errors.New("Slot with id %d is closed on %s", slot.ID, b.BookDate.Format("2006-01-02")).WithStatus(http.StatusConflict)
+	}
+
+	if err := offeredToOther(b); err != nil {
+		return err
+	}
+
+	if err := heldByOther(b); err != nil {
+		return err
+	}
+
+	db := database.GetGoqu()
+
+	taken, cErr := db.From("bookings").
+		Where(
+			goqu.I("book_date").Eq(b.BookDate.Format("2006-01-02")),
+			goqu.I("id_slots").Eq(slot.ID),
+			goqu.I("id").Neq(b.ID),
+		).
+		Count()
+
+	if cErr != nil {
+		return errors.New("Could not get bookings").CausedBy(cErr)
+	}
+
+	if taken > 0 {
+		return errors.New("Slot with id %d is already booked", slot.ID).WithStatus(http.StatusConflict)
+	}
+
+	return validMachineTypeLimits(b, &ds[0].Slot)
+}
+
+// validMachineTypeLimits will make sure that the booker doesn't exceed the
+// configured number of bookings per day for any machine type in the slot.
+func validMachineTypeLimits(b *Bookings, slot *Slot) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	maxPerDay := config.GetConfig().Bookings.MaxPerDay
+	booked := make(map[MachineType]int)
+
+	for t := range maxPerDay {
+		if !slot.HasMachineType(MachineType(t)) {
+			continue
+		}
+
+		var ids []int
+		err := db.From("bookings").
+			SelectDistinct("bookings.id").
+			LeftJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_slots").Eq(goqu.I("bookings.id_slots")))).
+			LeftJoin(goqu.I("machines"), goqu.On(goqu.I("machines.id").Eq(goqu.I("slots_machines.id_machines")))).
+			Where(
+				goqu.I("bookings.id_booker").Eq(b.BookerID),
+				goqu.I("bookings.book_date").Eq(b.BookDate.Format("2006-01-02")),
+				goqu.I("bookings.id").Neq(b.ID),
+				goqu.I("machines.type").Eq(t),
+			).
+			ScanVals(&ids)
+
+		if err != nil {
+			return errors.New("Could not get bookings").CausedBy(err)
+		}
+
+		booked[MachineType(t)] = len(ids)
+	}
+
+	return machineTypeLimit(*slot, booked, maxPerDay)
+}
+
+// machineTypeLimit returns an error if booking the slot would exceed the
+// number of bookings allowed per day for any of the machine types in the
+// slot. Booked holds the number of other bookings the same day per type.
+func machineTypeLimit(slot Slot, booked map[MachineType]int, maxPerDay map[string]int) *errors.LaundryError {
+	for t, max := range maxPerDay {
+		if !slot.HasMachineType(MachineType(t)) {
+			continue
+		}
+
+		if booked[MachineType(t)] >= max {
+			return errors.New("Only %d booking(s) with a %s allowed per day", max, t).WithStatus(http.StatusConflict)
+		}
+	}
+
+	return nil
+}
+
+// SearchBookings will return a list of BookerBookings based on passed search
+// criteria ordered by date and start time
 func SearchBookings(bs BookingsSearch) (*[]BookerBookings, *errors.LaundryError) {
 	db := database.GetGoqu()
 
+	var columns []interface{}
+	columns = append(columns, prefixedColumns("bookings", Bookings{})...)
+	columns = append(columns, prefixedColumns("booker", Booker{})...)
+	columns = append(columns, prefixedColumns("slots", Slot{})...)
+
 	query := db.From("bookings").
-		Select("bookings.*", "booker.*", "slots.*", "machines.*").
-		LeftJoin(goqu.I("booker"), goqu.On(goqu.I("booker.id").Eq(goqu.I("bookings.id_booker")))).
-		LeftJoin(goqu.I("slots"), goqu.On(goqu.I("slots.id").Eq(goqu.I("bookings.id_slots")))).
-		LeftJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_slots").Eq(goqu.I("slots.id")))).
-		LeftJoin(goqu.I("machines"), goqu.On(goqu.I("machines.id").Eq(goqu.I("slots_machines.id_machines")))).
+		Select(columns...).
+		InnerJoin(goqu.I("booker"), goqu.On(goqu.I("booker.id").Eq(goqu.I("bookings.id_booker")))).
+		InnerJoin(goqu.I("slots"), goqu.On(goqu.I("slots.id").Eq(goqu.I("bookings.id_slots")))).
 		Where(
-			goqu.L("bookings.book_date >= DATE(?)", bs.Start.String()),
-			goqu.L("bookings.book_date <= DATE(?)", bs.End.String()),
+			goqu.L("bookings.book_date >= DATE(?)", bs.Start.Format("2006-01-02")),
+			goqu.L("bookings.book_date <= DATE(?)", bs.End.Format("2006-01-02")),
 		).
+		Order(goqu.I("bookings.book_date").Asc(), goqu.I("slots.start_time").Asc()).
 		Prepared(true)
 
 	if bs.Booker != nil {
@@ -231,6 +757,14 @@ func SearchBookings(bs BookingsSearch) (*[]BookerBookings, *errors.LaundryError)
 			Prepared(true)
 	}
 
+	if bs.RoomID > 0 {
+		query = query.
+			Where(
+				goqu.I("slots.id_rooms").Eq(bs.RoomID),
+			).
+			Prepared(true)
+	}
+
 	sql, args, _ := query.ToSql()
 
 	sqlxDb := database.GetConnection()
@@ -241,65 +775,117 @@ func SearchBookings(bs BookingsSearch) (*[]BookerBookings, *errors.LaundryError)
 
 	result, parseErr := parseBookings(rows)
 	if parseErr != nil {
-		return nil, errors.New(parseErr)
+		return nil, parseErr
 	}
 
 	return result, nil
 }
 
 // parseBookings will take an *sql.Rows and parse to a list of BookerBookings
+// including the machines of each booked slot.
 func parseBookings(rows *sqlx.Rows) (*[]BookerBookings, *errors.LaundryError) {
 	defer rows.Close()
 
-	var bookings = make(map[Bookings]BookerBookings)
-	var machines = make(map[Bookings][]Machine)
+	var bookings = []BookerBookings{}
+	var slotIDs []int
 
 	for rows.Next() {
-		var bl = new(BookerBookingsRow)
-		if err := rows.StructScan(bl); err != nil {
+		var bl BookerBookingsRow
+		if err := rows.StructScan(&bl); err != nil {
 			return nil, errors.New("Could not get bookings").CausedBy(err)
 		}
 
-		booker := Booker{
-			ID:         bl.Booker.ID,
-			Identifier: bl.Booker.Identifier,
-			Name:       bl.Booker.Name,
-			Email:      bl.Booker.Email,
-			Phone:      bl.Booker.Phone,
-		}
+		bookings = append(bookings, BookerBookings{
+			ID:       bl.Bookings.ID,
+			BookDate: bl.Bookings.BookDate,
+			Booker:   bl.Booker,
+			Slot:     bl.Slot,
+		})
 
-		machine := Machine{
-			ID:      bl.Machine.ID,
-			Info:    bl.Machine.Info,
-			Working: bl.Machine.Working,
-		}
+		slotIDs = append(slotIDs, bl.Slot.ID)
+	}
 
-		slot := Slot{
-			ID:      bl.Slot.ID,
-			Weekday: bl.Slot.Weekday,
-			Start:   bl.Slot.Start,
-			End:     bl.Slot.End,
-		}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("Could not get bookings").CausedBy(err)
+	}
 
-		br := BookerBookings{
-			BookDate: bl.Bookings.BookDate,
-			Booker:   booker,
-			Slot:     slot,
-		}
+	machines, err := machinesBySlot(slotIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, b := range bookings {
+		bookings[i].Machines = machines[b.Slot.ID]
+	}
+
+	return &bookings, nil
+}
+
+// machinesBySlot will return the machines of all slots with passed ids mapped
+// by slot id
+func machinesBySlot(slotIDs []int) (map[int][]Machine, *errors.LaundryError) {
+	var bySlot = make(map[int][]Machine)
 
-		bookings[bl.Bookings] = br
-		machines[bl.Bookings] = append(machines[bl.Bookings], machine)
+	if len(slotIDs) == 0 {
+		return bySlot, nil
 	}
 
-	var retBookings []BookerBookings
+	var ids []interface{}
+	for _, id := range slotIDs {
+		ids = append(ids, id)
+	}
+
+	db := database.GetGoqu()
+
+	var rows []struct {
+		Machine
+		SlotID int `db:"id_slots"`
+	}
+
+	err := db.From("machines").
+		Select("machines.*", "slots_machines.id_slots").
+		InnerJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_machines").Eq(goqu.I("machines.id")))).
+		Where(
+			goqu.I("slots_machines.id_slots").In(ids...),
+		).
+		Order(goqu.I("machines.id").Asc()).
+		ScanStructs(&rows)
+
+	if err != nil {
+		return nil, errors.New("Could not get machines").CausedBy(err)
+	}
+
+	faulty, fErr := faultyMachines()
+	if fErr != nil {
+		return nil, fErr
+	}
+
+	for _, row := range rows {
+		bySlot[row.SlotID] = append(bySlot[row.SlotID], row.Machine)
+	}
 
-	for k, v := range machines {
-		bk, _ := bookings[k]
-		bk.Machines = v
-		bookings[k] = bk
+	for slotID := range bySlot {
+		markFaulty(bySlot[slotID], faulty)
+	}
+
+	return bySlot, nil
+}
+
+// prefixedColumns returns a select expression for each database column in the
+// struct where the column is aliased with the table name as prefix, i.e.
+// `booker`.`id` AS `booker.id`.
+func prefixedColumns(table string, i interface{}) []interface{} {
+	var columns []interface{}
+
+	t := reflect.TypeOf(i)
+	for n := 0; n < t.NumField(); n++ {
+		column := t.Field(n).Tag.Get("db")
+		if column == "" || column == "-" {
+			continue
+		}
 
-		retBookings = append(retBookings, bookings[k])
+		columns = append(columns, goqu.L(fmt.Sprintf("`%s`.`%s` AS `%s.%s`", table, column, table, column)))
 	}
 
-	return &retBookings, nil
+	return columns
 }
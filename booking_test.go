@@ -0,0 +1,141 @@
+package laundry
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCurrentBooking(t *testing.T) {
+	Convey("Given bookings in the morning and over midnight", t, func() {
+		config.SetConfig(&config.Configuration{TimeZone: "Europe/Stockholm"})
+
+		stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+		bookings := []BookerBookings{
+			{ID: 1, BookDate: date("2018-05-07"), Slot: Slot{Start: "07:00:00", End: "10:00:00"}},
+			{ID: 2, BookDate: date("2018-05-07"), Slot: Slot{Start: "22:00:00", End: "01:00:00"}},
+		}
+
+		Convey("A booking is current during the slot and the grace period", func() {
+			at := time.Date(2018, 5, 7, 6, 50, 0, 0, stockholm)
+
+			So(currentBooking(bookings, at, 10*time.Minute).ID, ShouldEqual, 1)
+			So(currentBooking(bookings, at, 5*time.Minute), ShouldBeNil)
+			So(currentBooking(bookings, at.Add(3*time.Hour+19*time.Minute), 10*time.Minute).ID, ShouldEqual, 1)
+			So(currentBooking(bookings, at.Add(3*time.Hour+20*time.Minute), 10*time.Minute), ShouldBeNil)
+		})
+
+		Convey("A booking over midnight is current the day after", func() {
+			at := time.Date(2018, 5, 8, 0, 30, 0, 0, stockholm)
+
+			So(currentBooking(bookings, at, 0).ID, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestValidationErrors(t *testing.T) {
+	Convey("Given errors from booking", t, func() {
+		Convey("Rejected bookings are validation errors", func() {
+			So(isValidationError(errors.New("Cannot book a slot in the past")), ShouldBeTrue)
+			So(isValidationError(errors.New("Slot is already booked").WithStatus(http.StatusConflict)), ShouldBeTrue)
+			So(isValidationError(errors.New("Booker is blocked").WithStatus(http.StatusForbidden)), ShouldBeTrue)
+		})
+
+		Convey("Failing queries are not", func() {
+			So(isValidationError(errors.New("Could not get bookings").CausedBy(sql.ErrConnDone)), ShouldBeFalse)
+			So(isValidationError(errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError)), ShouldBeFalse)
+		})
+	})
+}
+
+func TestAddBookingConcurrently(t *testing.T) {
+	if os.Getenv("LAUNDRY_DSN") == "" {
+		t.Skip("LAUNDRY_DSN not set, skipping test against the database")
+	}
+
+	Convey("Given many bookers booking the same slot at once", t, func() {
+		config.SetConfig(&config.Configuration{
+			TimeZone: "Europe/Stockholm",
+			Database: config.Database{PoolSize: 1},
+		})
+		database.SetupConnection(config.GetConfig().Database)
+
+		p, err := AddProperty(&Property{Name: "Concurrency test"})
+		So(err, ShouldBeNil)
+
+		defer RemoveProperty(p)
+
+		r, err := AddRoom(&Room{PropertyID: p.ID, Name: "Laundry room"})
+		So(err, ShouldBeNil)
+
+		date := today().AddDate(0, 0, 7)
+
+		ss, err := AddSlotSet(&SlotSet{RoomID: r.ID, Name: "Concurrency test", ValidFrom: date})
+		So(err, ShouldBeNil)
+
+		slot, err := AddSlot(&Slot{
+			SetID:   NullInt64{sql.NullInt64{Int64: int64(ss.ID), Valid: true}},
+			Weekday: int(date.Weekday()),
+			Start:   "10:00:00",
+			End:     "13:00:00",
+		})
+		So(err, ShouldBeNil)
+
+		const bookers = 20
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			booked  int
+			errs    []*errors.LaundryError
+			pending = make(chan struct{})
+		)
+
+		for i := 0; i < bookers; i++ {
+			b, err := AddBooker(&Booker{PropertyID: p.ID, Identifier: fmt.Sprintf("%d", 1001+i)})
+			So(err, ShouldBeNil)
+
+			wg.Add(1)
+
+			go func(bookerID int) {
+				defer wg.Done()
+
+				// Start all bookings at the same time
+				<-pending
+
+				_, err := AddBooking(&Bookings{BookDate: date, SlotID: slot.ID, BookerID: bookerID})
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					errs = append(errs, err)
+					return
+				}
+
+				booked++
+			}(b.ID)
+		}
+
+		close(pending)
+		wg.Wait()
+
+		// Only one booking is created and the others conflict
+		So(booked, ShouldEqual, 1)
+		So(errs, ShouldHaveLength, bookers-1)
+
+		for _, err := range errs {
+			So(err.Status, ShouldEqual, http.StatusConflict)
+		}
+	})
+}
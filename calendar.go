@@ -0,0 +1,302 @@
+package laundry
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/ical"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// calendarProdID is the product identifier used in all calendars
+const calendarProdID = "-//bombsimon//laundry//EN"
+
+// ResetCalendarToken will create a new secret token used to subscribe to the
+// calendar of a booker. Any previous token will stop working.
+func ResetCalendarToken(b *Booker) (string, *errors.LaundryError) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.New("Could not create token").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	token := hex.EncodeToString(secret)
+
+	db := database.GetGoqu()
+
+	update := db.From("booker").
+		Where(goqu.Ex{
+			"id": b.ID,
+		}).
+		Update(goqu.Record{
+			"calendar_token": token,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return "", errors.New("Could not update booker with ID %d", b.ID).CausedBy(err)
+	}
+
+	b.CalendarToken.String, b.CalendarToken.Valid = token, true
+
+	return token, nil
+}
+
+// ValidCalendarToken returns an error unless the token is the calendar token
+// of the booker
+func ValidCalendarToken(b *Booker, token string) *errors.LaundryError {
+	if !b.CalendarToken.Valid || token == "" {
+		return errors.New("Invalid calendar token").WithStatus(http.StatusUnauthorized)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(b.CalendarToken.String), []byte(token)) != 1 {
+		return errors.New("Invalid calendar token").WithStatus(http.StatusUnauthorized)
+	}
+
+	return nil
+}
+
+// BookerCalendar will return a calendar with all future bookings for a
+// booker. Each booking has an alarm for each notification on the booking.
+func BookerCalendar(b *Booker) (*ical.Calendar, *errors.LaundryError) {
+	bookings, err := GetBookerBookings(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, bb := range *bookings {
+		ids = append(ids, bb.ID)
+	}
+
+	notifications, err := bookingNotifications(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookerCalendar(*bookings, notifications), nil
+}
+
+// bookerCalendar will create a calendar with one event per booking
+func bookerCalendar(bookings []BookerBookings, notifications map[int][]Notification) *ical.Calendar {
+	c := ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   "Laundry",
+	}
+
+	for _, b := range bookings {
+		var machines []string
+		for _, m := range b.Machines {
+			machines = append(machines, m.Info)
+		}
+
+		e := ical.Event{
+			UID:         fmt.Sprintf("booking-%d@laundry", b.ID),
+			Start:       b.Slot.StartsAt(b.BookDate),
+			End:         b.Slot.EndsAt(b.BookDate),
+			Summary:     "Laundry",
+			Description: strings.Join(machines, ", "),
+		}
+
+		for _, n := range notifications[b.ID] {
+			e.Alarms = append(e.Alarms, ical.Alarm{
+				Before: time.Duration(n.Ahead) * time.Minute,
+			})
+		}
+
+		c.Events = append(c.Events, e)
+	}
+
+	return &c
+}
+
+// RoomCalendar will return a calendar with all slots held in a room between
+// start and end. The summary of each event tells if the slot is free, closed
+// or who booked it.
+func RoomCalendar(start, end string, roomID int) (*ical.Calendar, *errors.LaundryError) {
+	room, err := GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := GetIntervalSchedule(start, end, ScheduleFilter{RoomID: room.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	c := roomCalendar(scheduleDays(schedule, Caller{Admin: true}))
+	c.Name = room.Name
+
+	return c, nil
+}
+
+// roomCalendar will create a calendar with one event per slot and day
+func roomCalendar(days []ScheduleDay) *ical.Calendar {
+	c := ical.Calendar{
+		ProdID:   calendarProdID,
+		TimeZone: buildingLocation().String(),
+	}
+
+	for _, d := range days {
+		for _, s := range d.Slots {
+			summary := "Free"
+
+			switch s.Status {
+			case SlotClosed:
+				summary = "Closed"
+			case SlotBooked, SlotMine:
+				summary = fmt.Sprintf("Booked by %s", s.Booker.Identifier)
+
+				if s.Booker.Name.Valid {
+					summary = fmt.Sprintf("%s (%s)", summary, s.Booker.Name.String)
+				}
+			}
+
+			var machines []string
+			for _, m := range s.Machines {
+				machines = append(machines, m.Info)
+			}
+
+			c.Events = append(c.Events, ical.Event{
+				UID:         fmt.Sprintf("slot-%d-%s@laundry", s.ID, d.Date),
+				Start:       s.StartsAt,
+				End:         s.EndsAt,
+				Summary:     summary,
+				Description: strings.Join(machines, ", "),
+			})
+		}
+	}
+
+	return &c
+}
+
+// ImportClosures will read a calendar from r and close the room at all dates
+// covered by any event in the calendar. Events already imported with the same
+// dates and description will be ignored. Either all closures are created or
+// none. The created closures are returned.
+func ImportClosures(roomID int, r io.Reader) ([]SlotOverride, *errors.LaundryError) {
+	c, dErr := ical.Decode(r, buildingLocation())
+	if dErr != nil {
+		return nil, errors.New("Invalid calendar").WithStatus(http.StatusBadRequest).CausedBy(dErr)
+	}
+
+	existing, err := GetSlotOverrides(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var created = []SlotOverride{}
+
+	for _, o := range closuresFromCalendar(roomID, c) {
+		if hasClosure(existing, o) {
+			continue
+		}
+
+		if err := validSlotOverride(&o); err != nil {
+			return nil, err
+		}
+
+		created = append(created, o)
+		existing = append(existing, o)
+	}
+
+	tx, tErr := database.GetGoqu().Begin()
+	if tErr != nil {
+		return nil, errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(tErr)
+	}
+
+	if err := addClosures(tx, created); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if cErr := tx.Commit(); cErr != nil {
+		return nil, errors.New("Could not commit import of closures").WithStatus(http.StatusInternalServerError).CausedBy(cErr)
+	}
+
+	return created, nil
+}
+
+// addClosures will create each closure within the transaction
+func addClosures(tx *goqu.TxDatabase, closures []SlotOverride) *errors.LaundryError {
+	for i, o := range closures {
+		insert := tx.From("slot_overrides").Insert(goqu.Record{
+			"id_rooms":    o.RoomID,
+			"kind":        string(o.Kind),
+			"start_date":  o.Start.Format("2006-01-02"),
+			"end_date":    o.End.Format("2006-01-02"),
+			"description": o.Description,
+		})
+
+		row, err := insert.Exec()
+		if err != nil {
+			return errors.New("Could not create closure").CausedBy(err)
+		}
+
+		lastID, err := row.LastInsertId()
+		if err != nil {
+			return errors.New(err)
+		}
+
+		closures[i].ID = int(lastID)
+	}
+
+	return nil
+}
+
+// closuresFromCalendar will create a room closure for each event. All dates
+// where the event is held in the building time zone are closed.
+func closuresFromCalendar(roomID int, c *ical.Calendar) []SlotOverride {
+	var closures []SlotOverride
+
+	loc := buildingLocation()
+
+	for _, e := range c.Events {
+		start := civilDate(e.Start.In(loc))
+		end := civilDate(e.End.In(loc))
+
+		// Events ending at midnight, such as all day events, ends the day before
+		if end.After(start) && e.End.Equal(atClock(end, 0)) {
+			end = end.AddDate(0, 0, -1)
+		}
+
+		o := SlotOverride{
+			RoomID: roomID,
+			Kind:   OverrideClosed,
+			Start:  start,
+			End:    end,
+		}
+
+		if e.Summary != "" {
+			o.Description.String, o.Description.Valid = e.Summary, true
+		}
+
+		closures = append(closures, o)
+	}
+
+	return closures
+}
+
+// hasClosure returns true if any override is a room closure at the same
+// dates and with the same description as o
+func hasClosure(overrides []SlotOverride, o SlotOverride) bool {
+	for _, existing := range overrides {
+		if existing.Kind != OverrideClosed || existing.SlotID.Valid {
+			continue
+		}
+
+		if existing.Start.Equal(o.Start) && existing.End.Equal(o.End) && existing.Description == o.Description {
+			return true
+		}
+	}
+
+	return false
+}
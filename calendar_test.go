@@ -0,0 +1,122 @@
+package laundry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/ical"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBookerCalendar(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "Europe/Stockholm"})
+
+	Convey("Given bookings with notifications", t, func() {
+		bookings := []BookerBookings{
+			{
+				ID:       1,
+				BookDate: date("2018-05-07"),
+				Slot:     Slot{ID: 1, Weekday: 1, Start: "20:00:00", End: "01:00:00"},
+				Machines: []Machine{{ID: 1, Info: "Washer 1"}, {ID: 2, Info: "Dryer 1"}},
+			},
+			{
+				ID:       2,
+				BookDate: date("2018-05-14"),
+				Slot:     Slot{ID: 1, Weekday: 1, Start: "20:00:00", End: "01:00:00"},
+			},
+		}
+
+		notifications := map[int][]Notification{
+			1: {{BookingID: 1, Ahead: 30}, {BookingID: 1, Ahead: 120}},
+		}
+
+		c := bookerCalendar(bookings, notifications)
+
+		Convey("Each booking is an event at the slot time", func() {
+			So(len(c.Events), ShouldEqual, 2)
+			So(c.Events[0].UID, ShouldEqual, "booking-1@laundry")
+			So(c.Events[0].Start.UTC(), ShouldResemble, time.Date(2018, 5, 7, 18, 0, 0, 0, time.UTC))
+			So(c.Events[0].End.UTC(), ShouldResemble, time.Date(2018, 5, 7, 23, 0, 0, 0, time.UTC))
+			So(c.Events[0].Description, ShouldEqual, "Washer 1, Dryer 1")
+		})
+
+		Convey("Alarms matches the notifications of the booking", func() {
+			So(len(c.Events[0].Alarms), ShouldEqual, 2)
+			So(c.Events[0].Alarms[1].Before, ShouldEqual, 2*time.Hour)
+			So(c.Events[1].Alarms, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestClosuresFromCalendar(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "Europe/Stockholm"})
+
+	Convey("Given a calendar with holidays", t, func() {
+		stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+		c := &ical.Calendar{
+			Events: []ical.Event{
+				{
+					Summary: "Christmas",
+					AllDay:  true,
+					Start:   time.Date(2018, 12, 24, 0, 0, 0, 0, stockholm),
+					End:     time.Date(2018, 12, 27, 0, 0, 0, 0, stockholm),
+				},
+				{
+					Summary: "Cleaning",
+					Start:   time.Date(2018, 5, 6, 22, 30, 0, 0, time.UTC),
+					End:     time.Date(2018, 5, 7, 2, 0, 0, 0, time.UTC),
+				},
+			},
+		}
+
+		closures := closuresFromCalendar(1, c)
+
+		Convey("All day events closes all days in the event", func() {
+			So(closures[0].Kind, ShouldEqual, OverrideClosed)
+			So(closures[0].Start, ShouldResemble, date("2018-12-24"))
+			So(closures[0].End, ShouldResemble, date("2018-12-26"))
+			So(closures[0].Description.String, ShouldEqual, "Christmas")
+		})
+
+		Convey("Timed events closes the dates in the building time zone", func() {
+			So(closures[1].Start, ShouldResemble, date("2018-05-07"))
+			So(closures[1].End, ShouldResemble, date("2018-05-07"))
+		})
+
+		Convey("Already imported closures are detected", func() {
+			So(hasClosure(closures, closures[0]), ShouldBeTrue)
+			So(hasClosure(closures[1:], closures[0]), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRoomCalendar(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "UTC"})
+
+	Convey("Given a schedule", t, func() {
+		booker := Booker{ID: 1, Identifier: "1001"}
+
+		days := []ScheduleDay{
+			{
+				Date: "2018-05-07",
+				Slots: []ScheduleSlot{
+					{ID: 1, Status: SlotFree},
+					{ID: 2, Status: SlotBooked, Booker: &booker},
+					{ID: 3, Status: SlotClosed},
+				},
+			},
+		}
+
+		c := roomCalendar(days)
+
+		Convey("Each slot is an event telling it's status", func() {
+			So(len(c.Events), ShouldEqual, 3)
+			So(c.Events[0].Summary, ShouldEqual, "Free")
+			So(c.Events[1].Summary, ShouldEqual, "Booked by 1001")
+			So(c.Events[1].UID, ShouldEqual, "slot-2-2018-05-07@laundry")
+			So(c.Events[2].Summary, ShouldEqual, "Closed")
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// CheckInSource represents how a booker checked in to a booking
+type CheckInSource string
+
+// The ways a booker may check in to a booking
+const (
+	CheckInAPI CheckInSource = "api"
+	CheckInPin CheckInSource = "pin"
+	CheckInTag CheckInSource = "tag"
+)
+
+// CheckIn represents a booker showing up for a booking
+type CheckIn struct {
+	ID          int           `db:"id"            json:"id"`
+	BookingID   int           `db:"id_bookings"   json:"booking_id"`
+	CheckedInAt time.Time     `db:"checked_in_at" json:"checked_in_at"`
+	Source      CheckInSource `db:"source"        json:"source"`
+}
+
+// GetCheckIn will return the check in for a booking. If the booker hasn't
+// checked in nil is returned.
+func GetCheckIn(bookingID int) (*CheckIn, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var c CheckIn
+	found, err := db.From("check_ins").Where(goqu.Ex{
+		"id_bookings": bookingID,
+	}).ScanStruct(&c)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+// AddCheckIn will check in to a booking. Checking in again keeps the first
+// check in which is returned.
+func AddCheckIn(bookingID int, source CheckInSource, at time.Time) (*CheckIn, *errors.LaundryError) {
+	if _, err := GetBooking(bookingID); err != nil {
+		return nil, err
+	}
+
+	existing, err := GetCheckIn(bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return existing, nil
+	}
+
+	c := CheckIn{
+		BookingID:   bookingID,
+		CheckedInAt: at,
+		Source:      source,
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("check_ins").Insert(goqu.Record{
+		"id_bookings":   c.BookingID,
+		"checked_in_at": c.CheckedInAt,
+		"source":        string(c.Source),
+	})
+
+	row, iErr := insert.Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not check in to booking with id %d", bookingID).CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	c.ID = int(lastID)
+
+	return &c, nil
+}
+
+// CheckInToBooking will check in to a booking at the given time. Checking in is
+// only possible from grace before the slot starts until it ends.
+func CheckInToBooking(bookingID int, source CheckInSource, at time.Time, grace time.Duration) (*CheckIn, *errors.LaundryError) {
+	b, err := GetBooking(bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := GetSlot(b.SlotID)
+	if err != nil {
+		return nil, err
+	}
+
+	if at.Before(slot.StartsAt(b.BookDate).Add(-grace)) || !at.Before(slot.EndsAt(b.BookDate)) {
+		return nil, errors.New("Booking with id %d is not held now", bookingID).WithStatus(http.StatusConflict)
+	}
+
+	return AddCheckIn(bookingID, source, at)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/admin"
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	app = kingpin.New("laundry-admin", "Administration of the laundry service")
+
+	configFile = app.Flag("config-file", "Path to configuration file").Envar("LAUNDRY_CONFIG_FILE").String()
+	output     = app.Flag("output", "Write to the database or print as SQL or JSON").Default("db").Enum("db", "sql", "json")
+
+	timetable         = app.Command("timetable", "Generate a weekly slot timetable")
+	timetableRoom     = timetable.Flag("room", "Room to add slots to").Required().Int()
+	timetableSet      = timetable.Flag("set", "Existing slot set to add slots to").Int()
+	timetableName     = timetable.Flag("name", "Name of the new slot set").Default("Default").String()
+	timetableFrom     = timetable.Flag("valid-from", "First date of the new slot set (YYYY-MM-DD)").Default(time.Now().Format("2006-01-02")).String()
+	timetableMachines = timetable.Flag("machine", "Machine to attach to each slot, may be repeated").Ints()
+	timetableSpecs    = timetable.Arg("spec", "Days, opening hours and slot length such as 'mon-fri 07:00-22:00 3h'").Required().Strings()
+
+	machines         = app.Command("machines", "Create machines")
+	machinesRoom     = machines.Flag("room", "Room to add machines to").Required().Int()
+	machinesType     = machines.Flag("type", "Type of machine").Required().Enum(machineTypes()...)
+	machinesCount    = machines.Flag("count", "Number of machines").Default("1").Int()
+	machinesFirst    = machines.Flag("first", "Number of the first machine").Default("1").Int()
+	machinesCapacity = machines.Flag("capacity", "Capacity in kilograms").Default("0").Float64()
+	machinesInfo     = machines.Arg("info", "Info line, %d is replaced with the number of the machine").Required().String()
+
+	attach         = app.Command("attach", "Attach machines to slots")
+	attachSet      = attach.Flag("set", "Attach to all slots in slot set").Int()
+	attachSlots    = attach.Flag("slot", "Slot to attach to, may be repeated").Ints()
+	attachMachines = attach.Arg("machine", "Machines to attach").Required().Ints()
+
+	apartments         = app.Command("apartments", "Create a booker for each apartment")
+	apartmentsProperty = apartments.Flag("property", "Property to add bookers to").Required().Int()
+	apartmentsPattern  = apartments.Arg("apartments", "Apartments or ranges such as '1001-1012,1101-1112'").Required().String()
+
+	backup     = app.Command("backup", "Write all data to a JSON archive")
+	backupFile = backup.Flag("file", "Write to file instead of stdout").String()
+
+	restore     = app.Command("restore", "Restore all data from a JSON archive to an empty database")
+	restoreFile = restore.Arg("file", "Archive to restore").Required().ExistingFile()
+)
+
+func main() {
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	var (
+		data admin.BaseData
+		err  error
+	)
+
+	switch command {
+	case backup.FullCommand():
+		app.FatalIfError(backupArchive(), "")
+		return
+	case restore.FullCommand():
+		app.FatalIfError(restoreArchive(), "")
+		return
+	case timetable.FullCommand():
+		err = generateTimetable(&data)
+	case machines.FullCommand():
+		data.Machines = admin.Machines(*machinesRoom, laundry.MachineType(*machinesType), *machinesCount, *machinesFirst, *machinesInfo, *machinesCapacity)
+	case attach.FullCommand():
+		if *attachSet == 0 && len(*attachSlots) == 0 {
+			app.Fatalf("either --set or --slot is required")
+		}
+
+		data.Attachments = []admin.Attachment{
+			{SetID: *attachSet, SlotIDs: *attachSlots, MachineIDs: *attachMachines},
+		}
+	case apartments.FullCommand():
+		err = generateApartments(&data)
+	}
+
+	app.FatalIfError(err, "")
+
+	switch *output {
+	case "sql":
+		err = data.WriteSQL(os.Stdout)
+	case "json":
+		err = data.WriteJSON(os.Stdout)
+	default:
+		err = save(&data)
+	}
+
+	app.FatalIfError(err, "")
+}
+
+// generateTimetable will add slots for all specs to a new or existing slot set
+func generateTimetable(data *admin.BaseData) error {
+	var specs []admin.TimetableSpec
+
+	for _, s := range *timetableSpecs {
+		spec, err := admin.ParseTimetableSpec(s)
+		if err != nil {
+			return err
+		}
+
+		specs = append(specs, spec)
+	}
+
+	slots, err := admin.Timetable(specs)
+	if err != nil {
+		return err
+	}
+
+	data.SlotSet = &laundry.SlotSet{
+		ID:     *timetableSet,
+		RoomID: *timetableRoom,
+		Name:   *timetableName,
+	}
+
+	if *timetableSet == 0 {
+		validFrom, err := time.Parse("2006-01-02", *timetableFrom)
+		if err != nil {
+			return fmt.Errorf("invalid valid from date '%s'", *timetableFrom)
+		}
+
+		data.SlotSet.ValidFrom = validFrom
+	}
+
+	for i := range slots {
+		slots[i].RoomID = *timetableRoom
+		slots[i].MachineIDs = *timetableMachines
+	}
+
+	data.Slots = slots
+
+	return nil
+}
+
+// generateApartments will add a booker for each apartment in the pattern
+func generateApartments(data *admin.BaseData) error {
+	identifiers, err := admin.ParseApartments(*apartmentsPattern)
+	if err != nil {
+		return err
+	}
+
+	for _, identifier := range identifiers {
+		data.Bookers = append(data.Bookers, laundry.Booker{
+			PropertyID: *apartmentsProperty,
+			Identifier: identifier,
+		})
+	}
+
+	return nil
+}
+
+// backupArchive will write an archive of all data to a file or stdout
+func backupArchive() error {
+	if err := connect(); err != nil {
+		return err
+	}
+
+	archive, err := admin.Backup()
+	if err != nil {
+		return err
+	}
+
+	if *backupFile == "" {
+		return archive.Write(os.Stdout)
+	}
+
+	// The archive holds the PIN of every booker
+	f, fErr := os.OpenFile(*backupFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if fErr != nil {
+		return fErr
+	}
+
+	if wErr := archive.Write(f); wErr != nil {
+		f.Close()
+		return wErr
+	}
+
+	return f.Close()
+}
+
+// restoreArchive will restore an archive to an empty database
+func restoreArchive() error {
+	f, err := os.Open(*restoreFile)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	archive, err := admin.ReadArchive(f)
+	if err != nil {
+		return err
+	}
+
+	if err := connect(); err != nil {
+		return err
+	}
+
+	if err := archive.Restore(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// connect will read the configuration and connect to the database
+func connect() error {
+	cfg, err := config.New(*configFile)
+	if err != nil {
+		return err
+	}
+
+	config.SetConfig(cfg)
+	database.SetupConnection(cfg.Database)
+
+	return nil
+}
+
+// save will connect to the database and write the data, printing what was
+// created as JSON
+func save(data *admin.BaseData) error {
+	if err := connect(); err != nil {
+		return err
+	}
+
+	if err := data.Save(); err != nil {
+		return err
+	}
+
+	return data.WriteJSON(os.Stdout)
+}
+
+// machineTypes returns the name of all machine types
+func machineTypes() []string {
+	var types []string
+	for _, t := range laundry.MachineTypes {
+		types = append(types, string(t))
+	}
+
+	return types
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/bombsimon/laundry"
 	"github.com/bombsimon/laundry/api"
 	"github.com/bombsimon/laundry/config"
 	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/lock"
 	"github.com/bombsimon/laundry/log"
 	"github.com/bombsimon/laundry/middleware"
 
@@ -28,53 +31,169 @@ func main() {
 		os.Exit(255)
 	}
 
+	config.SetConfig(cfg)
 	database.SetupConnection(cfg.Database)
-	api := api.New()
+	lk, lErr := lock.New(cfg.Lock)
+	if lErr != nil {
+		log.GetLogger().Fatalf("Could not setup lock: %s", lErr)
+		os.Exit(255)
+	}
+
+	api := api.New(lk)
+
+	// Log released slots, pass them to the waitlist and release bookings
+	// nobody checked in to
+	laundry.OnRelease(func(rel laundry.Release) {
+		log.GetLogger().Infof("Slot %d at %s released (%s)", rel.Slot.ID, rel.BookDate.Format("2006-01-02"), rel.Reason)
+	})
+	laundry.OnRelease(laundry.WaitlistRelease)
+
+	// Log swap requests and answers, bookers find their pending requests at
+	// /bookers/{id}/swaps
+	laundry.OnSwap(func(s laundry.Swap) {
+		log.GetLogger().Infof("Swap %d of booking %d and %d between booker %d and %d %s", s.ID, s.FromBookingID, s.ToBookingID, s.FromBookerID, s.ToBookerID, s.Status)
+	})
+
+	go laundry.WatchNoShows(time.Minute)
+	go laundry.WatchWaitlist(time.Minute)
+	go laundry.SweepHolds(10 * time.Second)
+	go laundry.WatchSeries(time.Hour)
 
 	r := mux.NewRouter()
 	v1 := r.PathPrefix("/v1").Subrouter()
 
+	// Properties
+	v1.HandleFunc("/properties", api.GetProperties).Name("get_properties").Methods("GET")
+	v1.HandleFunc("/properties", api.AddProperty).Name("add_property").Methods("POST")
+	v1.HandleFunc("/properties/{id:[0-9]+}", api.GetProperty).Name("get_property").Methods("GET")
+	v1.HandleFunc("/properties/{id:[0-9]+}", api.UpdateProperty).Name("update_property").Methods("PUT")
+	v1.HandleFunc("/properties/{id:[0-9]+}", api.RemoveProperty).Name("remove_property").Methods("DELETE")
+	v1.HandleFunc("/properties/{property:[0-9]+}/rooms", api.GetRooms).Name("get_property_rooms").Methods("GET")
+	v1.HandleFunc("/properties/{property:[0-9]+}/rooms", api.AddRoom).Name("add_property_room").Methods("POST")
+	v1.HandleFunc("/properties/{property:[0-9]+}/bookers", api.GetBookers).Name("get_property_bookers").Methods("GET")
+	v1.HandleFunc("/properties/{property:[0-9]+}/bookers", api.AddBooker).Name("add_property_booker").Methods("POST")
+	v1.HandleFunc("/properties/{property:[0-9]+}/bookers/import", api.ImportBookers).Name("import_property_bookers").Methods("POST")
+	v1.HandleFunc("/properties/{property:[0-9]+}/bookers/export.csv", api.ExportBookers).Name("export_property_bookers").Methods("GET")
+
+	// Rooms
+	v1.HandleFunc("/rooms/{id:[0-9]+}", api.GetRoom).Name("get_room").Methods("GET")
+	v1.HandleFunc("/rooms/{id:[0-9]+}", api.UpdateRoom).Name("update_room").Methods("PUT")
+	v1.HandleFunc("/rooms/{id:[0-9]+}", api.RemoveRoom).Name("remove_room").Methods("DELETE")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/machines", api.GetMachines).Name("get_room_machines").Methods("GET")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/machines", api.AddMachine).Name("add_room_machine").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/slots", api.GetSlots).Name("get_room_slots").Methods("GET")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/slots", api.AddSlot).Name("add_room_slot").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/slot-sets", api.GetSlotSets).Name("get_room_slot_sets").Methods("GET")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/slot-sets", api.AddSlotSet).Name("add_room_slot_set").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/overrides", api.GetSlotOverrides).Name("get_room_overrides").Methods("GET")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/overrides", api.AddSlotOverride).Name("add_room_override").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/closures", api.ImportClosures).Name("import_room_closures").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/unlock", api.UnlockRoom).Name("unlock_room").Methods("POST")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/unlock-attempts", api.GetUnlockAttempts).Name("get_room_unlock_attempts").Methods("GET")
+	v1.HandleFunc("/rooms/{room:[0-9]+}/bookings", api.GetBookings).Name("get_room_bookings").Methods("GET")
+	v1.HandleFunc(`/rooms/{room:[0-9]+}/schedule/{start:\d{4}-\d{2}-\d{2}}/{end:\d{4}-\d{2}-\d{2}}`, api.GetSchedule).Name("get_room_schedule").Methods("GET")
+	v1.HandleFunc(`/rooms/{room:[0-9]+}/schedule/{start:\d{4}-\d{2}-\d{2}}/{end:\d{4}-\d{2}-\d{2}}/calendar.ics`, api.GetRoomCalendar).Name("get_room_calendar").Methods("GET")
+
 	// Bookers
-	v1.HandleFunc("/bookers", api.GetBookers).Name("get_bookers").Methods("GET")
 	v1.HandleFunc("/bookers", api.AddBooker).Name("add_booker").Methods("POST")
+	v1.HandleFunc("/bookers/import", api.ImportBookers).Name("import_bookers").Methods("POST")
+	v1.HandleFunc("/bookers/export.csv", api.ExportBookers).Name("export_bookers").Methods("GET")
 	v1.HandleFunc("/bookers/{id:[0-9]+}", api.GetBooker).Name("get_booker").Methods("GET")
 	v1.HandleFunc("/bookers/{id:[0-9]+}", api.UpdateBooker).Name("update_booker").Methods("PUT")
 	v1.HandleFunc("/bookers/{id:[0-9]+}", api.RemoveBooker).Name("remove_booker").Methods("DELETE")
 	v1.HandleFunc("/bookers/{id:[0-9]+}/bookings", api.GetBookerBookings).Name("get_booker_bookings").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/export", api.ExportBooker).Name("export_booker").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/calendar.ics", api.GetBookerCalendar).Name("get_booker_calendar").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/calendar-token", api.ResetCalendarToken).Name("reset_booker_calendar_token").Methods("POST")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/tags", api.GetBookerTags).Name("get_booker_tags").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/tags", api.AddBookerTag).Name("add_booker_tag").Methods("POST")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/no-shows", api.GetBookerNoShows).Name("get_booker_no_shows").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/standing", api.GetBookerStanding).Name("get_booker_standing").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/swaps", api.GetBookerSwaps).Name("get_booker_swaps").Methods("GET")
+	v1.HandleFunc("/bookers/{id:[0-9]+}/series", api.GetBookerSeries).Name("get_booker_series").Methods("GET")
+
+	// Access
+	v1.HandleFunc("/tags/{id:[0-9]+}", api.RemoveTag).Name("remove_tag").Methods("DELETE")
+	v1.HandleFunc("/access/tag", api.TagAccess).Name("tag_access").Methods("POST")
+	v1.HandleFunc("/access/pin", api.PinAccess).Name("pin_access").Methods("POST")
 
 	// Machines
-	v1.HandleFunc("/machines", api.GetMachines).Name("get_machines").Methods("GET")
 	v1.HandleFunc("/machines", api.AddMachine).Name("add_machine").Methods("POST")
 	v1.HandleFunc("/machines/{id:[0-9]+}", api.GetMachine).Name("get_machine").Methods("GET")
 	v1.HandleFunc("/machines/{id:[0-9]+}", api.UpdateMachine).Name("update_machine").Methods("PUT")
 	v1.HandleFunc("/machines/{id:[0-9]+}", api.RemoveMachine).Name("remove_machine").Methods("DELETE")
+	v1.HandleFunc("/machines/{id:[0-9]+}/faults", api.GetMachineFaults).Name("get_machine_faults").Methods("GET")
+	v1.HandleFunc("/machines/{id:[0-9]+}/faults", api.ReportFault).Name("report_fault").Methods("POST")
+
+	// Faults
+	v1.HandleFunc("/faults/{id:[0-9]+}", api.GetFault).Name("get_fault").Methods("GET")
+	v1.HandleFunc("/faults/{id:[0-9]+}/acknowledge", api.AcknowledgeFault).Name("acknowledge_fault").Methods("PUT")
+	v1.HandleFunc("/faults/{id:[0-9]+}/resolve", api.ResolveFault).Name("resolve_fault").Methods("PUT")
+
+	// Maintenance
+	v1.HandleFunc("/maintenance", api.GetMaintenanceWindows).Name("get_maintenance_windows").Methods("GET")
+	v1.HandleFunc("/maintenance", api.AddMaintenanceWindow).Name("add_maintenance_window").Methods("POST")
+	v1.HandleFunc("/maintenance/{id:[0-9]+}", api.GetMaintenanceWindow).Name("get_maintenance_window").Methods("GET")
+	v1.HandleFunc("/maintenance/{id:[0-9]+}", api.RemoveMaintenanceWindow).Name("remove_maintenance_window").Methods("DELETE")
 
 	// Slots
-	v1.HandleFunc("/slots", api.GetSlots).Name("get_slots").Methods("GET")
 	v1.HandleFunc("/slots", api.AddSlot).Name("add_slot").Methods("POST")
 	v1.HandleFunc("/slots/{id:[0-9]+}", api.GetSlot).Name("get_slot").Methods("GET")
 	v1.HandleFunc("/slots/{id:[0-9]+}", api.UpdateSlot).Name("update_slot").Methods("PUT")
 	v1.HandleFunc("/slots/{id:[0-9]+}", api.RemoveSlot).Name("remove_slot").Methods("DELETE")
 
+	// Slot sets
+	v1.HandleFunc("/slot-sets/{id:[0-9]+}", api.GetSlotSet).Name("get_slot_set").Methods("GET")
+	v1.HandleFunc("/slot-sets/{id:[0-9]+}", api.UpdateSlotSet).Name("update_slot_set").Methods("PUT")
+	v1.HandleFunc("/slot-sets/{id:[0-9]+}", api.RemoveSlotSet).Name("remove_slot_set").Methods("DELETE")
+	v1.HandleFunc("/slot-sets/{set:[0-9]+}/slots", api.AddSlot).Name("add_slot_set_slot").Methods("POST")
+
+	// Overrides
+	v1.HandleFunc("/overrides", api.GetSlotOverrides).Name("get_overrides").Methods("GET")
+	v1.HandleFunc("/overrides/{id:[0-9]+}", api.GetSlotOverride).Name("get_override").Methods("GET")
+	v1.HandleFunc("/overrides/{id:[0-9]+}", api.RemoveSlotOverride).Name("remove_override").Methods("DELETE")
+
 	// Bookings
-	v1.HandleFunc("/bookings", api.GetBookings).Name("get_bookings").Methods("GET")
 	v1.HandleFunc("/bookings", api.AddBooking).Name("add_booking").Methods("POST")
+	v1.HandleFunc("/bookings/series", api.AddSeries).Name("add_series").Methods("POST")
+	v1.HandleFunc("/bookings/series/{id:[0-9]+}", api.GetSeries).Name("get_series").Methods("GET")
+	v1.HandleFunc("/bookings/series/{id:[0-9]+}", api.CancelSeries).Name("cancel_series").Methods("DELETE")
+	v1.HandleFunc("/bookings/series/{id:[0-9]+}/occurrences/{occurrence:[0-9]+}", api.CancelOccurrence).Name("cancel_series_occurrence").Methods("DELETE")
+	v1.HandleFunc("/bookings/waitlist", api.GetWaitlist).Name("get_waitlist").Methods("GET")
+	v1.HandleFunc("/bookings/waitlist", api.JoinWaitlist).Name("join_waitlist").Methods("POST")
+	v1.HandleFunc("/bookings/waitlist/{id:[0-9]+}", api.LeaveWaitlist).Name("leave_waitlist").Methods("DELETE")
+	v1.HandleFunc("/bookings/waitlist/{id:[0-9]+}/accept", api.AcceptWaitlistOffer).Name("accept_waitlist_offer").Methods("POST")
 	v1.HandleFunc("/bookings/{id:[0-9]+}", api.GetBooking).Name("get_booking").Methods("GET")
 	v1.HandleFunc("/bookings/{id:[0-9]+}", api.UpdateBooking).Name("update_booking").Methods("PUT")
 	v1.HandleFunc("/bookings/{id:[0-9]+}", api.RemoveBooking).Name("remove_booking").Methods("DELETE")
-	v1.HandleFunc("/bookings/{id:[0-9]+}/notifications", api.RemoveBooking).Name("get_booking_notifications").Methods("GET")
+	v1.HandleFunc("/bookings/{id:[0-9]+}/check-in", api.CheckIn).Name("check_in_booking").Methods("POST")
+	v1.HandleFunc("/bookings/{id:[0-9]+}/notifications", api.GetBookingNotifications).Name("get_booking_notifications").Methods("GET")
+	v1.HandleFunc("/bookings/{id:[0-9]+}/swaps", api.RequestSwap).Name("request_swap").Methods("POST")
 
-	// Schedule
-	v1.HandleFunc(`/schedule/{start:\d{4}-\d{2}-\d{2}}/{end:\d{4}-\d{2}-\d{2}}`, api.GetSchedule).Name("get_month_schedule").Methods("GET")
+	// Holds
+	v1.HandleFunc("/holds", api.AddHold).Name("add_hold").Methods("POST")
+	v1.HandleFunc("/holds/{token:[0-9a-f]+}", api.RemoveHold).Name("remove_hold").Methods("DELETE")
+
+	// Swaps
+	v1.HandleFunc("/swaps/{id:[0-9]+}", api.GetSwap).Name("get_swap").Methods("GET")
+	v1.HandleFunc("/swaps/{id:[0-9]+}/accept", api.AcceptSwap).Name("accept_swap").Methods("PUT")
+	v1.HandleFunc("/swaps/{id:[0-9]+}/decline", api.DeclineSwap).Name("decline_swap").Methods("PUT")
+	v1.HandleFunc("/swaps/{id:[0-9]+}/cancel", api.CancelSwap).Name("cancel_swap").Methods("PUT")
 
 	// Notificationos
 
+	// Version 2
+	v2 := r.PathPrefix("/v2").Subrouter()
+
+	v2.HandleFunc(`/rooms/{room:[0-9]+}/schedule/{start:\d{4}-\d{2}-\d{2}}/{end:\d{4}-\d{2}-\d{2}}`, api.GetScheduleV2).Name("get_room_schedule_v2").Methods("GET")
+
 	log.GetLogger().Infof("Serving up at %s...", cfg.HTTP.Listen)
 
 	http.ListenAndServe(
 		cfg.HTTP.Listen,
 		middleware.Adapt(
 			r,
+			middleware.Authenticate(),
 			middleware.Notify(),
 			middleware.Logger(),
 		),
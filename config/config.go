@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/bombsimon/laundry/errors"
 	yaml "gopkg.in/yaml.v2"
@@ -13,6 +14,8 @@ var (
 	configuration *Configuration
 )
 
+// GetConfig will return the configuration set with SetConfig. If no
+// configuration is set the default configuration file will be read.
 func GetConfig() *Configuration {
 	if configuration == nil {
 		c, err := New("")
@@ -26,13 +29,38 @@ func GetConfig() *Configuration {
 	return configuration
 }
 
+// SetConfig will set the configuration returned by GetConfig
+func SetConfig(c *Configuration) {
+	configuration = c
+}
+
 // Configuration represents the full configuration for the laundry service
-// and the laundry RESTful API
+// and the laundry RESTful API. TimeZone is the time zone of the building
+// which all dates and slot times are interpreted in, i.e. "Europe/Stockholm".
 type Configuration struct {
 	Database       Database       `yaml:"database"`
 	HTTP           Http           `yaml:"http"`
 	Bookings       BookingRules   `yaml:"bookings"`
 	Administration Administration `yaml:"administration"`
+	Lock           Lock           `yaml:"lock"`
+	TimeZone       string         `yaml:"time_zone"`
+
+	location *time.Location
+}
+
+// Location returns the time zone of the building. If no time zone is
+// configured or the time zone is invalid UTC will be used.
+func (c *Configuration) Location() *time.Location {
+	if c.location == nil {
+		loc, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		c.location = loc
+	}
+
+	return c.location
 }
 
 // Database represents the database configuration for the laundry service
@@ -52,15 +80,57 @@ type Http struct {
 	Listen string `yaml:"listen"`
 }
 
-// BookingRules represents the rules to be used in the laundry service
+// BookingRules represents the rules to be used in the laundry service.
+// MaxPerDay limits how many bookings a booker may have per day for slots
+// including a given machine type, i.e. "dryer: 1". CheckInMinutes is the number
+// of minutes after a slot starts a booker must check in before the booking is
+// released as a no show, 0 disables the release. WaitlistOfferMinutes is how
+// long a released slot is offered to the first in line on the waitlist when
+// the booker can't be booked right away, 0 passes it to the next in line.
+// MaxHoldSeconds is the longest time a slot may be held while a booker
+// confirms a booking, 0 disables holds. SeriesHorizonDays is how many days
+// ahead occurrences of recurring booking series are booked.
 type BookingRules struct {
-	MaxAllowed      int `yaml:"max_allowed"`
-	MinSlotDuration int `yaml:"min_slot_duration"`
+	MaxAllowed           int            `yaml:"max_allowed"`
+	MinSlotDuration      int            `yaml:"min_slot_duration"`
+	MaxPerDay            map[string]int `yaml:"max_per_day"`
+	CheckInMinutes       int            `yaml:"check_in_minutes"`
+	WaitlistOfferMinutes int            `yaml:"waitlist_offer_minutes"`
+	MaxHoldSeconds       int            `yaml:"max_hold_seconds"`
+	SeriesHorizonDays    int            `yaml:"series_horizon_days"`
+	Penalties            Penalties      `yaml:"penalties"`
+}
+
+// Penalties represents when bookers are blocked from booking. A booker with
+// NoShows no shows during Days days may not book for BlockDays days. Cancelling
+// less than LateCancelHours hours before the slot starts counts as
+// LateCancelWeight no shows, i.e. 0.5. NoShows set to 0 disables penalties.
+type Penalties struct {
+	NoShows          int     `yaml:"no_shows"`
+	Days             int     `yaml:"days"`
+	BlockDays        int     `yaml:"block_days"`
+	LateCancelHours  int     `yaml:"late_cancel_hours"`
+	LateCancelWeight float64 `yaml:"late_cancel_weight"`
 }
 
-// Administration represents administration information for the laundry service
+// Administration represents administration information for the laundry service.
+// Token is the bearer token used to authenticate as an administrator.
 type Administration struct {
 	SupportEmail string `yaml:"support_email"`
+	Token        string `yaml:"token"`
+}
+
+// Lock represents the door lock of the laundry rooms. Driver is either
+// "webhook", which calls URL with Secret as bearer token, or "simulator". The
+// door is unlocked from Grace minutes before a booked slot starts until Grace
+// minutes after it ends. Without a driver the door can't be unlocked.
+// ReaderToken is the bearer token used by RFID tag readers.
+type Lock struct {
+	Driver      string `yaml:"driver"`
+	URL         string `yaml:"url"`
+	Secret      string `yaml:"secret"`
+	Grace       int    `yaml:"grace"`
+	ReaderToken string `yaml:"reader_token"`
 }
 
 // New will create a new configuration based on a YAML file.
@@ -83,6 +153,13 @@ func New(configFile string) (*Configuration, error) {
 
 	readEnvironment(&c)
 
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, errors.New("Invalid time zone '%s'", c.TimeZone).WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	c.location = loc
+
 	return &c, nil
 }
 
@@ -90,4 +167,16 @@ func readEnvironment(c *Configuration) {
 	if os.Getenv("LAUNDRY_HTTP_LISTEN") != "" {
 		c.HTTP.Listen = os.Getenv("LAUNDRY_HTTP_LISTEN")
 	}
+
+	if os.Getenv("LAUNDRY_ADMIN_TOKEN") != "" {
+		c.Administration.Token = os.Getenv("LAUNDRY_ADMIN_TOKEN")
+	}
+
+	if os.Getenv("LAUNDRY_READER_TOKEN") != "" {
+		c.Lock.ReaderToken = os.Getenv("LAUNDRY_READER_TOKEN")
+	}
+
+	if os.Getenv("LAUNDRY_TIME_ZONE") != "" {
+		c.TimeZone = os.Getenv("LAUNDRY_TIME_ZONE")
+	}
 }
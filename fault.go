@@ -0,0 +1,248 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// FaultStatus represents the state of a reported fault
+type FaultStatus string
+
+// The different states a fault moves through, from being reported by a
+// resident until an administrator has resolved it.
+const (
+	FaultReported     FaultStatus = "reported"
+	FaultAcknowledged FaultStatus = "acknowledged"
+	FaultResolved     FaultStatus = "resolved"
+)
+
+// Fault represents a fault reported on a Machine
+type Fault struct {
+	ID             int         `db:"id"              json:"id"`
+	MachineID      int         `db:"id_machines"     json:"machine_id"`
+	BookerID       NullInt64   `db:"id_booker"       json:"booker_id"`
+	Description    string      `db:"description"     json:"description"`
+	Status         FaultStatus `db:"status"          json:"status"`
+	ReportedAt     time.Time   `db:"reported_at"     json:"reported_at"`
+	AcknowledgedAt NullTime    `db:"acknowledged_at" json:"acknowledged_at"`
+	ResolvedAt     NullTime    `db:"resolved_at"     json:"resolved_at"`
+}
+
+// GetMachineFaults will return the fault history for a Machine, the most
+// recently reported fault first.
+func GetMachineFaults(machineID int) ([]Fault, *errors.LaundryError) {
+	if _, err := GetMachine(machineID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var faults []Fault
+	err := db.From("machine_faults").
+		Where(goqu.Ex{
+			"id_machines": machineID,
+		}).
+		Order(goqu.I("reported_at").Desc()).
+		ScanStructs(&faults)
+
+	if err != nil {
+		return faults, errors.New("Could not get faults").CausedBy(err)
+	}
+
+	return faults, nil
+}
+
+// GetFault will return the Fault with passed ID if it exists in the database.
+func GetFault(id int) (*Fault, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var f Fault
+	found, err := db.From("machine_faults").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&f)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Fault with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &f, nil
+}
+
+// ReportFault will add a new fault for the Machine with passed ID. A reported
+// fault marks the machine as not working until all faults are resolved.
+func ReportFault(machineID int, f *Fault) (*Fault, *errors.LaundryError) {
+	if f.Description == "" {
+		return nil, errors.New("Missing description in request").WithStatus(http.StatusBadRequest)
+	}
+
+	if _, err := GetMachine(machineID); err != nil {
+		return nil, err
+	}
+
+	if f.BookerID.Valid {
+		if _, err := GetBooker(int(f.BookerID.Int64)); err != nil {
+			return nil, err
+		}
+	}
+
+	f.MachineID = machineID
+	f.Status = FaultReported
+	f.ReportedAt = time.Now()
+
+	db := database.GetGoqu()
+
+	insert := db.From("machine_faults").Insert(goqu.Record{
+		"id_machines": f.MachineID,
+		"id_booker":   f.BookerID,
+		"description": f.Description,
+		"status":      string(f.Status),
+		"reported_at": f.ReportedAt,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return nil, errors.New("Could not report fault").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	f.ID = int(lastID)
+
+	return f, nil
+}
+
+// AcknowledgeFault will mark a reported fault as acknowledged by an
+// administrator. The machine will still be marked as not working.
+func AcknowledgeFault(id int) (*Fault, *errors.LaundryError) {
+	f, err := GetFault(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.changeStatus(FaultAcknowledged, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := updateFault(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// ResolveFault will mark a fault as resolved. When the last open fault for a
+// machine is resolved the machine is working again unless an administrator has
+// marked it as not working.
+func ResolveFault(id int) (*Fault, *errors.LaundryError) {
+	f, err := GetFault(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.changeStatus(FaultResolved, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := updateFault(f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// changeStatus will move the fault to the passed status at the given time. A
+// fault may only be acknowledged while it's reported but it may be resolved
+// at any time before it's resolved.
+func (f *Fault) changeStatus(status FaultStatus, at time.Time) *errors.LaundryError {
+	switch status {
+	case FaultAcknowledged:
+		if f.Status != FaultReported {
+			return errors.New("Fault with id %d is already %s", f.ID, f.Status).WithStatus(http.StatusConflict)
+		}
+
+		f.AcknowledgedAt.Time, f.AcknowledgedAt.Valid = at, true
+	case FaultResolved:
+		if f.Status == FaultResolved {
+			return errors.New("Fault with id %d is already resolved", f.ID).WithStatus(http.StatusConflict)
+		}
+
+		f.ResolvedAt.Time, f.ResolvedAt.Valid = at, true
+	default:
+		return errors.New("Cannot change fault with id %d to %s", f.ID, status)
+	}
+
+	f.Status = status
+
+	return nil
+}
+
+func updateFault(f *Fault) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	update := db.From("machine_faults").
+		Where(goqu.Ex{
+			"id": f.ID,
+		}).
+		Update(goqu.Record{
+			"status":          string(f.Status),
+			"acknowledged_at": f.AcknowledgedAt,
+			"resolved_at":     f.ResolvedAt,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return errors.New("Could not update fault with id %d", f.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// faultyMachines will return the ids of all machines with faults which are
+// not yet resolved.
+func faultyMachines() (map[int]bool, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var ids []int
+	err := db.From("machine_faults").
+		SelectDistinct("id_machines").
+		Where(
+			goqu.I("status").Neq(string(FaultResolved)),
+		).
+		ScanVals(&ids)
+
+	if err != nil {
+		return nil, errors.New("Could not get faulty machines").CausedBy(err)
+	}
+
+	var faulty = make(map[int]bool)
+
+	for _, id := range ids {
+		faulty[id] = true
+	}
+
+	return faulty, nil
+}
+
+// markFaulty will mark the machines with faults which are not yet resolved as
+// not working. The working state stored for a machine is only changed by
+// administrators so a machine taken out of service stays out of service when
+// it's faults are resolved.
+func markFaulty(machines []Machine, faulty map[int]bool) {
+	for i := range machines {
+		if faulty[machines[i].ID] {
+			machines[i].Working = false
+		}
+	}
+}
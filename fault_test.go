@@ -0,0 +1,79 @@
+package laundry
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFaultyMachines(t *testing.T) {
+	Convey("Given machines marked as working and not working", t, func() {
+		machines := []Machine{
+			{ID: 1, Working: true},
+			{ID: 2, Working: true},
+			{ID: 3, Working: false},
+		}
+
+		Convey("Machines with open faults are not working", func() {
+			markFaulty(machines, map[int]bool{2: true})
+
+			So(machines[0].Working, ShouldBeTrue)
+			So(machines[1].Working, ShouldBeFalse)
+		})
+
+		Convey("Machines taken out of service stay out of service without faults", func() {
+			markFaulty(machines, map[int]bool{})
+
+			So(machines[0].Working, ShouldBeTrue)
+			So(machines[2].Working, ShouldBeFalse)
+		})
+	})
+}
+
+func TestFaultStatus(t *testing.T) {
+	Convey("Given faults in every state", t, func() {
+		at := time.Date(2018, 5, 7, 12, 0, 0, 0, time.UTC)
+
+		cases := []struct {
+			from FaultStatus
+			to   FaultStatus
+			ok   bool
+		}{
+			{FaultReported, FaultAcknowledged, true},
+			{FaultReported, FaultResolved, true},
+			{FaultAcknowledged, FaultAcknowledged, false},
+			{FaultAcknowledged, FaultResolved, true},
+			{FaultResolved, FaultAcknowledged, false},
+			{FaultResolved, FaultResolved, false},
+			{FaultAcknowledged, FaultReported, false},
+		}
+
+		Convey("Only valid changes are applied", func() {
+			for _, c := range cases {
+				f := Fault{ID: 1, Status: c.from}
+				err := f.changeStatus(c.to, at)
+
+				if c.ok {
+					So(err, ShouldBeNil)
+					So(f.Status, ShouldEqual, c.to)
+				} else {
+					So(err, ShouldNotBeNil)
+					So(f.Status, ShouldEqual, c.from)
+				}
+			}
+		})
+
+		Convey("The time of the change is recorded", func() {
+			f := Fault{ID: 1, Status: FaultReported}
+
+			So(f.changeStatus(FaultAcknowledged, at), ShouldBeNil)
+			So(f.AcknowledgedAt.Valid, ShouldBeTrue)
+			So(f.AcknowledgedAt.Time, ShouldResemble, at)
+			So(f.ResolvedAt.Valid, ShouldBeFalse)
+
+			So(f.changeStatus(FaultResolved, at.Add(time.Hour)), ShouldBeNil)
+			So(f.ResolvedAt.Time, ShouldResemble, at.Add(time.Hour))
+		})
+	})
+}
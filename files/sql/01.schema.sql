@@ -3,26 +3,112 @@ DROP DATABASE IF EXISTS `laundry`;
 CREATE DATABASE `laundry`;
 USE `laundry`;
 
+CREATE TABLE `properties` (
+    id      INT PRIMARY KEY AUTO_INCREMENT,
+    name    VARCHAR(100) NOT NULL,
+    address VARCHAR(255)
+);
+
+CREATE TABLE `rooms` (
+    id            INT PRIMARY KEY AUTO_INCREMENT,
+    id_properties INT NOT NULL,
+    name          VARCHAR(100) NOT NULL,
+
+    FOREIGN KEY (id_properties) REFERENCES properties(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE `booker` (
+    id             INT PRIMARY KEY AUTO_INCREMENT,
+    id_properties  INT NOT NULL,
+    identifier     VARCHAR(100) NOT NULL, -- i.e. apartment no
+    name           VARCHAR(100),
+    email          VARCHAR(100),
+    phone          VARCHAR(20),
+    pin            VARCHAR(100),
+    hide_name      TINYINT(1) NOT NULL DEFAULT 0,
+    erased_at      DATETIME, -- personal data removed, past bookings are kept
+    calendar_token VARCHAR(64), -- secret used to subscribe to the booker calendar
+
+    FOREIGN KEY (id_properties) REFERENCES properties(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `booker_tags` (
     id          INT PRIMARY KEY AUTO_INCREMENT,
-    identifier  VARCHAR(100) NOT NULL, -- i.e. apartment no
-    name        VARCHAR(100),
-    email       VARCHAR(100),
-    phone       VARCHAR(20),
-    pin         VARCHAR(100)
+    id_booker   INT NOT NULL,
+    tag         VARCHAR(100) NOT NULL, -- id read from a RFID or NFC tag
+    description VARCHAR(100),
+    created_at  DATETIME NOT NULL,
+
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_booker_tags UNIQUE (tag)
 );
 
 CREATE TABLE `machines` (
-    id      INT PRIMARY KEY AUTO_INCREMENT,
-    info    VARCHAR(100),
-    working TINYINT(1) DEFAULT 1
+    id       INT PRIMARY KEY AUTO_INCREMENT,
+    id_rooms INT NOT NULL,
+    info     VARCHAR(100),
+    working  TINYINT(1) DEFAULT 1,
+    type     ENUM('washer', 'dryer', 'tumbler', 'drying_cabinet', 'mangle') NOT NULL,
+    capacity DECIMAL(4, 1) NOT NULL DEFAULT 0, -- kg
+
+    FOREIGN KEY (id_rooms) REFERENCES rooms(id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
-CREATE TABLE `slots` (
+CREATE TABLE `machine_programs` (
     id          INT PRIMARY KEY AUTO_INCREMENT,
-    week_day    ENUM('0', '1', '2', '3', '4', '5', '6') NOT NULL,
-    start_time  TIME NOT NULL,
-    end_time    TIME NOT NULL
+    id_machines INT NOT NULL,
+    name        VARCHAR(100) NOT NULL,
+    duration    INT NOT NULL, -- minutes
+
+    FOREIGN KEY (id_machines) REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `machine_faults` (
+    id              INT PRIMARY KEY AUTO_INCREMENT,
+    id_machines     INT NOT NULL,
+    id_booker       INT,
+    description     VARCHAR(255) NOT NULL,
+    status          ENUM('reported', 'acknowledged', 'resolved') NOT NULL DEFAULT 'reported',
+    reported_at     DATETIME NOT NULL,
+    acknowledged_at DATETIME,
+    resolved_at     DATETIME,
+
+    FOREIGN KEY (id_machines) REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_booker)   REFERENCES booker(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE `maintenance_windows` (
+    id          INT PRIMARY KEY AUTO_INCREMENT,
+    id_machines INT NOT NULL,
+    start_date  DATE NOT NULL,
+    end_date    DATE NOT NULL,
+    description VARCHAR(255),
+
+    FOREIGN KEY (id_machines) REFERENCES machines(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `slot_sets` (
+    id          INT PRIMARY KEY AUTO_INCREMENT,
+    id_rooms    INT NOT NULL,
+    name        VARCHAR(100) NOT NULL,
+    valid_from  DATE NOT NULL,
+    valid_to    DATE,
+
+    FOREIGN KEY (id_rooms) REFERENCES rooms(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_slot_sets UNIQUE (id_rooms, valid_from)
+);
+
+CREATE TABLE `slots` (
+    id           INT PRIMARY KEY AUTO_INCREMENT,
+    id_rooms     INT NOT NULL,
+    id_slot_sets INT, -- only recurring slots belong to a set
+    week_day     ENUM('0', '1', '2', '3', '4', '5', '6') NOT NULL,
+    start_time   TIME NOT NULL,
+    end_time     TIME NOT NULL, -- before start_time if ending the day after
+    recurring    TINYINT(1) NOT NULL DEFAULT 1, -- extra slots are not recurring
+
+    FOREIGN KEY (id_rooms)     REFERENCES rooms(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_slot_sets) REFERENCES slot_sets(id) ON UPDATE CASCADE ON DELETE CASCADE
 );
 
 CREATE TABLE `slots_machines` (
@@ -35,6 +121,21 @@ CREATE TABLE `slots_machines` (
     CONSTRAINT UC_slots_machines UNIQUE (id_machines, id_slots)
 );
 
+CREATE TABLE `slot_overrides` (
+    id          INT PRIMARY KEY AUTO_INCREMENT,
+    id_rooms    INT NOT NULL,
+    kind        ENUM('closed', 'extra', 'hours') NOT NULL,
+    start_date  DATE NOT NULL,
+    end_date    DATE NOT NULL,
+    id_slots    INT, -- closed slot, extra slot or slot with changed hours
+    start_time  TIME,
+    end_time    TIME,
+    description VARCHAR(255),
+
+    FOREIGN KEY (id_rooms) REFERENCES rooms(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_slots) REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
 CREATE TABLE `bookings` (
     id          INT PRIMARY KEY AUTO_INCREMENT,
     book_date   DATE NOT NULL, 
@@ -42,7 +143,125 @@ CREATE TABLE `bookings` (
     id_booker   INT NOT NULL,
 
     FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE,
-    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_bookings UNIQUE (book_date, id_slots)
+);
+
+CREATE TABLE `series` (
+    id               INT PRIMARY KEY AUTO_INCREMENT,
+    id_booker        INT NOT NULL,
+    id_slots         INT NOT NULL,
+    recurrence       VARCHAR(10) NOT NULL, -- weekly or biweekly
+    start_date       DATE NOT NULL,
+    end_date         DATE,
+    occurrence_count INT, -- number of occurrences if no end date
+    created_at       DATETIME NOT NULL,
+    cancelled_at     DATETIME,
+
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `series_occurrences` (
+    id          INT PRIMARY KEY AUTO_INCREMENT,
+    id_series   INT NOT NULL,
+    book_date   DATE NOT NULL,
+    id_bookings INT,
+    status      VARCHAR(10) NOT NULL, -- booked, conflict or cancelled
+    reason      VARCHAR(255), -- why the occurrence couldn't be booked
+
+    FOREIGN KEY (id_series)   REFERENCES series(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_bookings) REFERENCES bookings(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT UC_series_occurrences UNIQUE (id_series, book_date)
+);
+
+CREATE TABLE `holds` (
+    id         INT PRIMARY KEY AUTO_INCREMENT,
+    id_slots   INT NOT NULL,
+    book_date  DATE NOT NULL,
+    id_booker  INT NOT NULL,
+    token      VARCHAR(64) NOT NULL, -- consumed when the booking is added
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_holds UNIQUE (id_slots, book_date),
+    CONSTRAINT UC_holds_token UNIQUE (token)
+);
+
+CREATE TABLE `waitlist` (
+    id            INT PRIMARY KEY AUTO_INCREMENT,
+    id_slots      INT NOT NULL,
+    book_date     DATE NOT NULL,
+    id_booker     INT NOT NULL,
+    created_at    DATETIME NOT NULL,
+    offered_until DATETIME, -- set when the released slot is offered to the booker
+
+    FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_waitlist UNIQUE (id_slots, book_date, id_booker)
+);
+
+CREATE TABLE `swaps` (
+    id               INT PRIMARY KEY AUTO_INCREMENT,
+    id_from_bookings INT NOT NULL,
+    id_to_bookings   INT NOT NULL,
+    id_from_booker   INT NOT NULL, -- the booker requesting the swap
+    id_to_booker     INT NOT NULL,
+    status           VARCHAR(10) NOT NULL, -- pending, accepted, declined or cancelled
+    created_at       DATETIME NOT NULL,
+    answered_at      DATETIME,
+
+    FOREIGN KEY (id_from_bookings) REFERENCES bookings(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_to_bookings)   REFERENCES bookings(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_from_booker)   REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_to_booker)     REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `check_ins` (
+    id            INT PRIMARY KEY AUTO_INCREMENT,
+    id_bookings   INT NOT NULL,
+    checked_in_at DATETIME NOT NULL,
+    source        VARCHAR(10) NOT NULL, -- how the booker checked in; api, pin or tag
+
+    FOREIGN KEY (id_bookings) REFERENCES bookings(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT UC_check_ins UNIQUE (id_bookings)
+);
+
+CREATE TABLE `no_shows` (
+    id          INT PRIMARY KEY AUTO_INCREMENT,
+    id_booker   INT NOT NULL,
+    id_slots    INT NOT NULL,
+    book_date   DATE NOT NULL,
+    released_at DATETIME NOT NULL, -- when the booking was released
+
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `late_cancellations` (
+    id           INT PRIMARY KEY AUTO_INCREMENT,
+    id_booker    INT NOT NULL,
+    id_slots     INT NOT NULL,
+    book_date    DATE NOT NULL,
+    cancelled_at DATETIME NOT NULL,
+
+    FOREIGN KEY (id_booker) REFERENCES booker(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_slots)  REFERENCES slots(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE `unlock_attempts` (
+    id           INT PRIMARY KEY AUTO_INCREMENT,
+    id_rooms     INT NOT NULL,
+    id_booker    INT,
+    id_bookings  INT, -- the booking the door was unlocked for
+    attempted_at DATETIME NOT NULL,
+    allowed      TINYINT(1) NOT NULL,
+    reason       VARCHAR(255), -- why the attempt was denied or failed
+
+    FOREIGN KEY (id_rooms)    REFERENCES rooms(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (id_booker)   REFERENCES booker(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    FOREIGN KEY (id_bookings) REFERENCES bookings(id) ON UPDATE CASCADE ON DELETE SET NULL
 );
 
 CREATE TABLE `notification_types` (
@@ -1,52 +1,76 @@
 SET NAMES utf8;
 USE `laundry`;
 
+INSERT INTO `properties` VALUES
+(1,'Main Street 1',NULL);
+
+INSERT INTO `rooms` VALUES
+(1,1,'Laundry room');
+
 INSERT INTO `booker` VALUES
-(1,'1001','Some User','some.email@domain.com',NULL,'1234'),
-(2,'1002','Another User',NULL,NULL,NULL);
+(1,1,'1001','Some User','some.email@domain.com',NULL,'1234',0,NULL,NULL),
+(2,1,'1002','Another User',NULL,NULL,NULL,1,NULL,NULL);
 
 INSERT INTO `machines` VALUES
-(1,'Washer Electrolux 1',1),
-(2,'Washer Electrolux 2',1),
-(3,'Tumbler Electrolux 1',1),
-(4,'Dryer Electrolux 1',1),
-(5,'Dryer Electrolux 2',1),
-(6,'Broken machine',0);
+(1,1,'Washer Electrolux 1',1,'washer',8.0),
+(2,1,'Washer Electrolux 2',1,'washer',8.0),
+(3,1,'Tumbler Electrolux 1',1,'tumbler',8.0),
+(4,1,'Dryer Electrolux 1',1,'dryer',0),
+(5,1,'Dryer Electrolux 2',1,'dryer',0),
+(6,1,'Broken machine',0,'washer',6.0);
+
+INSERT INTO `machine_programs` VALUES
+(1,1,'Quick 30',30),
+(2,1,'Cotton 60',120),
+(3,1,'Synthetic 40',80),
+(4,2,'Quick 30',30),
+(5,2,'Cotton 60',120),
+(6,2,'Synthetic 40',80),
+(7,3,'Extra dry',90),
+(8,3,'Iron dry',60),
+(9,4,'Normal',120),
+(10,5,'Normal',120);
+
+INSERT INTO `machine_faults` VALUES
+(1,6,2,'Does not start','acknowledged','2017-08-20 10:00:00','2017-08-21 08:00:00',NULL);
+
+INSERT INTO `slot_sets` VALUES
+(1,1,'Default','2017-01-01',NULL);
 
 INSERT INTO `slots` VALUES
 -- Monday
-(1,'1','07:00:00','10:00:00'),
-(2,'1','10:00:00','14:00:00'),
-(3,'1','14:00:00','18:00:00'),
-(4,'1','18:00:00','22:00:00'),
+(1,1,1,'1','07:00:00','10:00:00',1),
+(2,1,1,'1','10:00:00','14:00:00',1),
+(3,1,1,'1','14:00:00','18:00:00',1),
+(4,1,1,'1','18:00:00','22:00:00',1),
 -- Tuesday
-(5,'2','07:00:00','10:00:00'),
-(6,'2','10:00:00','14:00:00'),
-(7,'2','14:00:00','18:00:00'),
-(8,'2','18:00:00','22:00:00'),
+(5,1,1,'2','07:00:00','10:00:00',1),
+(6,1,1,'2','10:00:00','14:00:00',1),
+(7,1,1,'2','14:00:00','18:00:00',1),
+(8,1,1,'2','18:00:00','22:00:00',1),
 -- Wednesday
-(9,'3','07:00:00','10:00:00'),
-(10,'3','10:00:00','14:00:00'),
-(11,'3','14:00:00','18:00:00'),
-(12,'3','18:00:00','22:00:00'),
+(9,1,1,'3','07:00:00','10:00:00',1),
+(10,1,1,'3','10:00:00','14:00:00',1),
+(11,1,1,'3','14:00:00','18:00:00',1),
+(12,1,1,'3','18:00:00','22:00:00',1),
 -- Thursday
-(13,'4','07:00:00','10:00:00'),
-(14,'4','10:00:00','14:00:00'),
-(15,'4','14:00:00','18:00:00'),
-(16,'4','18:00:00','22:00:00'),
+(13,1,1,'4','07:00:00','10:00:00',1),
+(14,1,1,'4','10:00:00','14:00:00',1),
+(15,1,1,'4','14:00:00','18:00:00',1),
+(16,1,1,'4','18:00:00','22:00:00',1),
 -- Friday
-(17,'5','07:00:00','10:00:00'),
-(18,'5','10:00:00','14:00:00'),
-(19,'5','14:00:00','18:00:00'),
-(20,'5','18:00:00','22:00:00'),
+(17,1,1,'5','07:00:00','10:00:00',1),
+(18,1,1,'5','10:00:00','14:00:00',1),
+(19,1,1,'5','14:00:00','18:00:00',1),
+(20,1,1,'5','18:00:00','22:00:00',1),
 -- Saturday
-(21,'6','08:00:00','12:00:00'),
-(22,'6','12:00:00','16:00:00'),
-(23,'6','16:00:00','20:00:00'),
+(21,1,1,'6','08:00:00','12:00:00',1),
+(22,1,1,'6','12:00:00','16:00:00',1),
+(23,1,1,'6','16:00:00','20:00:00',1),
 -- Sunday
-(24,'0','08:00:00','12:00:00'),
-(25,'0','12:00:00','16:00:00'),
-(26,'0','16:00:00','20:00:00');
+(24,1,1,'0','08:00:00','12:00:00',1),
+(25,1,1,'0','12:00:00','16:00:00',1),
+(26,1,1,'0','16:00:00','20:00:00',1);
 
 INSERT INTO `slots_machines` VALUES
 (1,1,1),
@@ -85,6 +109,9 @@ INSERT INTO `slots_machines` VALUES
 (34,7,4),
 (35,7,5);
 
+INSERT INTO `slot_overrides` VALUES
+(1,1,'closed','2017-12-24','2017-12-26',NULL,NULL,NULL,'Christmas');
+
 INSERT INTO `bookings` VALUES
 (1,'2017-08-23',1,1),
 (2,'2017-09-12',7,1),
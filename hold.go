@@ -0,0 +1,249 @@
+package laundry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// maxHoldsPerBooker is the number of slots a booker may hold at the same time
+const maxHoldsPerBooker = 1
+
+// Hold represents a slot reserved for a booker at a given date while the
+// booker confirms the booking. The booking is made by passing the token as
+// hold_token when adding the booking before the hold expires.
+type Hold struct {
+	ID        int       `db:"id"         json:"id"`
+	SlotID    int       `db:"id_slots"   json:"slot_id"`
+	BookDate  time.Time `db:"book_date"  json:"book_date"`
+	BookerID  int       `db:"id_booker"  json:"booker_id"`
+	Token     string    `db:"token"      json:"token"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	Seconds   int       `db:"-"          json:"seconds,omitempty"`
+}
+
+// AddHold will reserve a slot for a booker for the requested number of
+// seconds, at most the configured number of seconds which is also the
+// default. The slot must be possible to book for the booker, only one booker
+// may hold a slot at a time and a booker may only hold one slot at a time.
+func AddHold(h *Hold) (*Hold, *errors.LaundryError) {
+	maxSeconds := config.GetConfig().Bookings.MaxHoldSeconds
+	if maxSeconds <= 0 {
+		return nil, errors.New("Holds are disabled").WithStatus(http.StatusNotImplemented)
+	}
+
+	if h.Seconds <= 0 || h.Seconds > maxSeconds {
+		h.Seconds = maxSeconds
+	}
+
+	b := Bookings{
+		BookDate: h.BookDate,
+		SlotID:   h.SlotID,
+		BookerID: h.BookerID,
+	}
+
+	if err := validBooking(&b); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, errors.New("Could not create token").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	h.BookDate = b.BookDate
+	h.Token = hex.EncodeToString(secret)
+	h.ExpiresAt = time.Now().Add(time.Duration(h.Seconds) * time.Second)
+
+	db := database.GetGoqu()
+
+	// An expired hold not yet swept must not stop the slot from being held
+	expired := db.From("holds").
+		Where(
+			goqu.I("id_slots").Eq(h.SlotID),
+			goqu.I("book_date").Eq(h.BookDate.Format("2006-01-02")),
+			goqu.I("expires_at").Lte(time.Now()),
+		).
+		Delete()
+
+	if _, err := expired.Exec(); err != nil {
+		return nil, errors.New("Could not remove expired holds").CausedBy(err)
+	}
+
+	held, cErr := db.From("holds").
+		Where(
+			goqu.I("id_booker").Eq(h.BookerID),
+			goqu.I("expires_at").Gt(time.Now()),
+		).
+		Count()
+
+	if cErr != nil {
+		return nil, errors.New("Could not get holds").CausedBy(cErr)
+	}
+
+	if held >= maxHoldsPerBooker {
+		return nil, errors.New("Booker with id %d already holds a slot", h.BookerID).WithStatus(http.StatusConflict)
+	}
+
+	insert := db.From("holds").Insert(goqu.Record{
+		"id_slots":   h.SlotID,
+		"book_date":  h.BookDate.Format("2006-01-02"),
+		"id_booker":  h.BookerID,
+		"token":      h.Token,
+		"expires_at": h.ExpiresAt,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, errors.New("Slot with id %d is already held", h.SlotID).WithStatus(http.StatusConflict)
+		}
+
+		return nil, errors.New("Could not create hold").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	h.ID = int(lastID)
+
+	return h, nil
+}
+
+// GetHold will return a hold based on the token
+func GetHold(token string) (*Hold, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var h Hold
+	found, err := db.From("holds").Where(goqu.Ex{
+		"token": token,
+	}).ScanStruct(&h)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found || !time.Now().Before(h.ExpiresAt) {
+		return nil, errors.New("Hold not found or expired").WithStatus(http.StatusNotFound)
+	}
+
+	return &h, nil
+}
+
+// RemoveHold will release a hold before it expires
+func RemoveHold(h *Hold) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("holds").Where(goqu.Ex{
+		"id": h.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove hold with id %d", h.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveExpiredHolds will remove all holds expired at the given time
+func RemoveExpiredHolds(at time.Time) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("holds").Where(
+		goqu.I("expires_at").Lte(at),
+	).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove expired holds").CausedBy(err)
+	}
+
+	return nil
+}
+
+// SweepHolds will remove expired holds every interval until the program exits
+func SweepHolds(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := RemoveExpiredHolds(time.Now()); err != nil {
+			log.GetLogger().Errorf("Could not sweep holds: %s", err)
+		}
+	}
+}
+
+// heldByOther returns an error if the slot is held by someone else than the
+// booker or if the hold token of the booking isn't valid
+func heldByOther(b *Bookings) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	var holds []Hold
+	err := db.From("holds").
+		Where(
+			goqu.I("id_slots").Eq(b.SlotID),
+			goqu.I("book_date").Eq(b.BookDate.Format("2006-01-02")),
+		).
+		ScanStructs(&holds)
+
+	if err != nil {
+		return errors.New("Could not get holds").CausedBy(err)
+	}
+
+	return holdConflict(holds, b, time.Now())
+}
+
+// holdConflict returns an error if any of the holds of the slot is held by
+// someone else than the booker at the given time or if the hold token of the
+// booking doesn't match a hold. Expired holds are ignored even before they're
+// swept.
+func holdConflict(holds []Hold, b *Bookings, at time.Time) *errors.LaundryError {
+	var active int
+
+	for _, h := range holds {
+		if !at.Before(h.ExpiresAt) {
+			continue
+		}
+
+		active++
+
+		if h.BookerID != b.BookerID {
+			return errors.New("Slot with id %d is held by someone else", b.SlotID).WithStatus(http.StatusConflict)
+		}
+
+		if b.HoldToken != "" && b.HoldToken != h.Token {
+			return errors.New("Invalid hold token").WithStatus(http.StatusConflict)
+		}
+	}
+
+	if b.HoldToken != "" && active == 0 {
+		return errors.New("Hold not found or expired").WithStatus(http.StatusConflict)
+	}
+
+	return nil
+}
+
+// consumeHold will remove the hold of the booking within the transaction.
+// If the hold was swept meanwhile the booking fails.
+func consumeHold(tx *goqu.TxDatabase, b *Bookings) *errors.LaundryError {
+	if b.HoldToken == "" {
+		return nil
+	}
+
+	delete := tx.From("holds").
+		Where(
+			goqu.I("token").Eq(b.HoldToken),
+			goqu.I("id_booker").Eq(b.BookerID),
+			goqu.I("expires_at").Gt(time.Now()),
+		).
+		Delete()
+
+	return updatedOne(delete, "Hold for slot with id %d not found or expired", b.SlotID)
+}
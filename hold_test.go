@@ -0,0 +1,140 @@
+package laundry
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	. "github.com/smartystreets/goconvey/convey"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+func TestHoldConflict(t *testing.T) {
+	Convey("Given a slot held by a booker", t, func() {
+		at := time.Date(2018, 5, 7, 12, 0, 0, 0, time.UTC)
+
+		holds := []Hold{
+			{ID: 1, SlotID: 1, BookerID: 1, Token: "abc", ExpiresAt: at.Add(time.Minute)},
+		}
+
+		Convey("The booker may book the slot with or without the token", func() {
+			So(holdConflict(holds, &Bookings{SlotID: 1, BookerID: 1}, at), ShouldBeNil)
+			So(holdConflict(holds, &Bookings{SlotID: 1, BookerID: 1, HoldToken: "abc"}, at), ShouldBeNil)
+		})
+
+		Convey("A hold owned by another booker conflicts", func() {
+			err := holdConflict(holds, &Bookings{SlotID: 1, BookerID: 2}, at)
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusConflict)
+			So(holdConflict(holds, &Bookings{SlotID: 1, BookerID: 2, HoldToken: "abc"}, at), ShouldNotBeNil)
+		})
+
+		Convey("A wrong token conflicts", func() {
+			err := holdConflict(holds, &Bookings{SlotID: 1, BookerID: 1, HoldToken: "def"}, at)
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusConflict)
+		})
+
+		Convey("An expired hold is ignored but its token is not valid", func() {
+			expired := at.Add(time.Minute)
+
+			So(holdConflict(holds, &Bookings{SlotID: 1, BookerID: 2}, expired), ShouldBeNil)
+			So(holdConflict(holds, &Bookings{SlotID: 1, BookerID: 1, HoldToken: "abc"}, expired), ShouldNotBeNil)
+			So(holdConflict(nil, &Bookings{SlotID: 1, BookerID: 1, HoldToken: "abc"}, at), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConsumeHold(t *testing.T) {
+	if os.Getenv("LAUNDRY_DSN") == "" {
+		t.Skip("LAUNDRY_DSN not set, skipping test against the database")
+	}
+
+	Convey("Given a slot held by a booker", t, func() {
+		config.SetConfig(&config.Configuration{
+			TimeZone: "Europe/Stockholm",
+			Database: config.Database{PoolSize: 1},
+			Bookings: config.BookingRules{MaxHoldSeconds: 120},
+		})
+		database.SetupConnection(config.GetConfig().Database)
+
+		p, err := AddProperty(&Property{Name: "Hold test"})
+		So(err, ShouldBeNil)
+
+		defer RemoveProperty(p)
+
+		r, err := AddRoom(&Room{PropertyID: p.ID, Name: "Laundry room"})
+		So(err, ShouldBeNil)
+
+		date := today().AddDate(0, 0, 7)
+
+		ss, err := AddSlotSet(&SlotSet{RoomID: r.ID, Name: "Hold test", ValidFrom: date})
+		So(err, ShouldBeNil)
+
+		slot, err := AddSlot(&Slot{
+			SetID:   NullInt64{sql.NullInt64{Int64: int64(ss.ID), Valid: true}},
+			Weekday: int(date.Weekday()),
+			Start:   "10:00:00",
+			End:     "13:00:00",
+		})
+		So(err, ShouldBeNil)
+
+		holder, err := AddBooker(&Booker{PropertyID: p.ID, Identifier: "1001"})
+		So(err, ShouldBeNil)
+
+		other, err := AddBooker(&Booker{PropertyID: p.ID, Identifier: "1002"})
+		So(err, ShouldBeNil)
+
+		h, err := AddHold(&Hold{SlotID: slot.ID, BookDate: date, BookerID: holder.ID})
+		So(err, ShouldBeNil)
+
+		consume := func(b *Bookings) error {
+			tx, tErr := database.GetGoqu().Begin()
+			So(tErr, ShouldBeNil)
+
+			defer tx.Rollback()
+
+			if err := consumeHold(tx, b); err != nil {
+				return err
+			}
+
+			return nil
+		}
+
+		Convey("The hold is consumed with the token of the booker", func() {
+			So(consume(&Bookings{SlotID: slot.ID, BookerID: holder.ID, HoldToken: h.Token}), ShouldBeNil)
+		})
+
+		Convey("A wrong token is not consumed", func() {
+			So(consume(&Bookings{SlotID: slot.ID, BookerID: holder.ID, HoldToken: "deadbeef"}), ShouldNotBeNil)
+		})
+
+		Convey("The hold of another booker is not consumed", func() {
+			So(consume(&Bookings{SlotID: slot.ID, BookerID: other.ID, HoldToken: h.Token}), ShouldNotBeNil)
+		})
+
+		Convey("An expired hold is not consumed", func() {
+			update := database.GetGoqu().From("holds").
+				Where(goqu.Ex{"id": h.ID}).
+				Update(goqu.Record{"expires_at": time.Now().Add(-time.Second)})
+
+			_, uErr := update.Exec()
+			So(uErr, ShouldBeNil)
+
+			So(consume(&Bookings{SlotID: slot.ID, BookerID: holder.ID, HoldToken: h.Token}), ShouldNotBeNil)
+		})
+
+		Convey("A booker may only hold one slot at a time", func() {
+			_, err := AddHold(&Hold{SlotID: slot.ID, BookDate: date.AddDate(0, 0, 7), BookerID: holder.ID})
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusConflict)
+		})
+	})
+}
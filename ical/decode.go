@@ -0,0 +1,268 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationPattern matches an iCalendar duration, i.e. P1DT2H or -PT15M
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// property represents a parsed content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode will parse a calendar from r. Times without a time zone and all day
+// events are interpreted in loc while times with a TZID parameter are
+// interpreted in that time zone. Time zones must be IANA time zone names.
+// Recurring events are not supported and will return an error.
+func Decode(r io.Reader, loc *time.Location) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		c          Calendar
+		components []string
+		event      *Event
+		eventProps map[string]property
+	)
+
+	for n, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s", n+1, err)
+		}
+
+		switch p.name {
+		case "BEGIN":
+			components = append(components, p.value)
+
+			if p.value == "VEVENT" {
+				event = &Event{}
+				eventProps = make(map[string]property)
+			}
+
+			continue
+		case "END":
+			if len(components) == 0 || components[len(components)-1] != p.value {
+				return nil, fmt.Errorf("Line %d: Unexpected END:%s", n+1, p.value)
+			}
+
+			components = components[:len(components)-1]
+
+			if p.value == "VEVENT" {
+				if err := completeEvent(event, eventProps, loc); err != nil {
+					return nil, fmt.Errorf("Line %d: %s", n+1, err)
+				}
+
+				c.Events = append(c.Events, *event)
+				event = nil
+			}
+
+			continue
+		}
+
+		if len(components) == 0 {
+			return nil, fmt.Errorf("Line %d: Property %s outside of calendar", n+1, p.name)
+		}
+
+		switch components[len(components)-1] {
+		case "VCALENDAR":
+			switch p.name {
+			case "PRODID":
+				c.ProdID = p.value
+			case "X-WR-CALNAME":
+				c.Name = unescape(p.value)
+			case "X-WR-TIMEZONE":
+				c.TimeZone = p.value
+			}
+		case "VEVENT":
+			eventProps[p.name] = p
+		}
+	}
+
+	if len(components) > 0 {
+		return nil, fmt.Errorf("Missing END:%s", components[len(components)-1])
+	}
+
+	return &c, nil
+}
+
+// completeEvent will set the fields of the event from it's properties
+func completeEvent(e *Event, props map[string]property, loc *time.Location) error {
+	if _, ok := props["RRULE"]; ok {
+		return fmt.Errorf("Recurring events are not supported")
+	}
+
+	start, ok := props["DTSTART"]
+	if !ok {
+		return fmt.Errorf("Event is missing DTSTART")
+	}
+
+	var err error
+
+	e.UID = props["UID"].value
+	e.Summary = unescape(props["SUMMARY"].value)
+	e.Description = unescape(props["DESCRIPTION"].value)
+	e.Location = unescape(props["LOCATION"].value)
+	e.AllDay = start.params["VALUE"] == "DATE" || len(start.value) == len(dateFormat)
+
+	if e.Start, err = parseTime(start, loc); err != nil {
+		return err
+	}
+
+	switch {
+	case props["DTEND"].value != "":
+		if e.End, err = parseTime(props["DTEND"], loc); err != nil {
+			return err
+		}
+	case props["DURATION"].value != "":
+		d, err := parseDuration(props["DURATION"].value)
+		if err != nil {
+			return err
+		}
+
+		e.End = e.Start.Add(d)
+	case e.AllDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+
+	if e.End.Before(e.Start) {
+		return fmt.Errorf("Event ends before it starts")
+	}
+
+	return nil
+}
+
+// parseTime will parse a date or date time property
+func parseTime(p property, loc *time.Location) (time.Time, error) {
+	if tzid, ok := p.params["TZID"]; ok {
+		tz, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Unknown time zone '%s'", tzid)
+		}
+
+		loc = tz
+	}
+
+	switch {
+	case p.params["VALUE"] == "DATE" || len(p.value) == len(dateFormat):
+		return time.ParseInLocation(dateFormat, p.value, loc)
+	case strings.HasSuffix(p.value, "Z"):
+		return time.Parse(dateTimeFormat, p.value)
+	}
+
+	return time.ParseInLocation("20060102T150405", p.value, loc)
+}
+
+// parseDuration will parse an iCalendar duration
+func parseDuration(s string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("Invalid duration '%s'", s)
+	}
+
+	var d time.Duration
+
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] == "" {
+			continue
+		}
+
+		n, _ := strconv.Atoi(m[i+2])
+		d += time.Duration(n) * unit
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// parseLine will parse a content line on the form NAME;PARAM=VALUE:VALUE
+func parseLine(line string) (property, error) {
+	p := property{
+		params: make(map[string]string),
+	}
+
+	// Find the colon separating name and parameters from the value, colons
+	// inside quoted parameter values are ignored.
+	quoted, colon := false, -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+
+	if colon < 0 {
+		return p, fmt.Errorf("Invalid content line '%s'", line)
+	}
+
+	p.value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	p.name = strings.ToUpper(parts[0])
+
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("Invalid parameter '%s'", param)
+		}
+
+		p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+
+	return p, nil
+}
+
+// unfold will read all content lines joining folded lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// unescape will unescape a text value
+func unescape(s string) string {
+	return strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	).Replace(s)
+}
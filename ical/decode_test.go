@@ -0,0 +1,112 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const holidays = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Holidays//EN\r\n" +
+	"X-WR-CALNAME:Holidays\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:christmas@holidays\r\n" +
+	"DTSTART;VALUE=DATE:20181224\r\n" +
+	"DTEND;VALUE=DATE:20181227\r\n" +
+	"SUMMARY:Christmas\\, closed\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cleaning@holidays\r\n" +
+	"DTSTART;TZID=\"America/New_York\":20180325T080000\r\n" +
+	"DURATION:PT2H30M\r\n" +
+	"SUMMARY:Cleaning of the laundry room which is a long summary to make sure\r\n" +
+	"  that folded lines are joined\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:floating@holidays\r\n" +
+	"DTSTART:20180325T010000\r\n" +
+	"DTEND:20180325T040000\r\n" +
+	"SUMMARY:Floating\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestDecode(t *testing.T) {
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	Convey("Given a calendar with all day, time zone and floating events", t, func() {
+		c, err := Decode(strings.NewReader(holidays), stockholm)
+
+		So(err, ShouldBeNil)
+		So(c.Name, ShouldEqual, "Holidays")
+		So(len(c.Events), ShouldEqual, 3)
+
+		Convey("All day events are at midnight in the default time zone", func() {
+			e := c.Events[0]
+
+			So(e.AllDay, ShouldBeTrue)
+			So(e.Summary, ShouldEqual, "Christmas, closed")
+			So(e.Start.Equal(time.Date(2018, 12, 24, 0, 0, 0, 0, stockholm)), ShouldBeTrue)
+			So(e.End.Equal(time.Date(2018, 12, 27, 0, 0, 0, 0, stockholm)), ShouldBeTrue)
+		})
+
+		Convey("Times with a time zone are parsed in that time zone", func() {
+			e := c.Events[1]
+
+			So(e.AllDay, ShouldBeFalse)
+			So(e.Start.Equal(time.Date(2018, 3, 25, 8, 0, 0, 0, newYork)), ShouldBeTrue)
+			So(e.End.Sub(e.Start), ShouldEqual, 2*time.Hour+30*time.Minute)
+			So(e.Summary, ShouldEndWith, " that folded lines are joined")
+		})
+
+		Convey("Floating times are parsed in the default time zone", func() {
+			e := c.Events[2]
+
+			So(e.Start.Equal(time.Date(2018, 3, 25, 1, 0, 0, 0, stockholm)), ShouldBeTrue)
+			So(e.End.Sub(e.Start), ShouldEqual, 2*time.Hour)
+		})
+	})
+
+	Convey("Given invalid calendars", t, func() {
+		Convey("Recurring events are rejected", func() {
+			ics := strings.Replace(holidays, "UID:christmas@holidays\r\n", "UID:christmas@holidays\r\nRRULE:FREQ=YEARLY\r\n", 1)
+
+			_, err := Decode(strings.NewReader(ics), time.UTC)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Unterminated components are rejected", func() {
+			_, err := Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"), time.UTC)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an encoded calendar", t, func() {
+		c := Calendar{
+			ProdID: "-//laundry//EN",
+			Events: []Event{
+				{UID: "1", Start: time.Date(2018, 12, 24, 0, 0, 0, 0, time.UTC), End: time.Date(2018, 12, 25, 0, 0, 0, 0, time.UTC), AllDay: true, Summary: "A; B"},
+			},
+		}
+
+		var buf bytes.Buffer
+		c.Encode(&buf)
+
+		Convey("The decoded calendar matches", func() {
+			decoded, err := Decode(&buf, time.UTC)
+
+			So(err, ShouldBeNil)
+			So(decoded.Events[0].Summary, ShouldEqual, "A; B")
+			So(decoded.Events[0].AllDay, ShouldBeTrue)
+			So(decoded.Events[0].End, ShouldResemble, c.Events[0].End)
+		})
+	})
+}
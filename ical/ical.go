@@ -0,0 +1,204 @@
+/*
+Package ical implements writing and parsing of iCalendar (RFC 5545) calendars
+to be used as calendar feeds for bookings and schedules and to import closures.
+Only single events are supported, recurring events with a RRULE are not.
+*/
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+	lineLength     = 75
+)
+
+// Calendar represents a VCALENDAR holding a list of events
+type Calendar struct {
+	ProdID   string
+	Name     string
+	TimeZone string
+	Events   []Event
+}
+
+// Event represents a VEVENT between a start- and end time. All day events
+// starts at midnight at the first day and ends at midnight the day after the
+// last day.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Summary     string
+	Description string
+	Location    string
+	Alarms      []Alarm
+}
+
+// Alarm represents a VALARM displayed a given duration before the event
+// starts
+type Alarm struct {
+	Before      time.Duration
+	Description string
+}
+
+// Encode will write the calendar to w in the iCalendar format
+func (c Calendar) Encode(w io.Writer) error {
+	e := encoder{w: bufio.NewWriter(w)}
+
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", c.ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+
+	if c.Name != "" {
+		e.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	if c.TimeZone != "" {
+		e.line("X-WR-TIMEZONE", c.TimeZone)
+	}
+
+	stamp := time.Now().UTC().Format(dateTimeFormat)
+
+	for _, ev := range c.Events {
+		e.line("BEGIN", "VEVENT")
+		e.line("UID", ev.UID)
+		e.line("DTSTAMP", stamp)
+
+		if ev.AllDay {
+			e.line("DTSTART;VALUE=DATE", ev.Start.Format(dateFormat))
+			e.line("DTEND;VALUE=DATE", ev.End.Format(dateFormat))
+		} else {
+			e.line("DTSTART", ev.Start.UTC().Format(dateTimeFormat))
+			e.line("DTEND", ev.End.UTC().Format(dateTimeFormat))
+		}
+
+		e.line("SUMMARY", escape(ev.Summary))
+
+		if ev.Description != "" {
+			e.line("DESCRIPTION", escape(ev.Description))
+		}
+
+		if ev.Location != "" {
+			e.line("LOCATION", escape(ev.Location))
+		}
+
+		for _, a := range ev.Alarms {
+			description := a.Description
+			if description == "" {
+				description = ev.Summary
+			}
+
+			e.line("BEGIN", "VALARM")
+			e.line("ACTION", "DISPLAY")
+			e.line("DESCRIPTION", escape(description))
+			e.line("TRIGGER", "-"+duration(a.Before))
+			e.line("END", "VALARM")
+		}
+
+		e.line("END", "VEVENT")
+	}
+
+	e.line("END", "VCALENDAR")
+
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.w.Flush()
+}
+
+// encoder writes content lines and keeps the first error that occurs
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+// line will write a content line folded to lines of at most 75 octets
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+
+	_, e.err = e.w.WriteString(fold(name+":"+value) + "\r\n")
+}
+
+// fold will split a content line longer than 75 octets into multiple lines
+// where each continuation line starts with a space. Lines are never split
+// within a multi byte character.
+func fold(line string) string {
+	if len(line) <= lineLength {
+		return line
+	}
+
+	var (
+		folded strings.Builder
+		length int
+	)
+
+	for _, r := range line {
+		size := len(string(r))
+
+		if length+size > lineLength {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(r)
+		length += size
+	}
+
+	return folded.String()
+}
+
+// escape will escape a text value
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// duration will format a duration as an iCalendar duration, i.e. PT1H30M
+func duration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+
+	hours := d / time.Hour
+	d -= hours * time.Hour
+
+	minutes := d / time.Minute
+
+	s := "P"
+	if days > 0 {
+		s += fmt.Sprintf("%dD", days)
+	}
+
+	if hours > 0 || minutes > 0 || days == 0 {
+		s += "T"
+
+		if hours > 0 {
+			s += fmt.Sprintf("%dH", hours)
+		}
+
+		if minutes > 0 || hours == 0 {
+			s += fmt.Sprintf("%dM", minutes)
+		}
+	}
+
+	return s
+}
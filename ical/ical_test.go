@@ -0,0 +1,73 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncode(t *testing.T) {
+	Convey("Given a calendar with an event", t, func() {
+		stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+		c := Calendar{
+			ProdID: "-//laundry//EN",
+			Name:   "Laundry",
+			Events: []Event{
+				{
+					UID:         "booking-1@laundry",
+					Start:       time.Date(2018, 5, 7, 7, 0, 0, 0, stockholm),
+					End:         time.Date(2018, 5, 7, 10, 0, 0, 0, stockholm),
+					Summary:     "Laundry",
+					Description: "Washer 1, Dryer 1",
+					Alarms: []Alarm{
+						{Before: 30 * time.Minute},
+						{Before: 25 * time.Hour},
+					},
+				},
+			},
+		}
+
+		var buf bytes.Buffer
+		err := c.Encode(&buf)
+		ics := buf.String()
+
+		Convey("The calendar is encoded with CRLF line endings", func() {
+			So(err, ShouldBeNil)
+			So(ics, ShouldStartWith, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n")
+			So(ics, ShouldEndWith, "END:VCALENDAR\r\n")
+		})
+
+		Convey("Event times are written in UTC", func() {
+			So(ics, ShouldContainSubstring, "DTSTART:20180507T050000Z\r\n")
+			So(ics, ShouldContainSubstring, "DTEND:20180507T080000Z\r\n")
+		})
+
+		Convey("Text values are escaped", func() {
+			So(ics, ShouldContainSubstring, `DESCRIPTION:Washer 1\, Dryer 1`)
+		})
+
+		Convey("Alarms are triggered before the event starts", func() {
+			So(strings.Count(ics, "BEGIN:VALARM"), ShouldEqual, 2)
+			So(ics, ShouldContainSubstring, "TRIGGER:-PT30M\r\n")
+			So(ics, ShouldContainSubstring, "TRIGGER:-P1DT1H\r\n")
+		})
+	})
+}
+
+func TestFold(t *testing.T) {
+	Convey("Given a line longer than 75 octets", t, func() {
+		line := "DESCRIPTION:" + strings.Repeat("å", 50)
+
+		Convey("The line is folded without splitting characters", func() {
+			lines := strings.Split(fold(line), "\r\n")
+
+			So(len(lines), ShouldEqual, 2)
+			So(len(lines[0]), ShouldBeLessThanOrEqualTo, 75)
+			So(lines[1], ShouldStartWith, " å")
+		})
+	})
+}
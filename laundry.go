@@ -10,10 +10,12 @@ package laundry
 import (
 	"database/sql"
 	"encoding/json"
+	"net/http"
 	"time"
 
+	"github.com/bombsimon/laundry/config"
 	"github.com/bombsimon/laundry/errors"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 // NullString represents an embedded sql.NullString on which we
@@ -48,12 +50,147 @@ func (ns *NullString) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// NullInt64 represents an embedded sql.NullInt64 on which we
+// can implement a custom JSON marshaller
+type NullInt64 struct {
+	sql.NullInt64
+}
+
+// MarshalJSON will make sure NullInt64s are marshalled correct
+func (ni *NullInt64) MarshalJSON() ([]byte, error) {
+	if ni.Valid {
+		return json.Marshal(ni.Int64)
+	}
+
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON will make sure NullInt64s are unmarshalled correct
+func (ni *NullInt64) UnmarshalJSON(data []byte) error {
+	var i *int64
+
+	if err := json.Unmarshal(data, &i); err != nil {
+		return errors.New(err)
+	}
+
+	if i == nil {
+		*ni = NullInt64{sql.NullInt64{Int64: 0, Valid: false}}
+		return nil
+	}
+
+	*ni = NullInt64{sql.NullInt64{Int64: *i, Valid: true}}
+
+	return nil
+}
+
+// NullTime represents an embedded mysql.NullTime on which we
+// can implement a custom JSON marshaller
+type NullTime struct {
+	mysql.NullTime
+}
+
+// MarshalJSON will make sure NullTimes are marshalled correct
+func (nt *NullTime) MarshalJSON() ([]byte, error) {
+	if nt.Valid {
+		return json.Marshal(nt.Time)
+	}
+
+	return []byte("null"), nil
+}
+
+// UnmarshalJSON will make sure NullTimes are unmarshalled correct
+func (nt *NullTime) UnmarshalJSON(data []byte) error {
+	var t *time.Time
+
+	if err := json.Unmarshal(data, &t); err != nil {
+		return errors.New(err)
+	}
+
+	if t == nil {
+		*nt = NullTime{mysql.NullTime{Time: time.Time{}, Valid: false}}
+		return nil
+	}
+
+	*nt = NullTime{mysql.NullTime{Time: *t, Valid: true}}
+
+	return nil
+}
+
 func dateIntervals(start, end string) (*time.Time, *time.Time, *errors.LaundryError) {
 	return interval("2006-01-02", start, end, true)
 }
 
-func timeIntervals(start, end string) (*time.Time, *time.Time, *errors.LaundryError) {
-	return interval("15:04:05", start, end, true)
+// slotTimes validates the start- and end time of a slot formatted as HH:MM:SS
+// and returns the time since midnight the slot starts and the length of the
+// slot. An end time before the start time ends the day after.
+func slotTimes(start, end string) (time.Duration, time.Duration, *errors.LaundryError) {
+	sOffset, err := clockDuration(start)
+	if err != nil {
+		return 0, 0, errors.New("Invalid start time").WithStatus(http.StatusBadRequest).CausedBy(err)
+	}
+
+	eOffset, err := clockDuration(end)
+	if err != nil {
+		return 0, 0, errors.New("Invalid end time").WithStatus(http.StatusBadRequest).CausedBy(err)
+	}
+
+	if sOffset == eOffset {
+		return 0, 0, errors.New("Start time cannot be the same as end time").WithStatus(http.StatusBadRequest)
+	}
+
+	if eOffset < sOffset {
+		eOffset += 24 * time.Hour
+	}
+
+	return sOffset, eOffset - sOffset, nil
+}
+
+// clockDuration returns the time since midnight for a time formatted as
+// HH:MM:SS
+func clockDuration(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04:05", clock)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second, nil
+}
+
+// atClock returns the wall clock time in the building time zone at the given
+// offset from midnight at the date. Offsets past midnight rolls over to the
+// day after.
+func atClock(date time.Time, offset time.Duration) time.Time {
+	y, m, d := date.Date()
+
+	return time.Date(
+		y, m, d,
+		int(offset/time.Hour),
+		int(offset%time.Hour/time.Minute),
+		int(offset%time.Minute/time.Second),
+		0, buildingLocation(),
+	)
+}
+
+// buildingLocation returns the configured time zone of the building
+func buildingLocation() *time.Location {
+	return config.GetConfig().Location()
+}
+
+// civilDate returns the date of t as midnight UTC. All dates such as booking
+// dates and schedule keys are represented like this, the same way as DATE
+// columns are read from the database, and are only converted to a point in
+// time in the building time zone.
+func civilDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// today returns the current date in the building time zone
+func today() time.Time {
+	return civilDate(time.Now().In(buildingLocation()))
 }
 
 func interval(format, start, end string, ordered bool) (*time.Time, *time.Time, *errors.LaundryError) {
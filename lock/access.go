@@ -0,0 +1,135 @@
+package lock
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+)
+
+// Access represents the answer to a tag reader or a PIN pad. Access is only
+// allowed for bookers with a current booking in the room.
+type Access struct {
+	Allowed   bool       `json:"allowed"`
+	BookerID  int        `json:"booker_id,omitempty"`
+	BookingID int        `json:"booking_id,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// TagAccess will decide if the booker with the tag may enter the room at the
+// given time. When allowed the booker is checked in to the booking. The
+// attempt is recorded like any other unlock attempt.
+func TagAccess(tag string, roomID int, at time.Time, grace time.Duration) (*Access, *errors.LaundryError) {
+	if _, err := laundry.GetRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	booker, err := laundry.GetBookerByTag(tag)
+	if err != nil {
+		if err.Status != http.StatusNotFound {
+			return nil, err
+		}
+
+		return recordAccess(&Access{Reason: "Unknown tag"}, roomID, at)
+	}
+
+	a, err := bookerAccess(booker, roomID, at, grace, laundry.CheckInTag)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordAccess(a, roomID, at)
+}
+
+// PinAccess will decide if the booker with the identifier and pin entered on
+// a PIN pad may enter the room at the given time. The booker is looked up in
+// the property of the room. Like with tags the booker is checked in to the
+// booking when allowed.
+func PinAccess(identifier, pin string, roomID int, at time.Time, grace time.Duration) (*Access, *errors.LaundryError) {
+	room, err := laundry.GetRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	booker, err := laundry.AuthenticateBooker(room.PropertyID, identifier, pin)
+	if err != nil {
+		if err.Status != http.StatusUnauthorized {
+			return nil, err
+		}
+
+		return recordAccess(&Access{Reason: "Invalid identifier or pin"}, roomID, at)
+	}
+
+	a, err := bookerAccess(booker, roomID, at, grace, laundry.CheckInPin)
+	if err != nil {
+		return nil, err
+	}
+
+	return recordAccess(a, roomID, at)
+}
+
+// recordAccess will record the access as an unlock attempt. Failing to record
+// the attempt is only logged.
+func recordAccess(a *Access, roomID int, at time.Time) (*Access, *errors.LaundryError) {
+	attempt := Attempt{
+		RoomID:      roomID,
+		AttemptedAt: at,
+		Allowed:     a.Allowed,
+	}
+
+	if a.BookerID > 0 {
+		attempt.BookerID.Int64, attempt.BookerID.Valid = int64(a.BookerID), true
+	}
+
+	if a.BookingID > 0 {
+		attempt.BookingID.Int64, attempt.BookingID.Valid = int64(a.BookingID), true
+	}
+
+	if a.Reason != "" {
+		attempt.Reason.String, attempt.Reason.Valid = a.Reason, true
+	}
+
+	if rErr := addAttempt(&attempt); rErr != nil {
+		log.GetLogger().Errorf("Could not record access: %s", rErr)
+	}
+
+	return a, nil
+}
+
+// bookerAccess will find the current booking for the booker and check in to
+// it with the given source
+func bookerAccess(booker *laundry.Booker, roomID int, at time.Time, grace time.Duration, source laundry.CheckInSource) (*Access, *errors.LaundryError) {
+	a := Access{
+		BookerID: booker.ID,
+	}
+
+	if booker.ErasedAt.Valid {
+		a.Reason = "Booker is erased"
+		return &a, nil
+	}
+
+	booking, err := laundry.CurrentBooking(booker.ID, roomID, at, grace)
+	if err != nil {
+		return nil, err
+	}
+
+	if booking == nil {
+		a.Reason = "No booking in the room now"
+		return &a, nil
+	}
+
+	if _, err := laundry.AddCheckIn(booking.ID, source, at); err != nil {
+		return nil, err
+	}
+
+	until := booking.Slot.EndsAt(booking.BookDate).Add(grace)
+
+	a.Allowed = true
+	a.BookingID = booking.ID
+	a.Until = &until
+
+	return &a, nil
+}
@@ -0,0 +1,112 @@
+package lock
+
+import (
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// Attempt represents a recorded attempt to unlock the door to a room. Reason
+// holds why the attempt was denied or failed.
+type Attempt struct {
+	ID          int                `db:"id"           json:"id"`
+	RoomID      int                `db:"id_rooms"     json:"room_id"`
+	BookerID    laundry.NullInt64  `db:"id_booker"    json:"booker_id"`
+	BookingID   laundry.NullInt64  `db:"id_bookings"  json:"booking_id"`
+	AttemptedAt time.Time          `db:"attempted_at" json:"attempted_at"`
+	Allowed     bool               `db:"allowed"      json:"allowed"`
+	Reason      laundry.NullString `db:"reason"       json:"reason"`
+}
+
+// Recorded wraps a lock and records every attempt to unlock it, allowed or
+// not.
+type Recorded struct {
+	Lock Lock
+}
+
+// Unlock will unlock the wrapped lock and record the result
+func (rl Recorded) Unlock(r *Request) *errors.LaundryError {
+	err := rl.Lock.Unlock(r)
+
+	a := Attempt{
+		RoomID:      r.RoomID,
+		AttemptedAt: r.At,
+		Allowed:     err == nil,
+	}
+
+	if r.Booker != nil {
+		a.BookerID.Int64, a.BookerID.Valid = int64(r.Booker.ID), true
+	}
+
+	if r.BookingID > 0 {
+		a.BookingID.Int64, a.BookingID.Valid = int64(r.BookingID), true
+	}
+
+	if err != nil {
+		a.Reason.String, a.Reason.Valid = err.Reasons[0], true
+	}
+
+	if rErr := addAttempt(&a); rErr != nil {
+		log.GetLogger().Errorf("Could not record unlock attempt: %s", rErr)
+	}
+
+	return err
+}
+
+// GetAttempts will return all unlock attempts for a room, the latest first
+func GetAttempts(roomID int) ([]Attempt, *errors.LaundryError) {
+	if _, err := laundry.GetRoom(roomID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var attempts = []Attempt{}
+
+	err := db.From("unlock_attempts").
+		Where(goqu.Ex{
+			"id_rooms": roomID,
+		}).
+		Order(goqu.I("attempted_at").Desc(), goqu.I("id").Desc()).
+		ScanStructs(&attempts)
+
+	if err != nil {
+		return nil, errors.New("Could not get unlock attempts").CausedBy(err)
+	}
+
+	return attempts, nil
+}
+
+// addAttempt will record an unlock attempt
+func addAttempt(a *Attempt) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	insert := db.From("unlock_attempts").Insert(goqu.Record{
+		"id_rooms":     a.RoomID,
+		"id_booker":    a.BookerID,
+		"id_bookings":  a.BookingID,
+		"attempted_at": a.AttemptedAt,
+		"allowed":      a.Allowed,
+		"reason":       a.Reason,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return errors.New("Could not record unlock attempt").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return errors.New(err)
+	}
+
+	a.ID = int(lastID)
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package lock
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/errors"
+)
+
+// BookedSlot wraps a lock which is only unlocked for bookers with a booking
+// in the room at the time of the request. The door is unlocked from Grace
+// before the slot starts until Grace after it ends.
+type BookedSlot struct {
+	Lock  Lock
+	Grace time.Duration
+}
+
+// Unlock will unlock the wrapped lock if the booker has a current booking
+func (b BookedSlot) Unlock(r *Request) *errors.LaundryError {
+	if r.Booker == nil {
+		return errors.New("Only bookers may unlock the door").WithStatus(http.StatusForbidden)
+	}
+
+	booking, err := laundry.CurrentBooking(r.Booker.ID, r.RoomID, r.At, b.Grace)
+	if err != nil {
+		return err
+	}
+
+	if booking == nil {
+		return errors.New("Booker with id %d has no booking in room %d now", r.Booker.ID, r.RoomID).WithStatus(http.StatusForbidden)
+	}
+
+	r.BookingID = booking.ID
+	r.Until = booking.Slot.EndsAt(booking.BookDate).Add(b.Grace)
+
+	return b.Lock.Unlock(r)
+}
@@ -0,0 +1,67 @@
+/*
+Package lock implements unlocking of the door to a laundry room. A Lock may
+be a driver talking to an actual lock or wrap another Lock to decide who may
+unlock it, such as only bookers during their booked slot.
+*/
+package lock
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/errors"
+)
+
+// Request represents a booker asking to unlock the door to a room at a given
+// time. Until and BookingID are set when the request is allowed.
+type Request struct {
+	RoomID    int
+	Booker    *laundry.Booker
+	At        time.Time
+	Until     time.Time
+	BookingID int
+}
+
+// Lock represents a door lock which may be unlocked. A denied request returns
+// an error with status http.StatusForbidden.
+type Lock interface {
+	Unlock(r *Request) *errors.LaundryError
+}
+
+// New will create the lock configured in c. The configured driver is only
+// unlocked during booked slots and all attempts are recorded.
+func New(c config.Lock) (Lock, *errors.LaundryError) {
+	var driver Lock
+
+	switch c.Driver {
+	case "webhook":
+		if c.URL == "" {
+			return nil, errors.New("Missing URL for webhook lock").WithStatus(http.StatusInternalServerError)
+		}
+
+		driver = NewWebhook(c.URL, c.Secret)
+	case "simulator":
+		driver = NewSimulator()
+	case "":
+		driver = Disabled{}
+	default:
+		return nil, errors.New("Unknown lock driver '%s'", c.Driver).WithStatus(http.StatusInternalServerError)
+	}
+
+	return Recorded{
+		Lock: BookedSlot{
+			Lock:  driver,
+			Grace: time.Duration(c.Grace) * time.Minute,
+		},
+	}, nil
+}
+
+// Disabled is a lock which never unlocks, used when no lock is configured
+type Disabled struct{}
+
+// Unlock will always fail since there is no lock
+func (Disabled) Unlock(r *Request) *errors.LaundryError {
+	return errors.New("No lock is configured").WithStatus(http.StatusNotImplemented)
+}
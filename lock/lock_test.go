@@ -0,0 +1,101 @@
+package lock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSimulator(t *testing.T) {
+	Convey("Given a simulated lock", t, func() {
+		s := NewSimulator()
+		now := time.Date(2018, 5, 7, 7, 0, 0, 0, time.UTC)
+
+		Convey("Doors are locked until unlocked", func() {
+			So(s.Unlocked(1, now), ShouldBeFalse)
+
+			err := s.Unlock(&Request{RoomID: 1, At: now, Until: now.Add(3 * time.Hour)})
+
+			So(err, ShouldBeNil)
+			So(s.Unlocked(1, now.Add(time.Hour)), ShouldBeTrue)
+			So(s.Unlocked(1, now.Add(3*time.Hour)), ShouldBeFalse)
+			So(s.Unlocked(2, now), ShouldBeFalse)
+		})
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	Convey("Given a lock controller", t, func() {
+		var (
+			received webhookRequest
+			token    string
+			status   = http.StatusOK
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token = r.Header.Get("Authorization")
+			json.NewDecoder(r.Body).Decode(&received)
+
+			w.WriteHeader(status)
+		}))
+
+		defer server.Close()
+
+		wh := NewWebhook(server.URL, "secret")
+		until := time.Date(2018, 5, 7, 10, 10, 0, 0, time.UTC)
+
+		Convey("The controller is called with the room and until when to unlock", func() {
+			err := wh.Unlock(&Request{RoomID: 1, Booker: &laundry.Booker{ID: 2}, Until: until})
+
+			So(err, ShouldBeNil)
+			So(token, ShouldEqual, "Bearer secret")
+			So(received.RoomID, ShouldEqual, 1)
+			So(received.BookerID, ShouldEqual, 2)
+			So(received.Until.Equal(until), ShouldBeTrue)
+		})
+
+		Convey("Responses other than 2xx are failures", func() {
+			status = http.StatusInternalServerError
+
+			err := wh.Unlock(&Request{RoomID: 1, Until: until})
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusBadGateway)
+		})
+	})
+}
+
+func TestNew(t *testing.T) {
+	Convey("Given lock configurations", t, func() {
+		Convey("Known drivers are wrapped to only unlock booked slots", func() {
+			l, err := New(config.Lock{Driver: "simulator", Grace: 10})
+
+			So(err, ShouldBeNil)
+
+			bs := l.(Recorded).Lock.(BookedSlot)
+			So(bs.Grace, ShouldEqual, 10*time.Minute)
+			So(bs.Lock, ShouldHaveSameTypeAs, &Simulator{})
+		})
+
+		Convey("Invalid configurations are rejected", func() {
+			_, err := New(config.Lock{Driver: "webhook"})
+			So(err, ShouldNotBeNil)
+
+			_, err = New(config.Lock{Driver: "magic"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Without a driver the door can't be unlocked", func() {
+			err := Disabled{}.Unlock(&Request{RoomID: 1})
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusNotImplemented)
+		})
+	})
+}
@@ -0,0 +1,43 @@
+package lock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+)
+
+// Simulator is a lock driver keeping the state of each door in memory, used
+// for testing without an actual lock.
+type Simulator struct {
+	mu       sync.Mutex
+	unlocked map[int]time.Time
+}
+
+// NewSimulator will create a simulator with all doors locked
+func NewSimulator() *Simulator {
+	return &Simulator{
+		unlocked: map[int]time.Time{},
+	}
+}
+
+// Unlock will unlock the door to the room until the requested time
+func (s *Simulator) Unlock(r *Request) *errors.LaundryError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unlocked[r.RoomID] = r.Until
+
+	log.GetLogger().Infof("simulated lock: room %d unlocked until %s", r.RoomID, r.Until.Format(time.RFC3339))
+
+	return nil
+}
+
+// Unlocked returns true if the door to the room is unlocked at the given time
+func (s *Simulator) Unlocked(roomID int, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return at.Before(s.unlocked[roomID])
+}
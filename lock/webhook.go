@@ -0,0 +1,74 @@
+package lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/errors"
+)
+
+// Webhook is a lock driver for generic lock controllers. The controller is
+// called with a POST request holding the room and until when the door should
+// be unlocked as JSON. Any status but 2xx is treated as a failure.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// webhookRequest represents the body sent to the lock controller
+type webhookRequest struct {
+	RoomID   int       `json:"room_id"`
+	BookerID int       `json:"booker_id"`
+	Until    time.Time `json:"until"`
+}
+
+// NewWebhook will create a webhook lock calling url. If secret is set it's
+// sent as a bearer token.
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Unlock will call the lock controller
+func (wh *Webhook) Unlock(r *Request) *errors.LaundryError {
+	body := webhookRequest{
+		RoomID: r.RoomID,
+		Until:  r.Until,
+	}
+
+	if r.Booker != nil {
+		body.BookerID = r.Booker.ID
+	}
+
+	jb, _ := json.Marshal(body)
+
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(jb))
+	if err != nil {
+		return errors.New("Could not create lock request").WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if wh.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+wh.Secret)
+	}
+
+	resp, err := wh.Client.Do(req)
+	if err != nil {
+		return errors.New("Could not reach lock controller").WithStatus(http.StatusBadGateway).CausedBy(err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Lock controller responded with status %d", resp.StatusCode).WithStatus(http.StatusBadGateway)
+	}
+
+	return nil
+}
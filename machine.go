@@ -12,11 +12,47 @@ import (
 	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
 )
 
-// Machine represents a laundry machine, holding an info line and a working state
+// MachineType represents what kind of laundry machine a Machine is
+type MachineType string
+
+// The different kind of machines that may be found in a laundry room
+const (
+	MachineWasher        MachineType = "washer"
+	MachineDryer         MachineType = "dryer"
+	MachineTumbler       MachineType = "tumbler"
+	MachineDryingCabinet MachineType = "drying_cabinet"
+	MachineMangle        MachineType = "mangle"
+)
+
+// MachineTypes holds all valid machine types
+var MachineTypes = []MachineType{
+	MachineWasher,
+	MachineDryer,
+	MachineTumbler,
+	MachineDryingCabinet,
+	MachineMangle,
+}
+
+// Machine represents a laundry machine, holding an info line, a working state
+// and the capabilities of the machine. A machine with faults which are not yet
+// resolved is never working.
 type Machine struct {
-	ID      int    `db:"id"      json:"id"`
-	Info    string `db:"info"    json:"info"`
-	Working bool   `db:"working" json:"working"`
+	ID       int         `db:"id"       json:"id"`
+	RoomID   int         `db:"id_rooms" json:"room_id"`
+	Info     string      `db:"info"     json:"info"`
+	Working  bool        `db:"working"  json:"working"`
+	Type     MachineType `db:"type"     json:"type"`
+	Capacity float64     `db:"capacity" json:"capacity"` // Kilograms
+	Programs []Program   `db:"-"        json:"programs"`
+}
+
+// Program represents a program available on a Machine and how long time it
+// takes to run it
+type Program struct {
+	ID        int    `db:"id"          json:"id"`
+	MachineID int    `db:"id_machines" json:"-"`
+	Name      string `db:"name"        json:"name"`
+	Duration  int    `db:"duration"    json:"duration"` // Minutes
 }
 
 // UnmarshalJSON overrides the default unmarshaling to determine weather the
@@ -37,13 +73,21 @@ func (m *Machine) UnmarshalJSON(data []byte) error {
 		err = fmt.Errorf("Missing parameter working")
 	default:
 		m1 := struct {
-			Info    string
-			Working bool
+			RoomID   int `json:"room_id"`
+			Info     string
+			Working  bool
+			Type     MachineType `json:"type"`
+			Capacity float64     `json:"capacity"`
+			Programs []Program   `json:"programs"`
 		}{}
 		err = json.Unmarshal(data, &m1)
 
+		m.RoomID = m1.RoomID
 		m.Info = m1.Info
 		m.Working = m1.Working
+		m.Type = m1.Type
+		m.Capacity = m1.Capacity
+		m.Programs = m1.Programs
 	}
 
 	if err != nil {
@@ -53,16 +97,41 @@ func (m *Machine) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// GetMachines returns a list of all Machines added in the database. If there are
-// no machines, an empty list will be returned. The same applies if an error occurs.
-func GetMachines() ([]Machine, *errors.LaundryError) {
+// GetMachines returns a list of all Machines in a room. If there are no
+// machines, an empty list will be returned. The same applies if an error
+// occurs.
+func GetMachines(roomID int) ([]Machine, *errors.LaundryError) {
 	db := database.GetGoqu()
 
+	query := db.From("machines").Where(goqu.Ex{
+		"id_rooms": roomID,
+	})
+
 	var machines []Machine
-	if err := db.From("machines").ScanStructs(&machines); err != nil {
+	if err := query.ScanStructs(&machines); err != nil {
 		return machines, errors.New("Could not get machines").CausedBy(err)
 	}
 
+	faulty, fErr := faultyMachines()
+	if fErr != nil {
+		return machines, fErr
+	}
+
+	markFaulty(machines, faulty)
+
+	var programs []Program
+	if err := db.From("machine_programs").Order(goqu.I("duration").Asc()).ScanStructs(&programs); err != nil {
+		return machines, errors.New("Could not get machine programs").CausedBy(err)
+	}
+
+	for i := range machines {
+		for _, p := range programs {
+			if p.MachineID == machines[i].ID {
+				machines[i].Programs = append(machines[i].Programs, p)
+			}
+		}
+	}
+
 	return machines, nil
 }
 
@@ -84,6 +153,22 @@ func GetMachine(id int) (*Machine, *errors.LaundryError) {
 		return nil, errors.New("Machine with id %d not found", id).WithStatus(http.StatusNotFound)
 	}
 
+	faulty, fErr := faultyMachines()
+	if fErr != nil {
+		return nil, fErr
+	}
+
+	if faulty[m.ID] {
+		m.Working = false
+	}
+
+	programs, lErr := machinePrograms(m.ID)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	m.Programs = programs
+
 	return &m, nil
 }
 
@@ -94,11 +179,22 @@ func AddMachine(m *Machine) (*Machine, *errors.LaundryError) {
 		return nil, errors.New("Missing info in request")
 	}
 
+	if err := validMachine(m); err != nil {
+		return nil, err
+	}
+
+	if _, err := GetRoom(m.RoomID); err != nil {
+		return nil, err
+	}
+
 	db := database.GetGoqu()
 
 	insert := db.From("machines").Insert(goqu.Record{
-		"info":    m.Info,
-		"working": m.Working,
+		"id_rooms": m.RoomID,
+		"info":     m.Info,
+		"working":  m.Working,
+		"type":     string(m.Type),
+		"capacity": m.Capacity,
 	})
 
 	row, err := insert.Exec()
@@ -113,6 +209,10 @@ func AddMachine(m *Machine) (*Machine, *errors.LaundryError) {
 
 	m.ID = int(lastID)
 
+	if err := setMachinePrograms(m); err != nil {
+		return nil, err
+	}
+
 	return m, nil
 }
 
@@ -128,8 +228,24 @@ func UpdateMachine(id int, um *Machine) (*Machine, *errors.LaundryError) {
 		return nil, errors.New("Missing field info").WithStatus(http.StatusBadRequest)
 	}
 
+	if err := validMachine(um); err != nil {
+		return nil, err
+	}
+
+	// Only move the machine to another room if requested
+	if um.RoomID > 0 && um.RoomID != m.RoomID {
+		if _, err := GetRoom(um.RoomID); err != nil {
+			return nil, err
+		}
+
+		m.RoomID = um.RoomID
+	}
+
 	m.Info = um.Info
 	m.Working = um.Working
+	m.Type = um.Type
+	m.Capacity = um.Capacity
+	m.Programs = um.Programs
 
 	db := database.GetGoqu()
 
@@ -138,15 +254,24 @@ func UpdateMachine(id int, um *Machine) (*Machine, *errors.LaundryError) {
 			"id": m.ID,
 		}).
 		Update(goqu.Record{
-			"info":    m.Info,
-			"working": m.Working,
+			"id_rooms": m.RoomID,
+			"info":     m.Info,
+			"working":  m.Working,
+			"type":     string(m.Type),
+			"capacity": m.Capacity,
 		})
 
 	if _, err := update.Exec(); err != nil {
 		return nil, errors.New("Could not update machine with id %d", m.ID).CausedBy(err)
 	}
 
-	return m, nil
+	if err := setMachinePrograms(m); err != nil {
+		return nil, err
+	}
+
+	// Read the machine back since it's not working while it has faults which
+	// aren't resolved
+	return GetMachine(m.ID)
 }
 
 // RemoveMachine will remove a machine alltogether. If the Machine is related
@@ -176,3 +301,94 @@ func RemoveMachineByID(id int) *errors.LaundryError {
 
 	return RemoveMachine(m)
 }
+
+// Valid returns true if the MachineType is one of the known machine types
+func (t MachineType) Valid() bool {
+	for _, mt := range MachineTypes {
+		if t == mt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validMachine(m *Machine) *errors.LaundryError {
+	if !m.Type.Valid() {
+		return errors.New("Invalid machine type '%s'", m.Type).WithStatus(http.StatusBadRequest)
+	}
+
+	if m.Capacity < 0 {
+		return errors.New("Capacity cannot be negative").WithStatus(http.StatusBadRequest)
+	}
+
+	for _, p := range m.Programs {
+		if p.Name == "" {
+			return errors.New("Missing name for program").WithStatus(http.StatusBadRequest)
+		}
+
+		if p.Duration <= 0 {
+			return errors.New("Invalid duration for program '%s'", p.Name).WithStatus(http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
+
+// machinePrograms will return all programs for a machine, the shortest first
+func machinePrograms(machineID int) ([]Program, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var programs []Program
+	err := db.From("machine_programs").
+		Where(goqu.Ex{
+			"id_machines": machineID,
+		}).
+		Order(goqu.I("duration").Asc()).
+		ScanStructs(&programs)
+
+	if err != nil {
+		return programs, errors.New("Could not get programs for machine with id %d", machineID).CausedBy(err)
+	}
+
+	return programs, nil
+}
+
+// setMachinePrograms will replace all programs for the machine with the
+// programs set on the Machine
+func setMachinePrograms(m *Machine) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("machine_programs").
+		Where(goqu.Ex{
+			"id_machines": m.ID,
+		}).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove programs for machine with id %d", m.ID).CausedBy(err)
+	}
+
+	for i, p := range m.Programs {
+		insert := db.From("machine_programs").Insert(goqu.Record{
+			"id_machines": m.ID,
+			"name":        p.Name,
+			"duration":    p.Duration,
+		})
+
+		row, err := insert.Exec()
+		if err != nil {
+			return errors.New("Could not create program for machine with id %d", m.ID).CausedBy(err)
+		}
+
+		lastID, err := row.LastInsertId()
+		if err != nil {
+			return errors.New(err)
+		}
+
+		m.Programs[i].ID = int(lastID)
+		m.Programs[i].MachineID = m.ID
+	}
+
+	return nil
+}
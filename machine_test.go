@@ -0,0 +1,61 @@
+package laundry
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMachineTypes(t *testing.T) {
+	Convey("Given a slot with a washer and a dryer", t, func() {
+		slot := Slot{
+			ID: 1,
+			Machines: []Machine{
+				{ID: 1, Type: MachineWasher, Capacity: 8},
+				{ID: 2, Type: MachineDryer, Capacity: 8},
+			},
+		}
+
+		Convey("The slot has the types of its machines", func() {
+			So(slot.HasMachineType(MachineWasher), ShouldBeTrue)
+			So(slot.HasMachineType(MachineDryer), ShouldBeTrue)
+			So(slot.HasMachineType(MachineMangle), ShouldBeFalse)
+			So(Slot{}.HasMachineType(MachineWasher), ShouldBeFalse)
+		})
+
+		Convey("The limit per day applies to the machine types in the slot", func() {
+			maxPerDay := map[string]int{"washer": 1, "mangle": 1}
+
+			So(machineTypeLimit(slot, nil, maxPerDay), ShouldBeNil)
+			So(machineTypeLimit(slot, map[MachineType]int{MachineMangle: 3}, maxPerDay), ShouldBeNil)
+			So(machineTypeLimit(slot, map[MachineType]int{MachineDryer: 3}, maxPerDay), ShouldBeNil)
+
+			err := machineTypeLimit(slot, map[MachineType]int{MachineWasher: 1}, maxPerDay)
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusConflict)
+		})
+
+		Convey("Without limits any number of bookings are allowed", func() {
+			So(machineTypeLimit(slot, map[MachineType]int{MachineWasher: 10}, nil), ShouldBeNil)
+		})
+	})
+
+	Convey("Given machines with types, capacity and programs", t, func() {
+		Convey("Only known types are valid", func() {
+			So(validMachine(&Machine{Type: MachineWasher}), ShouldBeNil)
+			So(validMachine(&Machine{Type: "spaceship"}), ShouldNotBeNil)
+		})
+
+		Convey("Capacity cannot be negative", func() {
+			So(validMachine(&Machine{Type: MachineDryer, Capacity: -1}), ShouldNotBeNil)
+		})
+
+		Convey("Programs must have a name and a duration", func() {
+			So(validMachine(&Machine{Type: MachineWasher, Programs: []Program{{Name: "Cotton", Duration: 90}}}), ShouldBeNil)
+			So(validMachine(&Machine{Type: MachineWasher, Programs: []Program{{Duration: 90}}}), ShouldNotBeNil)
+			So(validMachine(&Machine{Type: MachineWasher, Programs: []Program{{Name: "Cotton"}}}), ShouldNotBeNil)
+		})
+	})
+}
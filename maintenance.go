@@ -0,0 +1,175 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// MaintenanceWindow represents a scheduled period where a Machine is not
+// available for booking. Slots where all machines are under maintenance will
+// be closed for the dates in the window.
+type MaintenanceWindow struct {
+	ID          int        `db:"id"          json:"id"`
+	MachineID   int        `db:"id_machines" json:"machine_id"`
+	Start       time.Time  `db:"start_date"  json:"start"`
+	End         time.Time  `db:"end_date"    json:"end"`
+	Description NullString `db:"description" json:"description"`
+}
+
+// GetMaintenanceWindows will return a list of all maintenance windows
+func GetMaintenanceWindows() ([]MaintenanceWindow, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var windows []MaintenanceWindow
+	if err := db.From("maintenance_windows").ScanStructs(&windows); err != nil {
+		return windows, errors.New("Could not get maintenance windows").CausedBy(err)
+	}
+
+	return windows, nil
+}
+
+// GetMaintenanceWindow will return the MaintenanceWindow with passed ID if it
+// exists in the database.
+func GetMaintenanceWindow(id int) (*MaintenanceWindow, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var w MaintenanceWindow
+	found, err := db.From("maintenance_windows").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&w)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Maintenance window with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &w, nil
+}
+
+// AddMaintenanceWindow will schedule maintenance for a machine between the
+// start- and end date of the passed MaintenanceWindow.
+func AddMaintenanceWindow(w *MaintenanceWindow) (*MaintenanceWindow, *errors.LaundryError) {
+	if w.Start.After(w.End) {
+		return nil, errors.New("Start date cannot be after end date").WithStatus(http.StatusBadRequest)
+	}
+
+	if _, err := GetMachine(w.MachineID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("maintenance_windows").Insert(goqu.Record{
+		"id_machines": w.MachineID,
+		"start_date":  w.Start.Format("2006-01-02"),
+		"end_date":    w.End.Format("2006-01-02"),
+		"description": w.Description,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return nil, errors.New("Could not create maintenance window").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	w.ID = int(lastID)
+
+	return w, nil
+}
+
+// RemoveMaintenanceWindow will remove a scheduled maintenance window
+func RemoveMaintenanceWindow(w *MaintenanceWindow) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("maintenance_windows").Where(goqu.Ex{
+		"id": w.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove maintenance window with id %d", w.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveMaintenanceWindowByID will remove a maintenance window by its id
+func RemoveMaintenanceWindowByID(id int) *errors.LaundryError {
+	w, err := GetMaintenanceWindow(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveMaintenanceWindow(w)
+}
+
+// searchMaintenanceWindows will return all maintenance windows overlapping
+// the interval between start and end.
+func searchMaintenanceWindows(start, end time.Time) ([]MaintenanceWindow, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var windows []MaintenanceWindow
+	err := db.From("maintenance_windows").
+		Where(
+			goqu.L("start_date <= DATE(?)", end.Format("2006-01-02")),
+			goqu.L("end_date >= DATE(?)", start.Format("2006-01-02")),
+		).
+		ScanStructs(&windows)
+
+	if err != nil {
+		return windows, errors.New("Could not get maintenance windows").CausedBy(err)
+	}
+
+	return windows, nil
+}
+
+// inMaintenance returns true if the machine is under maintenance at the
+// given date.
+func inMaintenance(machineID int, date time.Time, windows []MaintenanceWindow) bool {
+	for _, w := range windows {
+		if w.MachineID != machineID {
+			continue
+		}
+
+		if !date.Before(w.Start) && !date.After(w.End) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyMaintenance will remove all machines under maintenance at the given
+// date from the slot. If the slot has machines but none of them are available
+// the slot will be marked as closed.
+func applyMaintenance(s *SlotWithBooker, date time.Time, windows []MaintenanceWindow) {
+	if len(s.Machines) == 0 {
+		return
+	}
+
+	var available []Machine
+
+	for _, m := range s.Machines {
+		if !inMaintenance(m.ID, date, windows) {
+			available = append(available, m)
+		}
+	}
+
+	s.Machines = available
+
+	if len(available) == 0 {
+		s.Closed = true
+	}
+}
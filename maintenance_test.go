@@ -0,0 +1,44 @@
+package laundry
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	Convey("Given a slot with two machines", t, func() {
+		monday := date("2018-05-07")
+
+		slots := []Slot{
+			{ID: 1, RoomID: 1, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true, Machines: []Machine{{ID: 1}, {ID: 2}}},
+		}
+
+		cases := []struct {
+			name      string
+			windows   []MaintenanceWindow
+			closed    bool
+			available int
+		}{
+			{"no machine", nil, false, 2},
+			{"one machine", []MaintenanceWindow{{MachineID: 1, Start: monday, End: monday}}, false, 1},
+			{"both machines", []MaintenanceWindow{{MachineID: 1, Start: monday, End: monday}, {MachineID: 2, Start: monday, End: monday}}, true, 0},
+			{"window ending the day before", []MaintenanceWindow{{MachineID: 1, Start: date("2018-05-01"), End: date("2018-05-06")}}, false, 2},
+			{"window starting the day after", []MaintenanceWindow{{MachineID: 1, Start: date("2018-05-08"), End: date("2018-05-10")}}, false, 2},
+			{"window spanning the date", []MaintenanceWindow{{MachineID: 2, Start: date("2018-05-01"), End: date("2018-05-31")}}, false, 1},
+			{"another machine", []MaintenanceWindow{{MachineID: 3, Start: monday, End: monday}}, false, 2},
+		}
+
+		for _, c := range cases {
+			c := c
+
+			Convey("With maintenance of "+c.name, func() {
+				ds := daySlots(monday, slots, nil, nil, c.windows)
+
+				So(len(ds), ShouldEqual, 1)
+				So(ds[0].Closed, ShouldEqual, c.closed)
+				So(len(ds[0].Machines), ShouldEqual, c.available)
+			})
+		}
+	})
+}
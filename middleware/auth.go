@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bombsimon/laundry"
+	"github.com/bombsimon/laundry/errors"
+)
+
+type callerKey struct{}
+
+// Authenticate will identify the caller of each request and store it in the
+// request context. Administrators and tag readers authenticates with a bearer
+// token and bookers with basic auth using their property and identifier as
+// username, i.e. 1/1001, and their pin. Requests without credentials are
+// anonymous while invalid credentials are rejected.
+func Authenticate() Adapter {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var caller laundry.Caller
+
+			auth := r.Header.Get("Authorization")
+
+			switch {
+			case auth == "":
+				// Anonymous caller
+			case strings.HasPrefix(auth, "Bearer "):
+				token := strings.TrimPrefix(auth, "Bearer ")
+
+				switch {
+				case laundry.AuthenticateAdmin(token):
+					caller.Admin = true
+				case laundry.AuthenticateReader(token):
+					caller.Reader = true
+				default:
+					unauthorized(errors.New("Invalid token").WithStatus(http.StatusUnauthorized), w)
+					return
+				}
+			default:
+				username, pin, ok := r.BasicAuth()
+				if !ok {
+					unauthorized(errors.New("Invalid authorization header").WithStatus(http.StatusUnauthorized), w)
+					return
+				}
+
+				propertyID, identifier, ok := bookerUsername(username)
+				if !ok {
+					unauthorized(errors.New("Invalid username, expected property and identifier").WithStatus(http.StatusUnauthorized), w)
+					return
+				}
+
+				booker, err := laundry.AuthenticateBooker(propertyID, identifier, pin)
+				if err != nil {
+					unauthorized(err, w)
+					return
+				}
+
+				caller.Booker = booker
+			}
+
+			ctx := context.WithValue(r.Context(), callerKey{}, caller)
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetCaller returns the caller stored in the request context by Authenticate.
+// If no caller is stored the caller is anonymous.
+func GetCaller(r *http.Request) laundry.Caller {
+	caller, _ := r.Context().Value(callerKey{}).(laundry.Caller)
+
+	return caller
+}
+
+// bookerUsername splits a username on the form <property id>/<identifier>
+func bookerUsername(username string) (int, string, bool) {
+	parts := strings.SplitN(username, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false
+	}
+
+	propertyID, err := strconv.Atoi(parts[0])
+	if err != nil || propertyID < 1 {
+		return 0, "", false
+	}
+
+	return propertyID, parts[1], true
+}
+
+func unauthorized(err *errors.LaundryError, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="laundry"`)
+	w.WriteHeader(err.Status)
+	w.Write(err.AsJSON())
+
+	if lrw, ok := w.(*LoggingResponseWriter); ok {
+		lrw.WriteError(err)
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBookerUsername(t *testing.T) {
+	Convey("Given a username with property and identifier", t, func() {
+		propertyID, identifier, ok := bookerUsername("2/1001")
+
+		Convey("Both parts are returned", func() {
+			So(ok, ShouldBeTrue)
+			So(propertyID, ShouldEqual, 2)
+			So(identifier, ShouldEqual, "1001")
+		})
+	})
+
+	Convey("Given usernames without a property", t, func() {
+		for _, username := range []string{"1001", "/1001", "a/1001", "0/1001", "2/"} {
+			_, _, ok := bookerUsername(username)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
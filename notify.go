@@ -1,5 +1,15 @@
 package laundry
 
+import (
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
 // NotificationType represents the different kind of notifications
 // that can be sent
 type NotificationType struct {
@@ -7,3 +17,69 @@ type NotificationType struct {
 	Name        string `db:"name"        json:"name"`
 	Description string `db:"description" json:"description"`
 }
+
+// Notification represents a notification sent to the booker a given number of
+// minutes ahead of a booked slot
+type Notification struct {
+	ID        int `db:"id"                    json:"id"`
+	TypeID    int `db:"id_notification_types" json:"type_id"`
+	BookingID int `db:"id_bookings"           json:"booking_id"`
+	Ahead     int `db:"ahead"                 json:"ahead"`
+}
+
+// FiresAt returns the time the notification should be sent for a booking of
+// the slot at the given date. The time is computed from when the slot starts
+// in the building time zone.
+func (n Notification) FiresAt(s Slot, bookDate time.Time) time.Time {
+	return s.StartsAt(bookDate).Add(-time.Duration(n.Ahead) * time.Minute)
+}
+
+// GetBookingNotifications will return the notifications set up for a booking
+func GetBookingNotifications(bookingID int) ([]Notification, *errors.LaundryError) {
+	if _, err := GetBooking(bookingID); err != nil {
+		return nil, err
+	}
+
+	byBooking, err := bookingNotifications([]int{bookingID})
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications = []Notification{}
+
+	return append(notifications, byBooking[bookingID]...), nil
+}
+
+// bookingNotifications will return the notifications for all bookings with
+// passed ids mapped by booking id
+func bookingNotifications(bookingIDs []int) (map[int][]Notification, *errors.LaundryError) {
+	var byBooking = make(map[int][]Notification)
+
+	if len(bookingIDs) == 0 {
+		return byBooking, nil
+	}
+
+	var ids []interface{}
+	for _, id := range bookingIDs {
+		ids = append(ids, id)
+	}
+
+	db := database.GetGoqu()
+
+	var notifications []Notification
+	err := db.From("notifications").
+		Where(
+			goqu.I("id_bookings").In(ids...),
+		).
+		ScanStructs(&notifications)
+
+	if err != nil {
+		return nil, errors.New("Could not get notifications").CausedBy(err)
+	}
+
+	for _, n := range notifications {
+		byBooking[n.BookingID] = append(byBooking[n.BookingID], n)
+	}
+
+	return byBooking, nil
+}
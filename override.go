@@ -0,0 +1,284 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// OverrideKind represents how a SlotOverride changes the weekly schedule
+type OverrideKind string
+
+// The different kind of overrides. A closure closes the whole room (or a
+// single slot), an extra slot adds a one-off slot and changed hours moves the
+// start- and end time of a slot for the dates in the override.
+const (
+	OverrideClosed OverrideKind = "closed"
+	OverrideExtra  OverrideKind = "extra"
+	OverrideHours  OverrideKind = "hours"
+)
+
+// SlotOverride represents an exception from the weekly recurring slots in a
+// room between a start- and end date, such as a holiday closure.
+type SlotOverride struct {
+	ID          int          `db:"id"          json:"id"`
+	RoomID      int          `db:"id_rooms"    json:"room_id"`
+	Kind        OverrideKind `db:"kind"        json:"kind"`
+	Start       time.Time    `db:"start_date"  json:"start"`
+	End         time.Time    `db:"end_date"    json:"end"`
+	SlotID      NullInt64    `db:"id_slots"    json:"slot_id"`
+	StartTime   NullString   `db:"start_time"  json:"start_time"`
+	EndTime     NullString   `db:"end_time"    json:"end_time"`
+	Description NullString   `db:"description" json:"description"`
+	Machines    []int        `db:"-"           json:"machines,omitempty"`
+}
+
+// GetSlotOverrides will return all overrides in a room.
+func GetSlotOverrides(roomID int) ([]SlotOverride, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	query := db.From("slot_overrides").
+		Where(goqu.Ex{"id_rooms": roomID}).
+		Order(goqu.I("start_date").Asc())
+
+	var overrides []SlotOverride
+	if err := query.ScanStructs(&overrides); err != nil {
+		return overrides, errors.New("Could not get overrides").CausedBy(err)
+	}
+
+	return overrides, nil
+}
+
+// GetSlotOverride will return the SlotOverride with passed ID if it exists
+func GetSlotOverride(id int) (*SlotOverride, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var o SlotOverride
+	found, err := db.From("slot_overrides").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&o)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Override with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &o, nil
+}
+
+// AddSlotOverride will add a new override to a room. An override adding an
+// extra slot will create a slot only held at the dates in the override with
+// the machines passed in the override.
+func AddSlotOverride(o *SlotOverride) (*SlotOverride, *errors.LaundryError) {
+	if err := validSlotOverride(o); err != nil {
+		return nil, err
+	}
+
+	if o.Kind == OverrideExtra {
+		s := Slot{
+			RoomID:  o.RoomID,
+			Weekday: int(o.Start.Weekday()),
+			Start:   o.StartTime.String,
+			End:     o.EndTime.String,
+		}
+
+		if _, err := addSlot(&s); err != nil {
+			return nil, err
+		}
+
+		if err := setSlotMachines(&s, o.Machines); err != nil {
+			return nil, err
+		}
+
+		o.SlotID.Int64, o.SlotID.Valid = int64(s.ID), true
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("slot_overrides").Insert(goqu.Record{
+		"id_rooms":    o.RoomID,
+		"kind":        string(o.Kind),
+		"start_date":  o.Start.Format("2006-01-02"),
+		"end_date":    o.End.Format("2006-01-02"),
+		"id_slots":    o.SlotID,
+		"start_time":  o.StartTime,
+		"end_time":    o.EndTime,
+		"description": o.Description,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return nil, errors.New("Could not create override").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	o.ID = int(lastID)
+
+	return o, nil
+}
+
+// RemoveSlotOverride will remove an override. If the override added an extra
+// slot the slot and it's bookings will be removed aswell.
+func RemoveSlotOverride(o *SlotOverride) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("slot_overrides").Where(goqu.Ex{
+		"id": o.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove override with id %d", o.ID).CausedBy(err)
+	}
+
+	if o.Kind == OverrideExtra && o.SlotID.Valid {
+		return RemoveSlotByID(int(o.SlotID.Int64))
+	}
+
+	return nil
+}
+
+// RemoveSlotOverrideByID will remove an override by the override id
+func RemoveSlotOverrideByID(id int) *errors.LaundryError {
+	o, err := GetSlotOverride(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveSlotOverride(o)
+}
+
+func validSlotOverride(o *SlotOverride) *errors.LaundryError {
+	if _, err := GetRoom(o.RoomID); err != nil {
+		return err
+	}
+
+	if o.Start.IsZero() || o.End.IsZero() {
+		return errors.New("Missing start or end date").WithStatus(http.StatusBadRequest)
+	}
+
+	if o.Start.After(o.End) {
+		return errors.New("Start date cannot be after end date").WithStatus(http.StatusBadRequest)
+	}
+
+	switch o.Kind {
+	case OverrideClosed:
+		// A closure may close a single slot or the whole room
+		if !o.SlotID.Valid {
+			return nil
+		}
+	case OverrideHours:
+		if !o.SlotID.Valid {
+			return errors.New("Missing slot id for changed hours").WithStatus(http.StatusBadRequest)
+		}
+
+		if _, _, err := slotTimes(o.StartTime.String, o.EndTime.String); err != nil {
+			return err
+		}
+	case OverrideExtra:
+		if _, _, err := slotTimes(o.StartTime.String, o.EndTime.String); err != nil {
+			return err
+		}
+
+		// The slot will be created with the override
+		o.SlotID.Valid = false
+
+		return nil
+	default:
+		return errors.New("Invalid override kind '%s'", o.Kind).WithStatus(http.StatusBadRequest)
+	}
+
+	s, err := GetSlot(int(o.SlotID.Int64))
+	if err != nil {
+		return err
+	}
+
+	if s.RoomID != o.RoomID {
+		return errors.New("Slot with id %d is not in room %d", s.ID, o.RoomID).WithStatus(http.StatusBadRequest)
+	}
+
+	return nil
+}
+
+// searchSlotOverrides will return all overrides in a room overlapping the
+// interval between start and end.
+func searchSlotOverrides(roomID int, start, end time.Time) ([]SlotOverride, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	query := db.From("slot_overrides").
+		Where(
+			goqu.L("start_date <= DATE(?)", end.Format("2006-01-02")),
+			goqu.L("end_date >= DATE(?)", start.Format("2006-01-02")),
+			goqu.Ex{"id_rooms": roomID},
+		)
+
+	var overrides []SlotOverride
+	if err := query.ScanStructs(&overrides); err != nil {
+		return overrides, errors.New("Could not get overrides").CausedBy(err)
+	}
+
+	return overrides, nil
+}
+
+// covers returns true if the override applies to the slot at the given date
+func (o SlotOverride) covers(s Slot, date time.Time) bool {
+	if o.RoomID != s.RoomID {
+		return false
+	}
+
+	if o.SlotID.Valid && int(o.SlotID.Int64) != s.ID {
+		return false
+	}
+
+	return !date.Before(o.Start) && !date.After(o.End)
+}
+
+// slotHeld returns true if the slot is held at the given date. Recurring
+// slots are held on their week day if their slot set is in use while other
+// slots are only held at the dates covered by an extra slot override.
+func slotHeld(s Slot, date time.Time, sets map[int]SlotSet, overrides []SlotOverride) bool {
+	if s.Recurring {
+		if date.Weekday() != time.Weekday(s.Weekday) {
+			return false
+		}
+
+		return !s.SetID.Valid || activeSlotSet(s.RoomID, date, sets) == int(s.SetID.Int64)
+	}
+
+	for _, o := range overrides {
+		if o.Kind == OverrideExtra && o.covers(s, date) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyOverrides will close the slot or change it's hours if any override
+// applies to the slot at the given date.
+func applyOverrides(s *SlotWithBooker, date time.Time, overrides []SlotOverride) {
+	for _, o := range overrides {
+		if !o.covers(s.Slot, date) {
+			continue
+		}
+
+		switch o.Kind {
+		case OverrideClosed:
+			s.Closed = true
+		case OverrideHours:
+			s.Start = o.StartTime.String
+			s.End = o.EndTime.String
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package laundry
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// LateCancellation represents a booking cancelled shortly before or during
+// the slot
+type LateCancellation struct {
+	ID          int       `db:"id"           json:"id"`
+	BookerID    int       `db:"id_booker"    json:"booker_id"`
+	SlotID      int       `db:"id_slots"     json:"slot_id"`
+	BookDate    time.Time `db:"book_date"    json:"book_date"`
+	CancelledAt time.Time `db:"cancelled_at" json:"cancelled_at"`
+}
+
+// Standing represents if a booker is allowed to book. Points is the number of
+// no shows during the configured period where each late cancellation counts as
+// a part of a no show. A booker reaching the limit is blocked from booking for
+// the configured number of days.
+type Standing struct {
+	BookerID          int        `json:"booker_id"`
+	NoShows           int        `json:"no_shows"`
+	LateCancellations int        `json:"late_cancellations"`
+	Points            float64    `json:"points"`
+	Limit             int        `json:"limit"`
+	Blocked           bool       `json:"blocked"`
+	BlockedUntil      *time.Time `json:"blocked_until,omitempty"`
+}
+
+// penaltyEvent is a no show or a late cancellation weighted by how much it
+// counts towards the limit
+type penaltyEvent struct {
+	At     time.Time
+	Weight float64
+}
+
+// GetBookerStanding will return the standing of a booker at the given time
+// according to the configured penalties
+func GetBookerStanding(bookerID int, at time.Time) (*Standing, *errors.LaundryError) {
+	p := config.GetConfig().Bookings.Penalties
+
+	s := Standing{
+		BookerID: bookerID,
+		Limit:    p.NoShows,
+	}
+
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	if p.NoShows <= 0 || p.Days <= 0 {
+		return &s, nil
+	}
+
+	period := time.Duration(p.Days) * 24 * time.Hour
+	block := time.Duration(p.BlockDays) * 24 * time.Hour
+
+	// Events before the period may still block the booker
+	since := at.Add(-period - block)
+
+	noShows, err := GetBookerNoShows(bookerID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	cancellations, err := GetBookerLateCancellations(bookerID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []penaltyEvent
+
+	for _, n := range noShows {
+		events = append(events, penaltyEvent{At: n.ReleasedAt, Weight: 1})
+
+		if n.ReleasedAt.After(at.Add(-period)) {
+			s.NoShows++
+		}
+	}
+
+	for _, c := range cancellations {
+		events = append(events, penaltyEvent{At: c.CancelledAt, Weight: p.LateCancelWeight})
+
+		if c.CancelledAt.After(at.Add(-period)) {
+			s.LateCancellations++
+		}
+	}
+
+	s.Points = penaltyPoints(events, at, period)
+
+	if until := blockedUntil(events, float64(p.NoShows), period, block); until.After(at) {
+		s.Blocked = true
+		s.BlockedUntil = &until
+	}
+
+	return &s, nil
+}
+
+// GetBookerLateCancellations will return all late cancellations for a booker
+// since the given time, the latest first
+func GetBookerLateCancellations(bookerID int, since time.Time) ([]LateCancellation, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var cancellations = []LateCancellation{}
+
+	err := db.From("late_cancellations").
+		Where(
+			goqu.I("id_booker").Eq(bookerID),
+			goqu.I("cancelled_at").Gte(since),
+		).
+		Order(goqu.I("cancelled_at").Desc()).
+		ScanStructs(&cancellations)
+
+	if err != nil {
+		return nil, errors.New("Could not get late cancellations").CausedBy(err)
+	}
+
+	return cancellations, nil
+}
+
+// mayBook returns an error if the booker is blocked from booking
+func mayBook(bookerID int) *errors.LaundryError {
+	s, err := GetBookerStanding(bookerID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if s.Blocked {
+		return errors.New(
+			"Booker with id %d may not book until %s due to no shows",
+			bookerID, s.BlockedUntil.In(buildingLocation()).Format("2006-01-02 15:04"),
+		).WithStatus(http.StatusForbidden)
+	}
+
+	return nil
+}
+
+// cancelled will count a late cancellation for the booker if the booking was
+// cancelled within the configured number of hours before the slot started
+func cancelled(r Release) *errors.LaundryError {
+	hours := config.GetConfig().Bookings.Penalties.LateCancelHours
+	if hours <= 0 {
+		return nil
+	}
+
+	if r.ReleasedAt.Before(r.Slot.StartsAt(r.BookDate).Add(-time.Duration(hours) * time.Hour)) {
+		return nil
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("late_cancellations").Insert(goqu.Record{
+		"id_booker":    r.BookerID,
+		"id_slots":     r.Slot.ID,
+		"book_date":    r.BookDate.Format("2006-01-02"),
+		"cancelled_at": r.ReleasedAt,
+	})
+
+	if _, err := insert.Exec(); err != nil {
+		return errors.New("Could not count late cancellation for booker with id %d", r.BookerID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// penaltyPoints returns the sum of the weights of the events during the
+// period before at
+func penaltyPoints(events []penaltyEvent, at time.Time, period time.Duration) float64 {
+	var points float64
+
+	for _, e := range events {
+		if e.At.After(at.Add(-period)) && !e.At.After(at) {
+			points += e.Weight
+		}
+	}
+
+	return points
+}
+
+// blockedUntil returns when the latest block ends. A block starts when the
+// points during the period reaches the limit. The zero time is returned if the
+// limit has never been reached.
+func blockedUntil(events []penaltyEvent, limit float64, period, block time.Duration) time.Time {
+	var until time.Time
+
+	sorted := append([]penaltyEvent{}, events...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].At.Before(sorted[j].At)
+	})
+
+	for _, e := range sorted {
+		if penaltyPoints(sorted, e.At, period) >= limit {
+			until = e.At.Add(block)
+		}
+	}
+
+	return until
+}
@@ -0,0 +1,38 @@
+package laundry
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPenalties(t *testing.T) {
+	Convey("Given no shows and late cancellations", t, func() {
+		day := 24 * time.Hour
+		start := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+		events := []penaltyEvent{
+			{At: start.Add(10 * day), Weight: 1},
+			{At: start, Weight: 1},
+			{At: start.Add(20 * day), Weight: 0.5},
+		}
+
+		Convey("Only events during the period counts", func() {
+			So(penaltyPoints(events, start.Add(20*day), 30*day), ShouldEqual, 2.5)
+			So(penaltyPoints(events, start.Add(30*day), 30*day), ShouldEqual, 1.5)
+			So(penaltyPoints(events, start.Add(5*day), 30*day), ShouldEqual, 1)
+		})
+
+		Convey("The booker is blocked from when the limit is reached", func() {
+			So(blockedUntil(events, 2.5, 30*day, 7*day), ShouldResemble, start.Add(27*day))
+			So(blockedUntil(events, 2, 30*day, 7*day), ShouldResemble, start.Add(27*day))
+			So(blockedUntil(events, 2, 15*day, 7*day), ShouldResemble, start.Add(17*day))
+		})
+
+		Convey("A booker never reaching the limit is never blocked", func() {
+			So(blockedUntil(events, 3, 30*day, 7*day).IsZero(), ShouldBeTrue)
+			So(blockedUntil(nil, 1, 30*day, 7*day).IsZero(), ShouldBeTrue)
+		})
+	})
+}
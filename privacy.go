@@ -0,0 +1,156 @@
+package laundry
+
+import (
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// BookerExport represents all personal data stored about a booker
+type BookerExport struct {
+	Booker            Booker             `json:"booker"`
+	Bookings          []BookerBookings   `json:"bookings"`
+	Faults            []Fault            `json:"faults"`
+	Tags              []Tag              `json:"tags"`
+	NoShows           []NoShow           `json:"no_shows"`
+	LateCancellations []LateCancellation `json:"late_cancellations"`
+	Waitlist          []Waiting          `json:"waitlist"`
+	Series            []Series           `json:"series"`
+	ExportedAt        time.Time          `json:"exported_at"`
+}
+
+// VisibleTo returns the parts of the booker the caller is allowed to see.
+// Admins and the booker itself see everything while other bookers in the same
+// property only see the apartment identifier and the name, unless the booker
+// hides it. Anonymous callers and bookers in other properties see nothing.
+func (b Booker) VisibleTo(caller Caller) *Booker {
+	switch {
+	case caller.Admin || caller.IsBooker(b.ID):
+		return &b
+	case caller.Booker == nil, caller.Booker.PropertyID != b.PropertyID:
+		return nil
+	}
+
+	visible := Booker{
+		ID:         b.ID,
+		PropertyID: b.PropertyID,
+		Identifier: b.Identifier,
+		HideName:   b.HideName,
+	}
+
+	if !b.HideName {
+		visible.Name = b.Name
+	}
+
+	return &visible
+}
+
+// VisibleBookers returns the bookers the caller is allowed to see
+func VisibleBookers(bookers []Booker, caller Caller) []Booker {
+	var visible = []Booker{}
+
+	for _, b := range bookers {
+		if vb := b.VisibleTo(caller); vb != nil {
+			visible = append(visible, *vb)
+		}
+	}
+
+	return visible
+}
+
+// VisibleBookings will replace the booker in each booking with the parts of
+// the booker the caller is allowed to see.
+func VisibleBookings(bookings []BookerBookings, caller Caller) {
+	for i, b := range bookings {
+		bookings[i].Booker = Booker{}
+
+		if vb := b.Booker.VisibleTo(caller); vb != nil {
+			bookings[i].Booker = *vb
+		}
+	}
+}
+
+// VisibleSchedule will replace the booker of each slot in the schedule with
+// the parts of the booker the caller is allowed to see.
+func VisibleSchedule(schedule map[time.Time][]SlotWithBooker, caller Caller) {
+	for _, slots := range schedule {
+		for i, s := range slots {
+			if s.Booker != nil {
+				slots[i].Booker = s.Booker.VisibleTo(caller)
+			}
+		}
+	}
+}
+
+// ExportBooker will return all personal data stored about a booker including
+// all bookings, past and future, reported faults and registered tags.
+func ExportBooker(id int) (*BookerExport, *errors.LaundryError) {
+	b, err := GetBooker(id)
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := SearchBookings(BookingsSearch{
+		Start:  time.Time{},
+		End:    today().AddDate(10, 0, 0),
+		Booker: b,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var faults = []Fault{}
+	fErr := db.From("machine_faults").
+		Where(goqu.Ex{
+			"id_booker": b.ID,
+		}).
+		Order(goqu.I("reported_at").Asc()).
+		ScanStructs(&faults)
+
+	if fErr != nil {
+		return nil, errors.New("Could not get faults").CausedBy(fErr)
+	}
+
+	tags, err := GetBookerTags(b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	noShows, err := GetBookerNoShows(b.ID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	cancellations, err := GetBookerLateCancellations(b.ID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	waitlist, err := GetBookerWaitlist(b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := GetBookerSeries(b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BookerExport{
+		Booker:            *b,
+		Bookings:          *bookings,
+		Faults:            faults,
+		Tags:              tags,
+		NoShows:           noShows,
+		LateCancellations: cancellations,
+		Waitlist:          waitlist,
+		Series:            series,
+		ExportedAt:        time.Now(),
+	}, nil
+}
@@ -0,0 +1,244 @@
+package laundry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// ReleaseReason represents why a booked slot was released
+type ReleaseReason string
+
+// The reasons a booked slot may be released before it's held
+const (
+	ReleaseCancelled ReleaseReason = "cancelled"
+	ReleaseNoShow    ReleaseReason = "no_show"
+)
+
+// Release represents a booked slot which became free again at the booked
+// date, either since the booker cancelled or didn't show up.
+type Release struct {
+	BookingID  int           `json:"booking_id"`
+	BookerID   int           `json:"booker_id"`
+	Slot       Slot          `json:"slot"`
+	BookDate   time.Time     `json:"book_date"`
+	Reason     ReleaseReason `json:"reason"`
+	ReleasedAt time.Time     `json:"released_at"`
+}
+
+// ReleaseHook is called for every released slot, i.e. to notify bookers
+// watching the slot
+type ReleaseHook func(r Release)
+
+// NoShow represents a booking released since the booker didn't check in
+type NoShow struct {
+	ID         int       `db:"id"          json:"id"`
+	BookerID   int       `db:"id_booker"   json:"booker_id"`
+	SlotID     int       `db:"id_slots"    json:"slot_id"`
+	BookDate   time.Time `db:"book_date"   json:"book_date"`
+	ReleasedAt time.Time `db:"released_at" json:"released_at"`
+}
+
+var (
+	releaseHooks   []ReleaseHook
+	releaseHooksMu sync.RWMutex
+)
+
+// OnRelease will add a hook called every time a booked slot is released
+func OnRelease(h ReleaseHook) {
+	releaseHooksMu.Lock()
+	defer releaseHooksMu.Unlock()
+
+	releaseHooks = append(releaseHooks, h)
+}
+
+// released will call all release hooks
+func released(r Release) {
+	releaseHooksMu.RLock()
+	defer releaseHooksMu.RUnlock()
+
+	for _, h := range releaseHooks {
+		h(r)
+	}
+}
+
+// ReleaseNoShows will release all bookings held at the given time where the
+// booker hasn't checked in within the configured number of minutes after the
+// slot started. A no show is counted for each booker. Bookings for slots which
+// already ended are kept as is.
+func ReleaseNoShows(at time.Time) ([]Release, *errors.LaundryError) {
+	var releases = []Release{}
+
+	minutes := config.GetConfig().Bookings.CheckInMinutes
+	if minutes <= 0 {
+		return releases, nil
+	}
+
+	date := civilDate(at.In(buildingLocation()))
+
+	bookings, err := SearchBookings(BookingsSearch{
+		Start: date.AddDate(0, 0, -1),
+		End:   date,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, b := range *bookings {
+		ids = append(ids, b.ID)
+	}
+
+	checkedIn, err := checkedInBookings(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range noShows(*bookings, checkedIn, at, time.Duration(minutes)*time.Minute) {
+		r, err := releaseBooking(b, ReleaseNoShow, at)
+		if err != nil {
+			return releases, err
+		}
+
+		releases = append(releases, *r)
+	}
+
+	return releases, nil
+}
+
+// WatchNoShows will release no shows every interval until the program exits
+func WatchNoShows(interval time.Duration) {
+	for range time.Tick(interval) {
+		releases, err := ReleaseNoShows(time.Now())
+		if err != nil {
+			log.GetLogger().Errorf("Could not release no shows: %s", err)
+		}
+
+		for _, r := range releases {
+			log.GetLogger().Infof("Released booking %d for booker %d who didn't check in", r.BookingID, r.BookerID)
+		}
+	}
+}
+
+// noShows returns the bookings not checked in to which started at least after
+// ago but hasn't ended yet
+func noShows(bookings []BookerBookings, checkedIn map[int]bool, at time.Time, after time.Duration) []BookerBookings {
+	var missing []BookerBookings
+
+	for _, b := range bookings {
+		if checkedIn[b.ID] {
+			continue
+		}
+
+		if at.Before(b.Slot.StartsAt(b.BookDate).Add(after)) || !at.Before(b.Slot.EndsAt(b.BookDate)) {
+			continue
+		}
+
+		missing = append(missing, b)
+	}
+
+	return missing
+}
+
+// releaseBooking will remove a booking, count a no show if the booker didn't
+// show up and call the release hooks
+func releaseBooking(b BookerBookings, reason ReleaseReason, at time.Time) (*Release, *errors.LaundryError) {
+	if err := RemoveBooking(&Bookings{ID: b.ID}); err != nil {
+		return nil, err
+	}
+
+	r := Release{
+		BookingID:  b.ID,
+		BookerID:   b.Booker.ID,
+		Slot:       b.Slot,
+		BookDate:   b.BookDate,
+		Reason:     reason,
+		ReleasedAt: at,
+	}
+
+	if reason == ReleaseNoShow {
+		db := database.GetGoqu()
+
+		insert := db.From("no_shows").Insert(goqu.Record{
+			"id_booker":   r.BookerID,
+			"id_slots":    r.Slot.ID,
+			"book_date":   r.BookDate.Format("2006-01-02"),
+			"released_at": r.ReleasedAt,
+		})
+
+		if _, err := insert.Exec(); err != nil {
+			return nil, errors.New("Could not count no show for booker with id %d", r.BookerID).CausedBy(err)
+		}
+	}
+
+	released(r)
+
+	return &r, nil
+}
+
+// checkedInBookings returns which of the bookings with passed ids are checked
+// in to
+func checkedInBookings(bookingIDs []int) (map[int]bool, *errors.LaundryError) {
+	var checkedIn = make(map[int]bool)
+
+	if len(bookingIDs) == 0 {
+		return checkedIn, nil
+	}
+
+	var ids []interface{}
+	for _, id := range bookingIDs {
+		ids = append(ids, id)
+	}
+
+	db := database.GetGoqu()
+
+	var checkIns []CheckIn
+	err := db.From("check_ins").
+		Where(
+			goqu.I("id_bookings").In(ids...),
+		).
+		ScanStructs(&checkIns)
+
+	if err != nil {
+		return nil, errors.New("Could not get check ins").CausedBy(err)
+	}
+
+	for _, c := range checkIns {
+		checkedIn[c.BookingID] = true
+	}
+
+	return checkedIn, nil
+}
+
+// GetBookerNoShows will return all no shows for a booker since the given
+// time, the latest first
+func GetBookerNoShows(bookerID int, since time.Time) ([]NoShow, *errors.LaundryError) {
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var noShows = []NoShow{}
+
+	err := db.From("no_shows").
+		Where(
+			goqu.I("id_booker").Eq(bookerID),
+			goqu.I("released_at").Gte(since),
+		).
+		Order(goqu.I("released_at").Desc()).
+		ScanStructs(&noShows)
+
+	if err != nil {
+		return nil, errors.New("Could not get no shows").CausedBy(err)
+	}
+
+	return noShows, nil
+}
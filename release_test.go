@@ -0,0 +1,51 @@
+package laundry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNoShows(t *testing.T) {
+	Convey("Given bookings in the morning and over midnight", t, func() {
+		config.SetConfig(&config.Configuration{TimeZone: "Europe/Stockholm"})
+
+		stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+		bookings := []BookerBookings{
+			{ID: 1, BookDate: date("2018-05-07"), Slot: Slot{Start: "07:00:00", End: "10:00:00"}},
+			{ID: 2, BookDate: date("2018-05-07"), Slot: Slot{Start: "22:00:00", End: "01:00:00"}},
+		}
+
+		ids := func(bb []BookerBookings) []int {
+			var ids []int
+			for _, b := range bb {
+				ids = append(ids, b.ID)
+			}
+
+			return ids
+		}
+
+		Convey("A booking is a no show after the check in time until the slot ends", func() {
+			at := time.Date(2018, 5, 7, 7, 14, 0, 0, stockholm)
+
+			So(noShows(bookings, map[int]bool{}, at, 15*time.Minute), ShouldBeEmpty)
+			So(ids(noShows(bookings, map[int]bool{}, at.Add(time.Minute), 15*time.Minute)), ShouldResemble, []int{1})
+			So(noShows(bookings, map[int]bool{}, at.Add(2*time.Hour+46*time.Minute), 15*time.Minute), ShouldBeEmpty)
+		})
+
+		Convey("A booking checked in to is never a no show", func() {
+			at := time.Date(2018, 5, 7, 8, 0, 0, 0, stockholm)
+
+			So(noShows(bookings, map[int]bool{1: true}, at, 15*time.Minute), ShouldBeEmpty)
+		})
+
+		Convey("A booking over midnight is a no show the day after", func() {
+			at := time.Date(2018, 5, 8, 0, 30, 0, 0, stockholm)
+
+			So(ids(noShows(bookings, map[int]bool{}, at, 15*time.Minute)), ShouldResemble, []int{2})
+		})
+	})
+}
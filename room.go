@@ -0,0 +1,293 @@
+package laundry
+
+import (
+	"net/http"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// Property represents a property such as a building or an association. A
+// property has one or more laundry rooms and all bookers belong to a property.
+type Property struct {
+	ID      int        `db:"id"      json:"id"`
+	Name    string     `db:"name"    json:"name"`
+	Address NullString `db:"address" json:"address"`
+}
+
+// Room represents a laundry room in a property. Each room has it's own
+// machines and slots.
+type Room struct {
+	ID         int    `db:"id"            json:"id"`
+	PropertyID int    `db:"id_properties" json:"property_id"`
+	Name       string `db:"name"          json:"name"`
+}
+
+// GetProperties will return a list of all properties
+func GetProperties() ([]Property, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var properties []Property
+	if err := db.From("properties").ScanStructs(&properties); err != nil {
+		return properties, errors.New("Could not get properties").CausedBy(err)
+	}
+
+	return properties, nil
+}
+
+// GetProperty will return the Property with passed ID if it exists
+func GetProperty(id int) (*Property, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var p Property
+	found, err := db.From("properties").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&p)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Property with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &p, nil
+}
+
+// AddProperty will add a new property
+func AddProperty(p *Property) (*Property, *errors.LaundryError) {
+	if p.Name == "" {
+		return nil, errors.New("Missing name in request").WithStatus(http.StatusBadRequest)
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("properties").Insert(goqu.Record{
+		"name":    p.Name,
+		"address": p.Address,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return nil, errors.New("Could not create property").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	p.ID = int(lastID)
+
+	return p, nil
+}
+
+// UpdateProperty will update the name and address of an existing property
+func UpdateProperty(id int, up *Property) (*Property, *errors.LaundryError) {
+	p, lErr := GetProperty(id)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	if up.Name == "" {
+		return nil, errors.New("Missing field name").WithStatus(http.StatusBadRequest)
+	}
+
+	p.Name = up.Name
+	p.Address = up.Address
+
+	db := database.GetGoqu()
+
+	update := db.From("properties").
+		Where(goqu.Ex{
+			"id": p.ID,
+		}).
+		Update(goqu.Record{
+			"name":    p.Name,
+			"address": p.Address,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return nil, errors.New("Could not update property with id %d", p.ID).CausedBy(err)
+	}
+
+	return p, nil
+}
+
+// RemoveProperty will remove a property. All rooms and bookers in the property
+// will be removed aswell.
+func RemoveProperty(p *Property) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("properties").
+		Where(goqu.Ex{
+			"id": p.ID,
+		}).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove property with id %d", p.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemovePropertyByID will remove a property by the property id
+func RemovePropertyByID(id int) *errors.LaundryError {
+	p, err := GetProperty(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveProperty(p)
+}
+
+// GetRooms will return a list of all rooms in a property.
+func GetRooms(propertyID int) ([]Room, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	if _, err := GetProperty(propertyID); err != nil {
+		return nil, err
+	}
+
+	query := db.From("rooms").Where(goqu.Ex{
+		"id_properties": propertyID,
+	})
+
+	var rooms []Room
+	if err := query.ScanStructs(&rooms); err != nil {
+		return rooms, errors.New("Could not get rooms").CausedBy(err)
+	}
+
+	return rooms, nil
+}
+
+// GetRoom will return the Room with passed ID if it exists
+func GetRoom(id int) (*Room, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var r Room
+	found, err := db.From("rooms").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&r)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Room with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &r, nil
+}
+
+// AddRoom will add a new laundry room to an existing property
+func AddRoom(r *Room) (*Room, *errors.LaundryError) {
+	if r.Name == "" {
+		return nil, errors.New("Missing name in request").WithStatus(http.StatusBadRequest)
+	}
+
+	if _, err := GetProperty(r.PropertyID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("rooms").Insert(goqu.Record{
+		"id_properties": r.PropertyID,
+		"name":          r.Name,
+	})
+
+	row, err := insert.Exec()
+	if err != nil {
+		return nil, errors.New("Could not create room").CausedBy(err)
+	}
+
+	lastID, err := row.LastInsertId()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+
+	r.ID = int(lastID)
+
+	return r, nil
+}
+
+// UpdateRoom will update the name of an existing room. A room cannot be
+// moved to another property.
+func UpdateRoom(id int, ur *Room) (*Room, *errors.LaundryError) {
+	r, lErr := GetRoom(id)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	if ur.Name == "" {
+		return nil, errors.New("Missing field name").WithStatus(http.StatusBadRequest)
+	}
+
+	r.Name = ur.Name
+
+	db := database.GetGoqu()
+
+	update := db.From("rooms").
+		Where(goqu.Ex{
+			"id": r.ID,
+		}).
+		Update(goqu.Record{
+			"name": r.Name,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return nil, errors.New("Could not update room with id %d", r.ID).CausedBy(err)
+	}
+
+	return r, nil
+}
+
+// RemoveRoom will remove a room including it's machines and slots
+func RemoveRoom(r *Room) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("rooms").
+		Where(goqu.Ex{
+			"id": r.ID,
+		}).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove room with id %d", r.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveRoomByID will remove a room by the room id
+func RemoveRoomByID(id int) *errors.LaundryError {
+	r, err := GetRoom(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveRoom(r)
+}
+
+// roomInProperty returns true if the room belongs to the property
+func roomInProperty(r Room, propertyID int) bool {
+	return propertyID > 0 && r.PropertyID == propertyID
+}
+
+// machinesInRoom returns an error unless all machines are in the room
+func machinesInRoom(machines []Machine, roomID int) *errors.LaundryError {
+	for _, m := range machines {
+		if m.RoomID != roomID {
+			return errors.New("Machine with id %d is not in room %d", m.ID, roomID).WithStatus(http.StatusBadRequest)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package laundry
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOwnership(t *testing.T) {
+	Convey("Given rooms in two properties", t, func() {
+		rooms := []Room{
+			{ID: 1, PropertyID: 1, Name: "Laundry room"},
+			{ID: 2, PropertyID: 2, Name: "Laundry room"},
+		}
+
+		Convey("Rooms only belong to their own property", func() {
+			So(roomInProperty(rooms[0], 1), ShouldBeTrue)
+			So(roomInProperty(rooms[1], 1), ShouldBeFalse)
+			So(roomInProperty(rooms[0], 0), ShouldBeFalse)
+		})
+
+		Convey("Machines must be in the same room as the slot", func() {
+			machines := []Machine{{ID: 1, RoomID: 1}, {ID: 2, RoomID: 1}}
+
+			So(machinesInRoom(machines, 1), ShouldBeNil)
+			So(machinesInRoom(nil, 1), ShouldBeNil)
+
+			err := machinesInRoom(append(machines, Machine{ID: 3, RoomID: 2}), 1)
+
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusBadRequest)
+			So(err.Reasons[0], ShouldContainSubstring, "Machine with id 3")
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package laundry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bombsimon/laundry/errors"
+)
+
+// SlotStatus represents the status of a slot at a given date as seen by the
+// caller asking for the schedule
+type SlotStatus string
+
+// The different statuses of a slot. A slot booked by the caller is mine while
+// slots booked by anyone else is booked.
+const (
+	SlotFree   SlotStatus = "free"
+	SlotBooked SlotStatus = "booked"
+	SlotMine   SlotStatus = "mine"
+	SlotClosed SlotStatus = "closed"
+)
+
+// ScheduleDay represents all slots held at a date
+type ScheduleDay struct {
+	Date  string         `json:"date"`
+	Slots []ScheduleSlot `json:"slots"`
+}
+
+// ScheduleSlot represents a slot held at a date, it's status and the booker
+// if the caller is allowed to see who booked it.
+type ScheduleSlot struct {
+	ID       int        `json:"id"`
+	RoomID   int        `json:"room_id"`
+	Start    string     `json:"start"`
+	End      string     `json:"end"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at"`
+	Machines []Machine  `json:"machines"`
+	Status   SlotStatus `json:"status"`
+	Booker   *Booker    `json:"booker,omitempty"`
+}
+
+// GetSchedule will return the schedule between a given start- and end date as
+// an ordered list of days. The booker of each slot is only included as much as
+// the caller is allowed to see.
+func GetSchedule(start, end string, filter ScheduleFilter, caller Caller) ([]ScheduleDay, *errors.LaundryError) {
+	schedule, err := GetIntervalSchedule(start, end, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return scheduleDays(schedule, caller), nil
+}
+
+// scheduleDays will convert a schedule to a list of days ordered by date
+func scheduleDays(schedule map[time.Time][]SlotWithBooker, caller Caller) []ScheduleDay {
+	var dates []time.Time
+	for d := range schedule {
+		dates = append(dates, d)
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var days = make([]ScheduleDay, 0, len(dates))
+
+	for _, d := range dates {
+		var slots = make([]ScheduleSlot, 0, len(schedule[d]))
+
+		for _, s := range schedule[d] {
+			slots = append(slots, scheduleSlot(s, caller))
+		}
+
+		days = append(days, ScheduleDay{
+			Date:  d.Format("2006-01-02"),
+			Slots: slots,
+		})
+	}
+
+	return days
+}
+
+// scheduleSlot will return the slot as seen by the caller
+func scheduleSlot(s SlotWithBooker, caller Caller) ScheduleSlot {
+	ss := ScheduleSlot{
+		ID:       s.ID,
+		RoomID:   s.RoomID,
+		Start:    s.Start,
+		End:      s.End,
+		StartsAt: s.StartsAt,
+		EndsAt:   s.EndsAt,
+		Machines: s.Machines,
+		Status:   SlotFree,
+	}
+
+	switch {
+	case s.Closed:
+		ss.Status = SlotClosed
+	case s.Booker != nil && caller.IsBooker(s.Booker.ID):
+		ss.Status = SlotMine
+		ss.Booker = s.Booker
+	case s.Booker != nil:
+		ss.Status = SlotBooked
+		ss.Booker = s.Booker.VisibleTo(caller)
+	}
+
+	return ss
+}
@@ -0,0 +1,117 @@
+package laundry
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduleDays(t *testing.T) {
+	Convey("Given a schedule with free, booked and closed slots", t, func() {
+		me := Booker{ID: 1, Identifier: "1001", Email: NullString{sql.NullString{String: "me@example.com", Valid: true}}}
+		other := Booker{
+			ID:         2,
+			Identifier: "1002",
+			Name:       NullString{sql.NullString{String: "Other", Valid: true}},
+			Email:      NullString{sql.NullString{String: "other@example.com", Valid: true}},
+		}
+
+		schedule := map[time.Time][]SlotWithBooker{
+			date("2018-05-08"): {
+				{Slot: Slot{ID: 1}},
+			},
+			date("2018-05-07"): {
+				{Slot: Slot{ID: 1}, Booker: &me},
+				{Slot: Slot{ID: 2}, Booker: &other},
+				{Slot: Slot{ID: 3}, Closed: true},
+			},
+		}
+
+		Convey("Days are ordered by date", func() {
+			days := scheduleDays(schedule, Caller{})
+
+			So(len(days), ShouldEqual, 2)
+			So(days[0].Date, ShouldEqual, "2018-05-07")
+			So(days[1].Date, ShouldEqual, "2018-05-08")
+			So(days[1].Slots[0].Status, ShouldEqual, SlotFree)
+		})
+
+		Convey("Bookers see their own bookings and only identifiers and names of others", func() {
+			slots := scheduleDays(schedule, Caller{Booker: &me})[0].Slots
+
+			So(slots[0].Status, ShouldEqual, SlotMine)
+			So(slots[0].Booker.Email.String, ShouldEqual, "me@example.com")
+			So(slots[1].Status, ShouldEqual, SlotBooked)
+			So(slots[1].Booker.Identifier, ShouldEqual, "1002")
+			So(slots[1].Booker.Name.String, ShouldEqual, "Other")
+			So(slots[1].Booker.Email.Valid, ShouldBeFalse)
+			So(slots[2].Status, ShouldEqual, SlotClosed)
+		})
+
+		Convey("Anonymous callers does not see any bookers", func() {
+			slots := scheduleDays(schedule, Caller{})[0].Slots
+
+			So(slots[0].Status, ShouldEqual, SlotBooked)
+			So(slots[0].Booker, ShouldBeNil)
+			So(slots[1].Booker, ShouldBeNil)
+		})
+
+		Convey("Admins see everything", func() {
+			slots := scheduleDays(schedule, Caller{Admin: true})[0].Slots
+
+			So(slots[1].Booker.Email.String, ShouldEqual, "other@example.com")
+		})
+	})
+}
+
+func TestVisibleBookers(t *testing.T) {
+	Convey("Given a booker hiding the name", t, func() {
+		me := Booker{ID: 1, Identifier: "1001"}
+		hidden := Booker{
+			ID:         2,
+			Identifier: "1002",
+			Name:       NullString{sql.NullString{String: "Hidden", Valid: true}},
+			Phone:      NullString{sql.NullString{String: "555-1234", Valid: true}},
+			HideName:   true,
+		}
+
+		Convey("Other bookers only see the identifier", func() {
+			visible := hidden.VisibleTo(Caller{Booker: &me})
+
+			So(visible.Identifier, ShouldEqual, "1002")
+			So(visible.Name.Valid, ShouldBeFalse)
+			So(visible.Phone.Valid, ShouldBeFalse)
+		})
+
+		Convey("Other bookers see the name when it's not hidden", func() {
+			shown := hidden
+			shown.HideName = false
+
+			visible := shown.VisibleTo(Caller{Booker: &me})
+
+			So(visible.Identifier, ShouldEqual, "1002")
+			So(visible.Name.String, ShouldEqual, "Hidden")
+			So(visible.Phone.Valid, ShouldBeFalse)
+		})
+
+		Convey("The booker and admins see everything", func() {
+			So(hidden.VisibleTo(Caller{Booker: &hidden}).Name.String, ShouldEqual, "Hidden")
+			So(hidden.VisibleTo(Caller{Admin: true}).Phone.String, ShouldEqual, "555-1234")
+		})
+
+		Convey("Anonymous callers see no bookers", func() {
+			So(VisibleBookers([]Booker{me, hidden}, Caller{}), ShouldBeEmpty)
+			So(len(VisibleBookers([]Booker{me, hidden}, Caller{Booker: &me})), ShouldEqual, 2)
+		})
+
+		Convey("Bookers in other properties are not visible", func() {
+			neighbour := Booker{ID: 3, PropertyID: 2, Identifier: "2001", Name: hidden.Name}
+
+			So(neighbour.VisibleTo(Caller{Booker: &me}), ShouldBeNil)
+			So(VisibleBookers([]Booker{me, hidden, neighbour}, Caller{Booker: &me}), ShouldHaveLength, 2)
+			So(neighbour.VisibleTo(Caller{Admin: true}).Name.String, ShouldEqual, "Hidden")
+		})
+	})
+}
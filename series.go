@@ -0,0 +1,528 @@
+package laundry
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// SeriesRecurrence represents how often a series of bookings repeats
+type SeriesRecurrence string
+
+// The supported recurrences of a series
+const (
+	SeriesWeekly   SeriesRecurrence = "weekly"
+	SeriesBiweekly SeriesRecurrence = "biweekly"
+)
+
+// Weeks returns the number of weeks between each occurrence
+func (r SeriesRecurrence) Weeks() int {
+	switch r {
+	case SeriesWeekly:
+		return 1
+	case SeriesBiweekly:
+		return 2
+	}
+
+	return 0
+}
+
+// OccurrenceStatus represents the outcome of booking an occurrence
+type OccurrenceStatus string
+
+// The states of an occurrence. A conflicting occurrence couldn't be booked
+// and is never tried again.
+const (
+	OccurrenceBooked    OccurrenceStatus = "booked"
+	OccurrenceConflict  OccurrenceStatus = "conflict"
+	OccurrenceCancelled OccurrenceStatus = "cancelled"
+)
+
+// Series represents a slot booked repeatedly by a booker from the start date
+// until the end date or until Count occurrences have been held. Occurrences
+// are booked as they come within the configured horizon.
+type Series struct {
+	ID          int              `db:"id"               json:"id"`
+	BookerID    int              `db:"id_booker"        json:"booker_id"`
+	SlotID      int              `db:"id_slots"         json:"slot_id"`
+	Recurrence  SeriesRecurrence `db:"recurrence"       json:"recurrence"`
+	StartDate   time.Time        `db:"start_date"       json:"start_date"`
+	EndDate     NullTime         `db:"end_date"         json:"end_date"`
+	Count       NullInt64        `db:"occurrence_count" json:"count"`
+	CreatedAt   time.Time        `db:"created_at"       json:"created_at"`
+	CancelledAt NullTime         `db:"cancelled_at"     json:"cancelled_at"`
+	Occurrences []Occurrence     `db:"-"                json:"occurrences"`
+}
+
+// Occurrence represents a date in a series and the booking made for it. The
+// reason tells why a conflicting occurrence couldn't be booked.
+type Occurrence struct {
+	ID        int              `db:"id"          json:"id"`
+	SeriesID  int              `db:"id_series"   json:"series_id"`
+	BookDate  time.Time        `db:"book_date"   json:"book_date"`
+	BookingID NullInt64        `db:"id_bookings" json:"booking_id"`
+	Status    OccurrenceStatus `db:"status"      json:"status"`
+	Reason    NullString       `db:"reason"      json:"reason"`
+}
+
+// GetSeries will return a series and all its occurrences
+func GetSeries(id int) (*Series, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var s Series
+	found, err := db.From("series").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&s)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Series with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	if err := setOccurrences(&s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// GetBookerSeries will return all series of a booker not cancelled
+func GetBookerSeries(bookerID int) ([]Series, *errors.LaundryError) {
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var series = []Series{}
+
+	err := db.From("series").
+		Where(
+			goqu.I("id_booker").Eq(bookerID),
+			goqu.I("cancelled_at").IsNull(),
+		).
+		Order(goqu.I("id").Asc()).
+		ScanStructs(&series)
+
+	if err != nil {
+		return nil, errors.New("Could not get series").CausedBy(err)
+	}
+
+	for i := range series {
+		if err := setOccurrences(&series[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return series, nil
+}
+
+// AddSeries will create a series and book all occurrences within the horizon.
+// Occurrences which can't be booked, i.e. since the slot is taken or the
+// booker would exceed a quota, are reported as conflicts.
+func AddSeries(s *Series) (*Series, *errors.LaundryError) {
+	if s.Recurrence.Weeks() == 0 {
+		return nil, errors.New("Invalid recurrence '%s'", s.Recurrence).WithStatus(http.StatusBadRequest)
+	}
+
+	if !s.EndDate.Valid && !s.Count.Valid {
+		return nil, errors.New("Missing end date or count in request").WithStatus(http.StatusBadRequest)
+	}
+
+	if s.Count.Valid && s.Count.Int64 < 1 {
+		return nil, errors.New("Count must be at least 1").WithStatus(http.StatusBadRequest)
+	}
+
+	if s.StartDate.IsZero() || civilDate(s.StartDate).Before(today()) {
+		s.StartDate = today()
+	}
+
+	s.StartDate = civilDate(s.StartDate)
+
+	if s.EndDate.Valid {
+		s.EndDate.Time = civilDate(s.EndDate.Time)
+
+		if s.EndDate.Time.Before(s.StartDate) {
+			return nil, errors.New("End date cannot be before start date").WithStatus(http.StatusBadRequest)
+		}
+	}
+
+	booker, err := GetBooker(s.BookerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if booker.ErasedAt.Valid {
+		return nil, errors.New("Booker with ID %d is erased", booker.ID).WithStatus(http.StatusGone)
+	}
+
+	slot, err := GetSlot(s.SlotID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slot.Recurring {
+		return nil, errors.New("Slot with id %d is not recurring", slot.ID).WithStatus(http.StatusBadRequest)
+	}
+
+	s.CreatedAt = time.Now()
+	s.CancelledAt = NullTime{}
+
+	db := database.GetGoqu()
+
+	record := goqu.Record{
+		"id_booker":  s.BookerID,
+		"id_slots":   s.SlotID,
+		"recurrence": string(s.Recurrence),
+		"start_date": s.StartDate.Format("2006-01-02"),
+		"created_at": s.CreatedAt,
+	}
+
+	if s.EndDate.Valid {
+		record["end_date"] = s.EndDate.Time.Format("2006-01-02")
+	}
+
+	if s.Count.Valid {
+		record["occurrence_count"] = s.Count.Int64
+	}
+
+	row, iErr := db.From("series").Insert(record).Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not create series").CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	s.ID = int(lastID)
+
+	if err := bookSeries(s, slot, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := setOccurrences(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// CancelSeries will cancel all occurrences of a series not yet started and
+// stop it from booking more
+func CancelSeries(s *Series) *errors.LaundryError {
+	if err := setOccurrences(s); err != nil {
+		return err
+	}
+
+	slot, err := GetSlot(s.SlotID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for i := range s.Occurrences {
+		o := &s.Occurrences[i]
+		if o.Status != OccurrenceBooked || !now.Before(slot.StartsAt(o.BookDate)) {
+			continue
+		}
+
+		if err := cancelOccurrence(o); err != nil {
+			return err
+		}
+	}
+
+	s.CancelledAt.Time, s.CancelledAt.Valid = time.Now(), true
+
+	db := database.GetGoqu()
+
+	update := db.From("series").
+		Where(goqu.Ex{
+			"id": s.ID,
+		}).
+		Update(goqu.Record{
+			"cancelled_at": s.CancelledAt.Time,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return errors.New("Could not cancel series with id %d", s.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// CancelSeriesByID will cancel a series by the series id
+func CancelSeriesByID(id int) *errors.LaundryError {
+	s, err := GetSeries(id)
+	if err != nil {
+		return err
+	}
+
+	return CancelSeries(s)
+}
+
+// CancelOccurrence will cancel a single booked occurrence in a series before
+// the slot starts. The occurrence is never booked again.
+func CancelOccurrence(seriesID, occurrenceID int) (*Occurrence, *errors.LaundryError) {
+	s, err := GetSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := GetSlot(s.SlotID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range s.Occurrences {
+		o := &s.Occurrences[i]
+		if o.ID != occurrenceID {
+			continue
+		}
+
+		if o.Status != OccurrenceBooked {
+			return nil, errors.New("Occurrence with id %d is not booked", o.ID).WithStatus(http.StatusConflict)
+		}
+
+		if !time.Now().Before(slot.StartsAt(o.BookDate)) {
+			return nil, errors.New("Occurrence with id %d has already started", o.ID).WithStatus(http.StatusConflict)
+		}
+
+		if err := cancelOccurrence(o); err != nil {
+			return nil, err
+		}
+
+		return o, nil
+	}
+
+	return nil, errors.New("Occurrence with id %d not found in series %d", occurrenceID, seriesID).WithStatus(http.StatusNotFound)
+}
+
+// BookAllSeries will book the occurrences of all series which has come
+// within the horizon since last time
+func BookAllSeries(at time.Time) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	var series []Series
+	err := db.From("series").
+		Where(
+			goqu.I("cancelled_at").IsNull(),
+			goqu.Or(
+				goqu.I("end_date").IsNull(),
+				goqu.I("end_date").Gte(civilDate(at.In(buildingLocation())).Format("2006-01-02")),
+			),
+		).
+		ScanStructs(&series)
+
+	if err != nil {
+		return errors.New("Could not get series").CausedBy(err)
+	}
+
+	for i := range series {
+		slot, err := GetSlot(series[i].SlotID)
+		if err != nil {
+			return err
+		}
+
+		if err := bookSeries(&series[i], slot, at); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchSeries will book occurrences of all series every interval until the
+// program exits
+func WatchSeries(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := BookAllSeries(time.Now()); err != nil {
+			log.GetLogger().Errorf("Could not book series: %s", err)
+		}
+	}
+}
+
+// bookSeries will try to book every occurrence of the series from the given
+// time until the horizon not tried before. Occurrences rejected by the rules
+// for bookings are recorded as conflicts while any other error stops the
+// booking so the occurrence is tried again later.
+func bookSeries(s *Series, slot *Slot, at time.Time) *errors.LaundryError {
+	if err := setOccurrences(s); err != nil {
+		return err
+	}
+
+	tried := make(map[time.Time]bool)
+	for _, o := range s.Occurrences {
+		tried[civilDate(o.BookDate)] = true
+	}
+
+	from := civilDate(at.In(buildingLocation()))
+	until := from.AddDate(0, 0, config.GetConfig().Bookings.SeriesHorizonDays)
+
+	db := database.GetGoqu()
+
+	for _, date := range seriesDates(*s, time.Weekday(slot.Weekday), from, until) {
+		if tried[date] {
+			continue
+		}
+
+		err := bookOccurrence(s, &Bookings{
+			BookDate: date,
+			SlotID:   s.SlotID,
+			BookerID: s.BookerID,
+		})
+
+		if err == nil {
+			continue
+		}
+
+		if !isValidationError(err) {
+			return err
+		}
+
+		insert := db.From("series_occurrences").Insert(goqu.Record{
+			"id_series": s.ID,
+			"book_date": date.Format("2006-01-02"),
+			"status":    string(OccurrenceConflict),
+			"reason":    strings.Join(err.Reasons, ", "),
+		})
+
+		if _, iErr := insert.Exec(); iErr != nil {
+			return errors.New("Could not add occurrence to series with id %d", s.ID).CausedBy(iErr)
+		}
+	}
+
+	return nil
+}
+
+// bookOccurrence will add the booking and the booked occurrence of the series
+// in one transaction
+func bookOccurrence(s *Series, b *Bookings) *errors.LaundryError {
+	if err := validBooking(b); err != nil {
+		return err
+	}
+
+	tx, tErr := database.GetGoqu().Begin()
+	if tErr != nil {
+		return errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(tErr)
+	}
+
+	if err := addBooking(tx, b); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	insert := tx.From("series_occurrences").Insert(goqu.Record{
+		"id_series":   s.ID,
+		"book_date":   b.BookDate.Format("2006-01-02"),
+		"id_bookings": b.ID,
+		"status":      string(OccurrenceBooked),
+	})
+
+	if _, err := insert.Exec(); err != nil {
+		tx.Rollback()
+		return errors.New("Could not add occurrence to series with id %d", s.ID).CausedBy(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return bookingConflict(err, b, "Could not commit booking")
+	}
+
+	return nil
+}
+
+// cancelOccurrence will remove the booking of an occurrence
+func cancelOccurrence(o *Occurrence) *errors.LaundryError {
+	if o.BookingID.Valid {
+		err := RemoveBookingByID(int(o.BookingID.Int64))
+		if err != nil && err.Status != http.StatusNotFound {
+			return err
+		}
+	}
+
+	o.Status = OccurrenceCancelled
+
+	db := database.GetGoqu()
+
+	update := db.From("series_occurrences").
+		Where(goqu.Ex{
+			"id": o.ID,
+		}).
+		Update(goqu.Record{
+			"status": string(o.Status),
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return errors.New("Could not cancel occurrence with id %d", o.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// setOccurrences will set all occurrences of the series ordered by date
+func setOccurrences(s *Series) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	s.Occurrences = []Occurrence{}
+
+	err := db.From("series_occurrences").
+		Where(goqu.Ex{
+			"id_series": s.ID,
+		}).
+		Order(goqu.I("book_date").Asc()).
+		ScanStructs(&s.Occurrences)
+
+	if err != nil {
+		return errors.New("Could not get occurrences").CausedBy(err)
+	}
+
+	return nil
+}
+
+// seriesDates returns the dates the series is held between from and until.
+// The first occurrence is the first date on the weekday at or after the start
+// date and the count is counted from the first occurrence.
+func seriesDates(s Series, weekday time.Weekday, from, until time.Time) []time.Time {
+	var dates []time.Time
+
+	weeks := s.Recurrence.Weeks()
+	if weeks == 0 {
+		return dates
+	}
+
+	date := civilDate(s.StartDate)
+	for date.Weekday() != weekday {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	for n := int64(0); !date.After(until); n++ {
+		if s.Count.Valid && n >= s.Count.Int64 {
+			break
+		}
+
+		if s.EndDate.Valid && date.After(civilDate(s.EndDate.Time)) {
+			break
+		}
+
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+
+		date = date.AddDate(0, 0, 7*weeks)
+	}
+
+	return dates
+}
@@ -0,0 +1,52 @@
+package laundry
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSeriesDates(t *testing.T) {
+	Convey("Given a series starting on a wednesday for a tuesday slot", t, func() {
+		s := Series{
+			Recurrence: SeriesWeekly,
+			StartDate:  date("2018-05-02"),
+		}
+
+		from, until := date("2018-05-01"), date("2018-06-01")
+
+		Convey("The first occurrence is the tuesday after", func() {
+			s.Count = NullInt64{sql.NullInt64{Int64: 3, Valid: true}}
+
+			So(seriesDates(s, time.Tuesday, from, until), ShouldResemble, []time.Time{
+				date("2018-05-08"), date("2018-05-15"), date("2018-05-22"),
+			})
+		})
+
+		Convey("A biweekly series ends at the end date", func() {
+			s.Recurrence = SeriesBiweekly
+			s.EndDate = NullTime{mysql.NullTime{Time: date("2018-05-22"), Valid: true}}
+
+			So(seriesDates(s, time.Tuesday, from, until), ShouldResemble, []time.Time{
+				date("2018-05-08"), date("2018-05-22"),
+			})
+		})
+
+		Convey("Only occurrences until the horizon are returned", func() {
+			So(seriesDates(s, time.Tuesday, date("2018-05-10"), date("2018-05-22")), ShouldResemble, []time.Time{
+				date("2018-05-15"), date("2018-05-22"),
+			})
+		})
+
+		Convey("The count includes occurrences before the horizon", func() {
+			s.Count = NullInt64{sql.NullInt64{Int64: 2, Valid: true}}
+
+			So(seriesDates(s, time.Tuesday, date("2018-05-10"), until), ShouldResemble, []time.Time{
+				date("2018-05-15"),
+			})
+		})
+	})
+}
@@ -1,7 +1,11 @@
 package laundry
 
 import (
+	"database/sql"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bombsimon/laundry/database"
@@ -12,64 +16,171 @@ import (
 	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
 )
 
-// Slot represents an available slot and corresponding machines
+// Slot represents an available slot and corresponding machines. Recurring
+// slots belong to a SlotSet and are held every week while the set is in use.
+// Other slots are only held at the dates given by an extra slot override.
 type Slot struct {
-	ID       int       `db:"id"         json:"id"`
-	Weekday  int       `db:"week_day"   json:"week_day"`
-	Start    string    `db:"start_time" json:"start"`
-	End      string    `db:"end_time"   json:"end"`
-	Machines []Machine `db:"-"          json:"machines"`
+	ID         int       `db:"id"           json:"id"`
+	RoomID     int       `db:"id_rooms"     json:"room_id"`
+	SetID      NullInt64 `db:"id_slot_sets" json:"set_id"`
+	Weekday    int       `db:"week_day"     json:"week_day"`
+	Start      string    `db:"start_time"   json:"start"`
+	End        string    `db:"end_time"     json:"end"`
+	Recurring  bool      `db:"recurring"    json:"recurring"`
+	Machines   []Machine `db:"-"            json:"machines"`
+	MachineIDs []int     `db:"-"            json:"machine_ids,omitempty"`
 }
 
-// SlotWithBooker represents a slot and a possible booker for that slot
+// SlotWithBooker represents a slot held at a given date and a possible booker
+// for that slot. Slots spanning midnight belongs to the date they start.
 type SlotWithBooker struct {
 	Slot
-	Booker *Booker `json:"booker"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Booker   *Booker   `json:"booker"`
+	Closed   bool      `json:"closed"`
 }
 
-// GetSlots will return a list of all slots and it's machines
-func GetSlots() ([]Slot, *errors.LaundryError) {
+// ScheduleFilter represents optional parameters to narrow down the slots
+// returned in a schedule
+type ScheduleFilter struct {
+	RoomID      int
+	MachineType MachineType
+}
+
+// slotMachineRow represents a slot joined with one of it's machines. The
+// machine columns are null for slots without machines.
+type slotMachineRow struct {
+	Slot
+	MachineID       NullInt64       `db:"machine_id"`
+	MachineRoomID   NullInt64       `db:"machine_id_rooms"`
+	MachineInfo     NullString      `db:"machine_info"`
+	MachineWorking  sql.NullBool    `db:"machine_working"`
+	MachineType     NullString      `db:"machine_type"`
+	MachineCapacity sql.NullFloat64 `db:"machine_capacity"`
+}
+
+// GetSlots will return a list of all slots in a room and it's machines. Slots
+// and machines are fetched in a single query.
+func GetSlots(roomID int) ([]Slot, *errors.LaundryError) {
 	db := database.GetGoqu()
-	var slots []Slot
 
-	if err := db.From("slots").ScanStructs(&slots); err != nil {
-		return slots, errors.New("Could not get slots").CausedBy(err)
+	query := db.From("slots").
+		Select(
+			"slots.*",
+			goqu.I("machines.id").As("machine_id"),
+			goqu.I("machines.id_rooms").As("machine_id_rooms"),
+			goqu.I("machines.info").As("machine_info"),
+			goqu.I("machines.working").As("machine_working"),
+			goqu.I("machines.type").As("machine_type"),
+			goqu.I("machines.capacity").As("machine_capacity"),
+		).
+		LeftJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_slots").Eq(goqu.I("slots.id")))).
+		LeftJoin(goqu.I("machines"), goqu.On(goqu.I("machines.id").Eq(goqu.I("slots_machines.id_machines")))).
+		Where(goqu.I("slots.id_rooms").Eq(roomID)).
+		Order(goqu.I("slots.id").Asc(), goqu.I("machines.id").Asc())
+
+	var rows []slotMachineRow
+	if err := query.ScanStructs(&rows); err != nil {
+		return nil, errors.New("Could not get slots").CausedBy(err)
+	}
+
+	faulty, fErr := faultyMachines()
+	if fErr != nil {
+		return nil, fErr
 	}
 
-	for i, slot := range slots {
-		var machines []Machine
+	slots := slotsFromRows(rows)
 
-		err := db.From("machines").
-			Select("machines.*").
-			LeftJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_machines").Eq(goqu.I("machines.id")))).
-			Where(
-				goqu.I("slots_machines.id_slots").Eq(slot.ID),
-			).ScanStructs(&machines)
+	for i := range slots {
+		markFaulty(slots[i].Machines, faulty)
+	}
 
-		if err != nil {
-			log.GetLogger().Errorf("Could not get machines: %s", err)
-			return slots, errors.New(err)
+	return slots, nil
+}
+
+// slotsFromRows will group rows of slots joined with machines ordered by slot
+// id to a list of slots with their machines.
+func slotsFromRows(rows []slotMachineRow) []Slot {
+	var slots []Slot
+
+	for _, row := range rows {
+		if len(slots) == 0 || slots[len(slots)-1].ID != row.Slot.ID {
+			slot := row.Slot
+			slot.Machines = []Machine{}
+
+			slots = append(slots, slot)
 		}
 
-		slots[i].Machines = machines
+		if !row.MachineID.Valid {
+			continue
+		}
 
+		last := &slots[len(slots)-1]
+		last.Machines = append(last.Machines, Machine{
+			ID:       int(row.MachineID.Int64),
+			RoomID:   int(row.MachineRoomID.Int64),
+			Info:     row.MachineInfo.String,
+			Working:  row.MachineWorking.Bool,
+			Type:     MachineType(row.MachineType.String),
+			Capacity: row.MachineCapacity.Float64,
+		})
 	}
 
-	return slots, nil
+	return slots
 }
 
-// AddSlot will create a new slot
+// AddSlot will create a new recurring slot in a slot set with the machines
+// in MachineIDs. The slot may not overlap any other slot in the set sharing
+// any of it's machines.
 func AddSlot(s *Slot) (*Slot, *errors.LaundryError) {
+	if !s.SetID.Valid {
+		return nil, errors.New("Missing slot set id in request").WithStatus(http.StatusBadRequest)
+	}
+
+	s.Recurring = true
+
+	return addSlot(s)
+}
+
+func addSlot(s *Slot) (*Slot, *errors.LaundryError) {
 	if err := validSlot(s); err != nil {
 		return nil, err
 	}
 
+	// Slots in a set always belong to the room of the set
+	if s.SetID.Valid {
+		ss, err := GetSlotSet(int(s.SetID.Int64))
+		if err != nil {
+			return nil, err
+		}
+
+		if s.RoomID > 0 && s.RoomID != ss.RoomID {
+			return nil, errors.New("Slot set with id %d is not in room %d", ss.ID, s.RoomID).WithStatus(http.StatusBadRequest)
+		}
+
+		s.RoomID = ss.RoomID
+	}
+
+	if _, err := GetRoom(s.RoomID); err != nil {
+		return nil, err
+	}
+
+	if s.Recurring {
+		if err := noOverlappingSlots(s, s.MachineIDs); err != nil {
+			return nil, err
+		}
+	}
+
 	db := database.GetGoqu()
 
 	insert := db.From("slots").Insert(goqu.Record{
-		"week_day":   s.Weekday,
-		"start_time": s.Start,
-		"end_time":   s.End,
+		"id_rooms":     s.RoomID,
+		"id_slot_sets": s.SetID,
+		"week_day":     s.Weekday,
+		"start_time":   s.Start,
+		"end_time":     s.End,
+		"recurring":    s.Recurring,
 	})
 
 	row, err := insert.Exec()
@@ -84,6 +195,12 @@ func AddSlot(s *Slot) (*Slot, *errors.LaundryError) {
 
 	s.ID = int(lastID)
 
+	if len(s.MachineIDs) > 0 {
+		if err := setSlotMachines(s, s.MachineIDs); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
@@ -104,10 +221,91 @@ func GetSlot(slotID int) (*Slot, *errors.LaundryError) {
 		return nil, errors.New("Slot with id %d not found", slotID).WithStatus(http.StatusNotFound)
 	}
 
+	machines, lErr := slotMachines(s.ID)
+	if lErr != nil {
+		return nil, lErr
+	}
+
+	s.Machines = machines
+
 	return &s, nil
 }
 
-// UpdateSlot will update an existing slot
+// slotMachines will return all machines belonging to a slot
+func slotMachines(slotID int) ([]Machine, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var machines []Machine
+
+	err := db.From("machines").
+		Select("machines.*").
+		LeftJoin(goqu.I("slots_machines"), goqu.On(goqu.I("slots_machines.id_machines").Eq(goqu.I("machines.id")))).
+		Where(
+			goqu.I("slots_machines.id_slots").Eq(slotID),
+		).ScanStructs(&machines)
+
+	if err != nil {
+		log.GetLogger().Errorf("Could not get machines: %s", err)
+		return machines, errors.New(err)
+	}
+
+	faulty, fErr := faultyMachines()
+	if fErr != nil {
+		return machines, fErr
+	}
+
+	markFaulty(machines, faulty)
+
+	return machines, nil
+}
+
+// setSlotMachines will replace the machines belonging to a slot with the
+// machines with passed ids. All machines must be in the same room as the slot.
+func setSlotMachines(s *Slot, machineIDs []int) *errors.LaundryError {
+	var machines []Machine
+
+	for _, id := range machineIDs {
+		m, err := GetMachine(id)
+		if err != nil {
+			return err
+		}
+
+		machines = append(machines, *m)
+	}
+
+	if err := machinesInRoom(machines, s.RoomID); err != nil {
+		return err
+	}
+
+	db := database.GetGoqu()
+
+	delete := db.From("slots_machines").Where(goqu.Ex{
+		"id_slots": s.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove machines from slot with id %d", s.ID).CausedBy(err)
+	}
+
+	for _, m := range machines {
+		insert := db.From("slots_machines").Insert(goqu.Record{
+			"id_slots":    s.ID,
+			"id_machines": m.ID,
+		})
+
+		if _, err := insert.Exec(); err != nil {
+			return errors.New("Could not add machine with id %d to slot with id %d", m.ID, s.ID).CausedBy(err)
+		}
+	}
+
+	s.Machines = machines
+
+	return nil
+}
+
+// UpdateSlot will update an existing slot and replace it's machines if
+// MachineIDs is set. Since bookings are bound to the slot it's not possible to
+// move a slot with future bookings, a new slot set should be used instead.
 func UpdateSlot(slotID int, s *Slot) (*Slot, *errors.LaundryError) {
 	if err := validSlot(s); err != nil {
 		return nil, err
@@ -118,10 +316,29 @@ func UpdateSlot(slotID int, s *Slot) (*Slot, *errors.LaundryError) {
 		return nil, err
 	}
 
+	if slot.Weekday != s.Weekday || slot.Start != s.Start || slot.End != s.End {
+		if err := noFutureBookings(slot); err != nil {
+			return nil, err
+		}
+	}
+
+	machineIDs := s.MachineIDs
+	if machineIDs == nil {
+		for _, m := range slot.Machines {
+			machineIDs = append(machineIDs, m.ID)
+		}
+	}
+
 	slot.Weekday = s.Weekday
 	slot.Start = s.Start
 	slot.End = s.End
 
+	if slot.Recurring {
+		if err := noOverlappingSlots(slot, machineIDs); err != nil {
+			return nil, err
+		}
+	}
+
 	db := database.GetGoqu()
 
 	update := db.From("slots").Where(goqu.Ex{
@@ -137,6 +354,51 @@ func UpdateSlot(slotID int, s *Slot) (*Slot, *errors.LaundryError) {
 		return nil, errors.New("Could not update slot with id %d", slot.ID).CausedBy(err)
 	}
 
+	if s.MachineIDs != nil {
+		if err := setSlotMachines(slot, s.MachineIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	return slot, nil
+}
+
+// AttachMachines will add the machines with passed ids to a slot, keeping the
+// machines already in the slot. Unlike UpdateSlot this is allowed for slots
+// with future bookings since the time of the slot doesn't change.
+func AttachMachines(slotID int, machineIDs []int) (*Slot, *errors.LaundryError) {
+	slot, err := GetSlot(slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		ids      []int
+		attached = map[int]bool{}
+	)
+
+	for _, m := range slot.Machines {
+		ids = append(ids, m.ID)
+		attached[m.ID] = true
+	}
+
+	for _, id := range machineIDs {
+		if !attached[id] {
+			ids = append(ids, id)
+			attached[id] = true
+		}
+	}
+
+	if slot.Recurring {
+		if err := noOverlappingSlots(slot, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setSlotMachines(slot, ids); err != nil {
+		return nil, err
+	}
+
 	return slot, nil
 }
 
@@ -155,6 +417,28 @@ func RemoveSlot(s *Slot) *errors.LaundryError {
 	return nil
 }
 
+// noFutureBookings returns an error if the slot is booked today or later
+func noFutureBookings(s *Slot) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	booked, err := db.From("bookings").
+		Where(
+			goqu.I("id_slots").Eq(s.ID),
+			goqu.I("book_date").Gte(today().Format("2006-01-02")),
+		).
+		Count()
+
+	if err != nil {
+		return errors.New("Could not get bookings").CausedBy(err)
+	}
+
+	if booked > 0 {
+		return errors.New("Slot with id %d has %d future booking(s), use a new slot set to change it", s.ID, booked).WithStatus(http.StatusConflict)
+	}
+
+	return nil
+}
+
 // RemoveSlotByID will remove a slot by a aslot id
 func RemoveSlotByID(id int) *errors.LaundryError {
 	slot, err := GetSlot(id)
@@ -165,6 +449,125 @@ func RemoveSlotByID(id int) *errors.LaundryError {
 	return RemoveSlot(slot)
 }
 
+// HasMachineType returns true if any of the machines in the slot is of the
+// given type
+func (s Slot) HasMachineType(t MachineType) bool {
+	for _, m := range s.Machines {
+		if m.Type == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// noOverlappingSlots returns an error if any other recurring slot in the same
+// slot set overlaps the slot and shares any of the machines with passed ids.
+func noOverlappingSlots(s *Slot, machineIDs []int) *errors.LaundryError {
+	if len(machineIDs) == 0 {
+		return nil
+	}
+
+	slots, err := GetSlots(s.RoomID)
+	if err != nil {
+		return err
+	}
+
+	overlapping := overlappingSlots(*s, machineIDs, slots)
+	if len(overlapping) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, id := range overlapping {
+		ids = append(ids, strconv.Itoa(id))
+	}
+
+	return errors.New("Slot overlaps slot(s) with id %s sharing the same machines", strings.Join(ids, ", ")).WithStatus(http.StatusConflict)
+}
+
+// overlappingSlots returns the ids of all recurring slots in the same slot set
+// as s which overlaps s and has any of the machines with passed ids.
+func overlappingSlots(s Slot, machineIDs []int, slots []Slot) []int {
+	var ids []int
+
+	for _, other := range slots {
+		if other.ID == s.ID || !other.Recurring || other.SetID != s.SetID {
+			continue
+		}
+
+		if !sharesMachine(other, machineIDs) || !s.overlaps(other) {
+			continue
+		}
+
+		ids = append(ids, other.ID)
+	}
+
+	return ids
+}
+
+// sharesMachine returns true if any of the machines in the slot has any of the
+// passed ids
+func sharesMachine(s Slot, machineIDs []int) bool {
+	for _, m := range s.Machines {
+		for _, id := range machineIDs {
+			if m.ID == id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// week is used to wrap slots at the end of the week to the start
+const week = 7 * 24 * time.Hour
+
+// StartOffset returns the time since midnight when the slot starts
+func (s Slot) StartOffset() time.Duration {
+	offset, _ := clockDuration(s.Start)
+
+	return offset
+}
+
+// Duration returns the length of the slot. A slot ending before it starts
+// ends the day after.
+func (s Slot) Duration() time.Duration {
+	_, duration, _ := slotTimes(s.Start, s.End)
+
+	return duration
+}
+
+// StartsAt returns the time in the building time zone the slot starts when
+// held at the given date
+func (s Slot) StartsAt(date time.Time) time.Time {
+	return atClock(date, s.StartOffset())
+}
+
+// EndsAt returns the time in the building time zone the slot ends when held
+// at the given date. A slot spanning midnight ends the day after.
+func (s Slot) EndsAt(date time.Time) time.Time {
+	return atClock(date, s.StartOffset()+s.Duration())
+}
+
+// overlaps returns true if the slots overlaps at any time during the week.
+// Slots held late on saturday is compared with slots early on sunday.
+func (s Slot) overlaps(other Slot) bool {
+	start := time.Duration(s.Weekday)*24*time.Hour + s.StartOffset()
+	end := start + s.Duration()
+
+	oStart := time.Duration(other.Weekday)*24*time.Hour + other.StartOffset()
+	oEnd := oStart + other.Duration()
+
+	for _, shift := range []time.Duration{-week, 0, week} {
+		if start < oEnd+shift && oStart+shift < end {
+			return true
+		}
+	}
+
+	return false
+}
+
 func validSlot(s *Slot) *errors.LaundryError {
 	// Valid day provided
 	switch s.Weekday {
@@ -175,7 +578,7 @@ func validSlot(s *Slot) *errors.LaundryError {
 	}
 
 	// Valid start- and end time provided
-	if _, _, err := timeIntervals(s.Start, s.End); err != nil {
+	if _, _, err := slotTimes(s.Start, s.End); err != nil {
 		return err
 	}
 
@@ -184,61 +587,131 @@ func validSlot(s *Slot) *errors.LaundryError {
 
 // GetIntervalSchedule will return a schedule between a given start- and end time.
 // A map for each day will be returned holding a list of slots and possible bookers
-// for the given slot.
-func GetIntervalSchedule(start, end string) (map[time.Time][]SlotWithBooker, *errors.LaundryError) {
+// for the given slot. Only slots matching the passed ScheduleFilter will be included.
+func GetIntervalSchedule(start, end string, filter ScheduleFilter) (map[time.Time][]SlotWithBooker, *errors.LaundryError) {
 	sTime, eTime, err := dateIntervals(start, end)
 	if err != nil {
 		return nil, errors.New(err)
 	}
 
-	// All slots in the system
-	slots, _ := GetSlots()
+	if filter.MachineType != "" && !filter.MachineType.Valid() {
+		return nil, errors.New("Invalid machine type '%s'", filter.MachineType).WithStatus(http.StatusBadRequest)
+	}
 
-	// All bookings in the system
-	bookings, sErr := SearchBookings(BookingsSearch{*sTime, *eTime, nil})
+	// All slots in the room
+	slots, gErr := GetSlots(filter.RoomID)
+	if gErr != nil {
+		return nil, gErr
+	}
+
+	// All bookings in the room
+	bookings, sErr := SearchBookings(BookingsSearch{
+		Start:  *sTime,
+		End:    *eTime,
+		RoomID: filter.RoomID,
+	})
 	if sErr != nil {
 		return nil, sErr
 	}
 
-	var month = make(map[time.Time][]SlotWithBooker)
+	// Maintenance windows which may close slots in the interval
+	windows, mErr := searchMaintenanceWindows(*sTime, *eTime)
+	if mErr != nil {
+		return nil, mErr
+	}
 
-	// Iterate from start date, add one day each iteration until we're at the end date
-	for d := *sTime; d != (*eTime).AddDate(0, 0, 1); d = d.AddDate(0, 0, 1) {
-		// SlotWithBooker is a slot in any given date which also includes a booker (if booker)
-		// Each day may have multiple slots with one booker each
-		var fs []SlotWithBooker
+	// Closures, changed hours and extra slots in the interval
+	overrides, oErr := searchSlotOverrides(filter.RoomID, *sTime, *eTime)
+	if oErr != nil {
+		return nil, oErr
+	}
+
+	// Slot sets deciding which recurring slots are used at each date
+	sets, ssErr := slotSetsByID(filter.RoomID)
+	if ssErr != nil {
+		return nil, ssErr
+	}
+
+	return buildSchedule(*sTime, *eTime, filter, slots, *bookings, sets, overrides, windows), nil
+}
+
+// bookingKey identifies a booking by the booked date and slot
+type bookingKey struct {
+	date   string
+	slotID int
+}
+
+// buildSchedule will return the slots held each day between start and end
+// and their bookers. Bookings are indexed by date and slot so the schedule is
+// built in O(days * slots).
+func buildSchedule(start, end time.Time, filter ScheduleFilter, slots []Slot, bookings []BookerBookings, sets map[int]SlotSet, overrides []SlotOverride, windows []MaintenanceWindow) map[time.Time][]SlotWithBooker {
+	var bookers = make(map[bookingKey]Booker, len(bookings))
+
+	for _, b := range bookings {
+		bookers[bookingKey{b.BookDate.Format("2006-01-02"), b.Slot.ID}] = b.Booker
+	}
+
+	// Ignore slots without any machine of the requested type
+	if filter.MachineType != "" {
+		var filtered []Slot
 
-		// Iterate over all slots for every given date
 		for _, s := range slots {
-			// Each slot is bound to a week day. If the slot isn't on the same week day
-			// as the current iteration, ignore it
-			if d.Weekday() != time.Weekday(s.Weekday) {
-				continue
+			if s.HasMachineType(filter.MachineType) {
+				filtered = append(filtered, s)
 			}
+		}
 
-			// Add the current slot to the date we're at in our iterator
+		slots = filtered
+	}
 
-			var full = SlotWithBooker{
-				Slot: s,
-			}
+	var month = make(map[time.Time][]SlotWithBooker)
 
-			// Iterate over all bookings and see if any of them are at this current day
-			// with the same start time as the slot
-			// TODO: This is crap and high complexity - fix
-			for _, b := range *bookings {
-				// If the booking is on the same date as the iterator and the booking start time
-				// is the same as the slot - add it to the result
-				if b.BookDate == d && s.Start == b.Slot.Start {
-					full.Booker = &b.Booker
-				}
-			}
+	// Iterate from start date, add one day each iteration until we're at the end date
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		// Each day may have multiple slots with one booker each
+		fs := daySlots(d, slots, sets, overrides, windows)
 
-			fs = append(fs, full)
+		for i := range fs {
+			if booker, ok := bookers[bookingKey{d.Format("2006-01-02"), fs[i].ID}]; ok {
+				booker := booker
+				fs[i].Booker = &booker
+			}
 		}
 
 		// Add all found slots, with or without booker, to the current date
 		month[d] = fs
 	}
 
-	return month, nil
+	return month
+}
+
+// daySlots will return all slots held at the given date. Recurring slots on
+// the same week day in the slot set in use and extra slots from overrides are
+// included and closures, changed hours and maintenance windows are applied.
+func daySlots(date time.Time, slots []Slot, sets map[int]SlotSet, overrides []SlotOverride, windows []MaintenanceWindow) []SlotWithBooker {
+	var ds []SlotWithBooker
+
+	for _, s := range slots {
+		if !slotHeld(s, date, sets, overrides) {
+			continue
+		}
+
+		var full = SlotWithBooker{
+			Slot: s,
+		}
+
+		applyOverrides(&full, date, overrides)
+		applyMaintenance(&full, date, windows)
+
+		full.StartsAt = full.Slot.StartsAt(date)
+		full.EndsAt = full.Slot.EndsAt(date)
+
+		ds = append(ds, full)
+	}
+
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].StartOffset() < ds[j].StartOffset()
+	})
+
+	return ds
 }
@@ -0,0 +1,353 @@
+package laundry
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+
+	return d
+}
+
+func TestDaySlots(t *testing.T) {
+	Convey("Given slots on mondays and tuesdays", t, func() {
+		slots := []Slot{
+			{ID: 1, RoomID: 1, Weekday: 1, Start: "10:00:00", End: "14:00:00", Recurring: true},
+			{ID: 2, RoomID: 1, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true},
+			{ID: 3, RoomID: 1, Weekday: 2, Start: "07:00:00", End: "10:00:00", Recurring: true},
+			{ID: 4, RoomID: 1, Weekday: 1, Start: "22:00:00", End: "23:00:00", Recurring: false},
+		}
+
+		monday := date("2018-05-07")
+
+		Convey("Only recurring slots on the same week day are held", func() {
+			ds := daySlots(monday, slots, nil, nil, nil)
+
+			So(len(ds), ShouldEqual, 2)
+			So(ds[0].ID, ShouldEqual, 2)
+			So(ds[1].ID, ShouldEqual, 1)
+			So(ds[0].Closed, ShouldBeFalse)
+		})
+
+		Convey("A room closure closes all slots", func() {
+			overrides := []SlotOverride{
+				{RoomID: 1, Kind: OverrideClosed, Start: monday, End: monday},
+			}
+
+			ds := daySlots(monday, slots, nil, overrides, nil)
+
+			So(len(ds), ShouldEqual, 2)
+			So(ds[0].Closed, ShouldBeTrue)
+			So(ds[1].Closed, ShouldBeTrue)
+		})
+
+		Convey("A closure in another room is ignored", func() {
+			overrides := []SlotOverride{
+				{RoomID: 2, Kind: OverrideClosed, Start: monday, End: monday},
+			}
+
+			ds := daySlots(monday, slots, nil, overrides, nil)
+
+			So(ds[0].Closed, ShouldBeFalse)
+		})
+
+		Convey("Changed hours only applies to the given slot", func() {
+			overrides := []SlotOverride{
+				{
+					RoomID:    1,
+					Kind:      OverrideHours,
+					Start:     date("2018-05-01"),
+					End:       date("2018-05-31"),
+					SlotID:    NullInt64{sql.NullInt64{Int64: 1, Valid: true}},
+					StartTime: NullString{sql.NullString{String: "11:00:00", Valid: true}},
+					EndTime:   NullString{sql.NullString{String: "15:00:00", Valid: true}},
+				},
+			}
+
+			ds := daySlots(monday, slots, nil, overrides, nil)
+
+			So(ds[0].ID, ShouldEqual, 2)
+			So(ds[0].Start, ShouldEqual, "07:00:00")
+			So(ds[1].ID, ShouldEqual, 1)
+			So(ds[1].Start, ShouldEqual, "11:00:00")
+			So(ds[1].End, ShouldEqual, "15:00:00")
+		})
+
+		Convey("Extra slots are only held at the dates in the override", func() {
+			overrides := []SlotOverride{
+				{
+					RoomID: 1,
+					Kind:   OverrideExtra,
+					Start:  monday,
+					End:    monday,
+					SlotID: NullInt64{sql.NullInt64{Int64: 4, Valid: true}},
+				},
+			}
+
+			So(len(daySlots(monday, slots, nil, overrides, nil)), ShouldEqual, 3)
+			So(len(daySlots(monday.AddDate(0, 0, 7), slots, nil, overrides, nil)), ShouldEqual, 2)
+		})
+
+		Convey("Slots with all machines under maintenance are closed", func() {
+			slots[0].Machines = []Machine{{ID: 1}, {ID: 2}}
+			slots[1].Machines = []Machine{{ID: 1}}
+
+			windows := []MaintenanceWindow{
+				{MachineID: 1, Start: monday, End: monday},
+			}
+
+			ds := daySlots(monday, slots, nil, nil, windows)
+
+			So(ds[0].Closed, ShouldBeTrue)
+			So(ds[1].Closed, ShouldBeFalse)
+			So(len(ds[1].Machines), ShouldEqual, 1)
+		})
+
+		Convey("Recurring slots are only held while their slot set is in use", func() {
+			sets := map[int]SlotSet{
+				1: {ID: 1, RoomID: 1, ValidFrom: date("2018-01-01")},
+				2: {
+					ID:        2,
+					RoomID:    1,
+					ValidFrom: date("2018-06-01"),
+					ValidTo:   NullTime{mysql.NullTime{Time: date("2018-08-31"), Valid: true}},
+				},
+			}
+
+			setSlots := []Slot{
+				{ID: 1, RoomID: 1, SetID: NullInt64{sql.NullInt64{Int64: 1, Valid: true}}, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true},
+				{ID: 2, RoomID: 1, SetID: NullInt64{sql.NullInt64{Int64: 2, Valid: true}}, Weekday: 1, Start: "08:00:00", End: "12:00:00", Recurring: true},
+			}
+
+			before := daySlots(monday, setSlots, sets, nil, nil)
+			summer := daySlots(date("2018-06-04"), setSlots, sets, nil, nil)
+			after := daySlots(date("2018-09-03"), setSlots, sets, nil, nil)
+
+			So(len(before), ShouldEqual, 1)
+			So(before[0].ID, ShouldEqual, 1)
+			So(len(summer), ShouldEqual, 1)
+			So(summer[0].ID, ShouldEqual, 2)
+			So(len(after), ShouldEqual, 1)
+			So(after[0].ID, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestOverlappingSlots(t *testing.T) {
+	Convey("Given slots sharing machines", t, func() {
+		set := NullInt64{sql.NullInt64{Int64: 1, Valid: true}}
+
+		slots := []Slot{
+			{ID: 1, RoomID: 1, SetID: set, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true, Machines: []Machine{{ID: 1}}},
+			{ID: 2, RoomID: 1, SetID: set, Weekday: 1, Start: "09:00:00", End: "12:00:00", Recurring: true, Machines: []Machine{{ID: 2}}},
+			{ID: 3, RoomID: 1, SetID: set, Weekday: 0, Start: "00:00:00", End: "02:00:00", Recurring: true, Machines: []Machine{{ID: 1}}},
+			{ID: 4, RoomID: 1, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true, Machines: []Machine{{ID: 1}}},
+		}
+
+		Convey("Slots overlapping with the same machine conflicts", func() {
+			s := Slot{SetID: set, Weekday: 1, Start: "08:00:00", End: "09:30:00", Recurring: true}
+
+			So(overlappingSlots(s, []int{1}, slots), ShouldResemble, []int{1})
+			So(overlappingSlots(s, []int{1, 2}, slots), ShouldResemble, []int{1, 2})
+			So(overlappingSlots(s, []int{3}, slots), ShouldBeEmpty)
+		})
+
+		Convey("Adjacent slots does not overlap", func() {
+			s := Slot{SetID: set, Weekday: 1, Start: "10:00:00", End: "11:00:00", Recurring: true}
+
+			So(overlappingSlots(s, []int{1}, slots), ShouldBeEmpty)
+		})
+
+		Convey("A slot is not compared with itself", func() {
+			So(overlappingSlots(slots[0], []int{1}, slots), ShouldBeEmpty)
+		})
+
+		Convey("Slots across midnight overlaps slots the day after", func() {
+			s := Slot{SetID: set, Weekday: 6, Start: "23:00:00", End: "01:00:00", Recurring: true}
+
+			So(overlappingSlots(s, []int{1}, slots), ShouldResemble, []int{3})
+		})
+	})
+}
+
+func TestSlotTimes(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "UTC"})
+
+	Convey("Given slots during the day and across midnight", t, func() {
+		day := Slot{Weekday: 1, Start: "07:00:00", End: "10:30:00"}
+		night := Slot{Weekday: 1, Start: "20:00:00", End: "01:00:00"}
+
+		Convey("The duration spans to the day after", func() {
+			So(day.Duration(), ShouldEqual, 3*time.Hour+30*time.Minute)
+			So(night.Duration(), ShouldEqual, 5*time.Hour)
+		})
+
+		Convey("The slot belongs to the date it starts", func() {
+			monday := date("2018-05-07")
+
+			So(night.StartsAt(monday), ShouldResemble, time.Date(2018, 5, 7, 20, 0, 0, 0, time.UTC))
+			So(night.EndsAt(monday), ShouldResemble, time.Date(2018, 5, 8, 1, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Slots are sorted by start time", func() {
+			slots := []Slot{
+				{ID: 1, RoomID: 1, Weekday: 1, Start: "20:00:00", End: "01:00:00", Recurring: true},
+				{ID: 2, RoomID: 1, Weekday: 1, Start: "09:00:00", End: "12:00:00", Recurring: true},
+			}
+
+			ds := daySlots(date("2018-05-07"), slots, nil, nil, nil)
+
+			So(ds[0].ID, ShouldEqual, 2)
+			So(ds[1].ID, ShouldEqual, 1)
+		})
+
+		Convey("Invalid or empty intervals are rejected", func() {
+			_, _, err := slotTimes("10:00:00", "10:00:00")
+			So(err, ShouldNotBeNil)
+
+			_, _, err = slotTimes("25:00:00", "10:00:00")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestTimeZones(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "Europe/Stockholm"})
+
+	stockholm, _ := time.LoadLocation("Europe/Stockholm")
+
+	Convey("Given slots in a building in Stockholm", t, func() {
+		morning := Slot{ID: 1, RoomID: 1, Weekday: 0, Start: "01:00:00", End: "04:00:00", Recurring: true}
+		night := Slot{ID: 2, RoomID: 1, Weekday: 6, Start: "22:00:00", End: "04:00:00", Recurring: true}
+
+		Convey("Slot times are wall clock times in the building time zone", func() {
+			ds := daySlots(date("2018-05-06"), []Slot{morning}, nil, nil, nil)
+
+			So(ds[0].StartsAt.Location().String(), ShouldEqual, "Europe/Stockholm")
+			So(ds[0].StartsAt.UTC(), ShouldResemble, time.Date(2018, 5, 5, 23, 0, 0, 0, time.UTC))
+		})
+
+		Convey("Slots are one hour shorter when the clock is set forward", func() {
+			sunday := date("2018-03-25")
+
+			So(morning.StartsAt(sunday), ShouldResemble, time.Date(2018, 3, 25, 1, 0, 0, 0, stockholm))
+			So(morning.EndsAt(sunday), ShouldResemble, time.Date(2018, 3, 25, 4, 0, 0, 0, stockholm))
+			So(morning.EndsAt(sunday).Sub(morning.StartsAt(sunday)), ShouldEqual, 2*time.Hour)
+
+			saturday := date("2018-03-24")
+			So(night.EndsAt(saturday).Sub(night.StartsAt(saturday)), ShouldEqual, 5*time.Hour)
+		})
+
+		Convey("Slots are one hour longer when the clock is set back", func() {
+			sunday := date("2018-10-28")
+
+			So(morning.EndsAt(sunday).Sub(morning.StartsAt(sunday)), ShouldEqual, 4*time.Hour)
+
+			saturday := date("2018-10-27")
+			So(night.EndsAt(saturday).Sub(night.StartsAt(saturday)), ShouldEqual, 7*time.Hour)
+		})
+
+		Convey("Notifications fire ahead of the slot start in the building time zone", func() {
+			n := Notification{Ahead: 60}
+			slot := Slot{Weekday: 0, Start: "10:00:00", End: "12:00:00"}
+
+			So(n.FiresAt(slot, date("2018-03-25")).UTC(), ShouldResemble, time.Date(2018, 3, 25, 7, 0, 0, 0, time.UTC))
+			So(n.FiresAt(slot, date("2018-10-28")).UTC(), ShouldResemble, time.Date(2018, 10, 28, 8, 0, 0, 0, time.UTC))
+		})
+	})
+}
+
+func TestSlotsFromRows(t *testing.T) {
+	Convey("Given slots joined with their machines", t, func() {
+		rows := []slotMachineRow{
+			{Slot: Slot{ID: 1}, MachineID: NullInt64{sql.NullInt64{Int64: 1, Valid: true}}},
+			{Slot: Slot{ID: 1}, MachineID: NullInt64{sql.NullInt64{Int64: 2, Valid: true}}},
+			{Slot: Slot{ID: 2}},
+		}
+
+		Convey("Each slot is returned once with all it's machines", func() {
+			slots := slotsFromRows(rows)
+
+			So(len(slots), ShouldEqual, 2)
+			So(len(slots[0].Machines), ShouldEqual, 2)
+			So(slots[0].Machines[1].ID, ShouldEqual, 2)
+			So(slots[1].Machines, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestBuildSchedule(t *testing.T) {
+	config.SetConfig(&config.Configuration{TimeZone: "UTC"})
+
+	Convey("Given slots and bookings", t, func() {
+		slots := []Slot{
+			{ID: 1, RoomID: 1, Weekday: 1, Start: "07:00:00", End: "10:00:00", Recurring: true, Machines: []Machine{{ID: 1, Type: MachineWasher}}},
+			{ID: 2, RoomID: 1, Weekday: 1, Start: "10:00:00", End: "13:00:00", Recurring: true, Machines: []Machine{{ID: 2, Type: MachineDryer}}},
+		}
+
+		bookings := []BookerBookings{
+			{BookDate: date("2018-05-07"), Slot: Slot{ID: 2}, Booker: Booker{ID: 1}},
+		}
+
+		Convey("Bookers are added to the booked slot at the booked date", func() {
+			schedule := buildSchedule(date("2018-05-07"), date("2018-05-14"), ScheduleFilter{}, slots, bookings, nil, nil, nil)
+
+			So(len(schedule), ShouldEqual, 8)
+			So(schedule[date("2018-05-07")][0].Booker, ShouldBeNil)
+			So(schedule[date("2018-05-07")][1].Booker.ID, ShouldEqual, 1)
+			So(schedule[date("2018-05-14")][1].Booker, ShouldBeNil)
+			So(schedule[date("2018-05-08")], ShouldBeEmpty)
+		})
+
+		Convey("Slots without the requested machine type are excluded", func() {
+			schedule := buildSchedule(date("2018-05-07"), date("2018-05-07"), ScheduleFilter{MachineType: MachineDryer}, slots, bookings, nil, nil, nil)
+
+			So(len(schedule[date("2018-05-07")]), ShouldEqual, 1)
+			So(schedule[date("2018-05-07")][0].ID, ShouldEqual, 2)
+		})
+	})
+}
+
+func BenchmarkBuildSchedule(b *testing.B) {
+	config.SetConfig(&config.Configuration{TimeZone: "UTC"})
+
+	start, end := date("2018-01-01"), date("2018-12-31")
+
+	var slots []Slot
+	for weekday := 0; weekday < 7; weekday++ {
+		for hour := 7; hour < 22; hour += 3 {
+			slots = append(slots, Slot{
+				ID:        len(slots) + 1,
+				RoomID:    1,
+				Weekday:   weekday,
+				Start:     time.Date(0, 1, 1, hour, 0, 0, 0, time.UTC).Format("15:04:05"),
+				End:       time.Date(0, 1, 1, hour+3, 0, 0, 0, time.UTC).Format("15:04:05"),
+				Recurring: true,
+				Machines:  []Machine{{ID: 1}, {ID: 2}},
+			})
+		}
+	}
+
+	// Every slot is booked every week
+	var bookings []BookerBookings
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		for _, s := range slots {
+			if time.Weekday(s.Weekday) == d.Weekday() {
+				bookings = append(bookings, BookerBookings{BookDate: d, Slot: s, Booker: Booker{ID: s.ID}})
+			}
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buildSchedule(start, end, ScheduleFilter{}, slots, bookings, nil, nil, nil)
+	}
+}
@@ -0,0 +1,322 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// SlotSet represents a weekly timetable for a room. Each recurring slot
+// belongs to a set and is only held at the dates where it's set is in use. If
+// multiple sets are valid at a date the one starting the latest is used, so a
+// set without an end date is used until a newer set starts and a set for i.e.
+// summer hours can be added on top of it.
+type SlotSet struct {
+	ID        int       `db:"id"         json:"id"`
+	RoomID    int       `db:"id_rooms"   json:"room_id"`
+	Name      string    `db:"name"       json:"name"`
+	ValidFrom time.Time `db:"valid_from" json:"valid_from"`
+	ValidTo   NullTime  `db:"valid_to"   json:"valid_to"`
+	CopyFrom  int       `db:"-"          json:"copy_from,omitempty"`
+	Slots     []Slot    `db:"-"          json:"slots,omitempty"`
+}
+
+// GetSlotSets will return all slot sets in a room, the oldest first.
+func GetSlotSets(roomID int) ([]SlotSet, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	query := db.From("slot_sets").
+		Where(goqu.Ex{"id_rooms": roomID}).
+		Order(goqu.I("valid_from").Asc())
+
+	var sets []SlotSet
+	if err := query.ScanStructs(&sets); err != nil {
+		return sets, errors.New("Could not get slot sets").CausedBy(err)
+	}
+
+	return sets, nil
+}
+
+// GetSlotSet will return the SlotSet with passed ID and it's slots
+func GetSlotSet(id int) (*SlotSet, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var ss SlotSet
+	found, err := db.From("slot_sets").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&ss)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Slot set with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	if err := db.From("slots").Where(goqu.Ex{"id_slot_sets": ss.ID}).ScanStructs(&ss.Slots); err != nil {
+		return nil, errors.New("Could not get slots").CausedBy(err)
+	}
+
+	for i, s := range ss.Slots {
+		machines, err := slotMachines(s.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		ss.Slots[i].Machines = machines
+	}
+
+	return &ss, nil
+}
+
+// AddSlotSet will add a new slot set to a room. The new set will replace
+// older sets from it's valid from date which is not allowed if any of them
+// has bookings at those dates. If CopyFrom is set all slots and their
+// machines will be copied from that set.
+func AddSlotSet(ss *SlotSet) (*SlotSet, *errors.LaundryError) {
+	if ss.Name == "" {
+		return nil, errors.New("Missing name in request").WithStatus(http.StatusBadRequest)
+	}
+
+	if ss.ValidFrom.IsZero() {
+		return nil, errors.New("Missing valid from date").WithStatus(http.StatusBadRequest)
+	}
+
+	if ss.ValidTo.Valid && ss.ValidFrom.After(ss.ValidTo.Time) {
+		return nil, errors.New("Valid from cannot be after valid to").WithStatus(http.StatusBadRequest)
+	}
+
+	if _, err := GetRoom(ss.RoomID); err != nil {
+		return nil, err
+	}
+
+	var source *SlotSet
+
+	if ss.CopyFrom > 0 {
+		src, err := GetSlotSet(ss.CopyFrom)
+		if err != nil {
+			return nil, err
+		}
+
+		if src.RoomID != ss.RoomID {
+			return nil, errors.New("Slot set with id %d is not in room %d", src.ID, ss.RoomID).WithStatus(http.StatusBadRequest)
+		}
+
+		source = src
+	}
+
+	sets, err := GetSlotSets(ss.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, other := range sets {
+		if other.ValidFrom.Equal(ss.ValidFrom) {
+			return nil, errors.New("Slot set with id %d is also valid from %s", other.ID, ss.ValidFrom.Format("2006-01-02")).WithStatus(http.StatusConflict)
+		}
+
+		// Sets starting after the new set will still be used at their dates
+		if other.ValidFrom.After(ss.ValidFrom) {
+			continue
+		}
+
+		if err := noBookingsBetween(other.ID, ss.ValidFrom, ss.ValidTo); err != nil {
+			return nil, err
+		}
+	}
+
+	db := database.GetGoqu()
+
+	insert := db.From("slot_sets").Insert(goqu.Record{
+		"id_rooms":   ss.RoomID,
+		"name":       ss.Name,
+		"valid_from": ss.ValidFrom.Format("2006-01-02"),
+		"valid_to":   ss.ValidTo,
+	})
+
+	row, iErr := insert.Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not create slot set").CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	ss.ID = int(lastID)
+
+	if source == nil {
+		return ss, nil
+	}
+
+	for _, s := range source.Slots {
+		var machineIDs []int
+		for _, m := range s.Machines {
+			machineIDs = append(machineIDs, m.ID)
+		}
+
+		s.ID = 0
+		s.SetID.Int64, s.SetID.Valid = int64(ss.ID), true
+
+		if _, err := addSlot(&s); err != nil {
+			return nil, err
+		}
+
+		if err := setSlotMachines(&s, machineIDs); err != nil {
+			return nil, err
+		}
+
+		ss.Slots = append(ss.Slots, s)
+	}
+
+	return ss, nil
+}
+
+// UpdateSlotSet will update the name of a slot set
+func UpdateSlotSet(id int, uss *SlotSet) (*SlotSet, *errors.LaundryError) {
+	ss, err := GetSlotSet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if uss.Name == "" {
+		return nil, errors.New("Missing field name").WithStatus(http.StatusBadRequest)
+	}
+
+	ss.Name = uss.Name
+
+	db := database.GetGoqu()
+
+	update := db.From("slot_sets").
+		Where(goqu.Ex{
+			"id": ss.ID,
+		}).
+		Update(goqu.Record{
+			"name": ss.Name,
+		})
+
+	if _, err := update.Exec(); err != nil {
+		return nil, errors.New("Could not update slot set with id %d", ss.ID).CausedBy(err)
+	}
+
+	return ss, nil
+}
+
+// RemoveSlotSet will remove a slot set and it's slots. A set with bookings
+// cannot be removed.
+func RemoveSlotSet(ss *SlotSet) *errors.LaundryError {
+	if err := noBookingsBetween(ss.ID, time.Time{}, NullTime{}); err != nil {
+		return err
+	}
+
+	db := database.GetGoqu()
+
+	delete := db.From("slot_sets").
+		Where(goqu.Ex{
+			"id": ss.ID,
+		}).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove slot set with id %d", ss.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveSlotSetByID will remove a slot set by the slot set id
+func RemoveSlotSetByID(id int) *errors.LaundryError {
+	ss, err := GetSlotSet(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveSlotSet(ss)
+}
+
+// slotSetsByID will return all slot sets in a room mapped by their id.
+func slotSetsByID(roomID int) (map[int]SlotSet, *errors.LaundryError) {
+	sets, err := GetSlotSets(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var byID = make(map[int]SlotSet)
+
+	for _, ss := range sets {
+		byID[ss.ID] = ss
+	}
+
+	return byID, nil
+}
+
+// noBookingsBetween returns an error if any slot in the slot set is booked
+// between the given dates. If to isn't valid all bookings from the start date
+// will be considered.
+func noBookingsBetween(setID int, from time.Time, to NullTime) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	query := db.From("bookings").
+		LeftJoin(goqu.I("slots"), goqu.On(goqu.I("slots.id").Eq(goqu.I("bookings.id_slots")))).
+		Where(
+			goqu.I("slots.id_slot_sets").Eq(setID),
+			goqu.I("bookings.book_date").Gte(from.Format("2006-01-02")),
+		)
+
+	if to.Valid {
+		query = query.Where(
+			goqu.I("bookings.book_date").Lte(to.Time.Format("2006-01-02")),
+		)
+	}
+
+	booked, err := query.Count()
+	if err != nil {
+		return errors.New("Could not get bookings").CausedBy(err)
+	}
+
+	if booked > 0 {
+		return errors.New("Slot set with id %d has %d booking(s) from %s", setID, booked, from.Format("2006-01-02")).WithStatus(http.StatusConflict)
+	}
+
+	return nil
+}
+
+// validAt returns true if the slot set is valid at the given date
+func (ss SlotSet) validAt(date time.Time) bool {
+	if date.Before(ss.ValidFrom) {
+		return false
+	}
+
+	return !ss.ValidTo.Valid || !date.After(ss.ValidTo.Time)
+}
+
+// activeSlotSet returns the id of the slot set in use in a room at the given
+// date. The set valid at the date which starts the latest will be used. If no
+// set is valid 0 is returned.
+func activeSlotSet(roomID int, date time.Time, sets map[int]SlotSet) int {
+	var active *SlotSet
+
+	for _, ss := range sets {
+		if ss.RoomID != roomID || !ss.validAt(date) {
+			continue
+		}
+
+		if active == nil || ss.ValidFrom.After(active.ValidFrom) {
+			current := ss
+			active = &current
+		}
+	}
+
+	if active == nil {
+		return 0
+	}
+
+	return active.ID
+}
@@ -0,0 +1,379 @@
+package laundry
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// SwapStatus represents where in the flow a swap request is
+type SwapStatus string
+
+// The states of a swap request, only pending requests may be answered
+const (
+	SwapPending   SwapStatus = "pending"
+	SwapAccepted  SwapStatus = "accepted"
+	SwapDeclined  SwapStatus = "declined"
+	SwapCancelled SwapStatus = "cancelled"
+)
+
+// Swap represents a request from one booker to exchange its booking with the
+// booking of another booker. When accepted the bookers of the two bookings
+// are exchanged.
+type Swap struct {
+	ID            int        `db:"id"               json:"id"`
+	FromBookingID int        `db:"id_from_bookings" json:"from_booking_id"`
+	ToBookingID   int        `db:"id_to_bookings"   json:"to_booking_id"`
+	FromBookerID  int        `db:"id_from_booker"   json:"from_booker_id"`
+	ToBookerID    int        `db:"id_to_booker"     json:"to_booker_id"`
+	Status        SwapStatus `db:"status"           json:"status"`
+	CreatedAt     time.Time  `db:"created_at"       json:"created_at"`
+	AnsweredAt    NullTime   `db:"answered_at"      json:"answered_at"`
+}
+
+// SwapHook is called every time a swap request is created or answered, i.e.
+// to notify the bookers
+type SwapHook func(s Swap)
+
+var (
+	swapHooks   []SwapHook
+	swapHooksMu sync.RWMutex
+)
+
+// OnSwap will add a hook called every time a swap request changes
+func OnSwap(h SwapHook) {
+	swapHooksMu.Lock()
+	defer swapHooksMu.Unlock()
+
+	swapHooks = append(swapHooks, h)
+}
+
+// swapped will call all swap hooks
+func swapped(s Swap) {
+	swapHooksMu.RLock()
+	defer swapHooksMu.RUnlock()
+
+	for _, h := range swapHooks {
+		h(s)
+	}
+}
+
+// GetSwap will return a swap request based on an id
+func GetSwap(id int) (*Swap, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var s Swap
+	found, err := db.From("swaps").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&s)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Swap with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &s, nil
+}
+
+// GetBookerSwaps will return all pending swap requests from or to a booker
+func GetBookerSwaps(bookerID int) ([]Swap, *errors.LaundryError) {
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var swaps = []Swap{}
+
+	err := db.From("swaps").
+		Where(
+			goqu.I("status").Eq(string(SwapPending)),
+			goqu.Or(
+				goqu.I("id_from_booker").Eq(bookerID),
+				goqu.I("id_to_booker").Eq(bookerID),
+			),
+		).
+		Order(goqu.I("created_at").Asc()).
+		ScanStructs(&swaps)
+
+	if err != nil {
+		return nil, errors.New("Could not get swaps").CausedBy(err)
+	}
+
+	return swaps, nil
+}
+
+// AddSwap will request to exchange the booking with id FromBookingID with the
+// booking with id ToBookingID. Both bookings must be in the same property and
+// none of the slots may have started.
+func AddSwap(s *Swap) (*Swap, *errors.LaundryError) {
+	from, to, err := swapBookings(s.FromBookingID, s.ToBookingID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if from.BookerID == to.BookerID {
+		return nil, errors.New("Cannot swap bookings with the same booker").WithStatus(http.StatusBadRequest)
+	}
+
+	db := database.GetGoqu()
+
+	pending, cErr := db.From("swaps").Where(goqu.Ex{
+		"id_from_bookings": from.ID,
+		"id_to_bookings":   to.ID,
+		"status":           string(SwapPending),
+	}).Count()
+
+	if cErr != nil {
+		return nil, errors.New("Could not get swaps").CausedBy(cErr)
+	}
+
+	if pending > 0 {
+		return nil, errors.New("Swap of booking %d and %d is already requested", from.ID, to.ID).WithStatus(http.StatusConflict)
+	}
+
+	s.FromBookerID = from.BookerID
+	s.ToBookerID = to.BookerID
+	s.Status = SwapPending
+	s.CreatedAt = time.Now()
+	s.AnsweredAt = NullTime{}
+
+	insert := db.From("swaps").Insert(goqu.Record{
+		"id_from_bookings": s.FromBookingID,
+		"id_to_bookings":   s.ToBookingID,
+		"id_from_booker":   s.FromBookerID,
+		"id_to_booker":     s.ToBookerID,
+		"status":           string(s.Status),
+		"created_at":       s.CreatedAt,
+	})
+
+	row, iErr := insert.Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not create swap").CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	s.ID = int(lastID)
+
+	swapped(*s)
+
+	return s, nil
+}
+
+// AcceptSwap will exchange the bookers of the two bookings in one transaction.
+// The swap fails without changing anything if any of the bookings have changed
+// booker since the swap was requested.
+func AcceptSwap(id int) (*Swap, *errors.LaundryError) {
+	s, err := pendingSwap(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := swapBookings(s.FromBookingID, s.ToBookingID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	tx, tErr := database.GetGoqu().Begin()
+	if tErr != nil {
+		return nil, errors.New("Could not start transaction").WithStatus(http.StatusInternalServerError).CausedBy(tErr)
+	}
+
+	s.Status = SwapAccepted
+	s.AnsweredAt.Time, s.AnsweredAt.Valid = time.Now(), true
+
+	if err := acceptSwap(tx, s); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New("Could not commit swap with id %d", id).WithStatus(http.StatusInternalServerError).CausedBy(err)
+	}
+
+	swapped(*s)
+
+	return s, nil
+}
+
+// DeclineSwap will decline a swap request
+func DeclineSwap(id int) (*Swap, *errors.LaundryError) {
+	return answerSwap(id, SwapDeclined)
+}
+
+// CancelSwap will cancel a swap request before it's answered
+func CancelSwap(id int) (*Swap, *errors.LaundryError) {
+	return answerSwap(id, SwapCancelled)
+}
+
+// acceptSwap will move each booking to the other booker and mark the swap as
+// accepted. The updates only match the bookings if they still have the same
+// booker so a swap is never applied to bookings changed meanwhile.
+func acceptSwap(tx *goqu.TxDatabase, s *Swap) *errors.LaundryError {
+	moves := []struct {
+		BookingID int
+		From      int
+		To        int
+	}{
+		{s.FromBookingID, s.FromBookerID, s.ToBookerID},
+		{s.ToBookingID, s.ToBookerID, s.FromBookerID},
+	}
+
+	for _, m := range moves {
+		update := tx.From("bookings").
+			Where(goqu.Ex{
+				"id":        m.BookingID,
+				"id_booker": m.From,
+			}).
+			Update(goqu.Record{
+				"id_booker": m.To,
+			})
+
+		if err := updatedOne(update, "Booking with id %d has changed since the swap was requested", m.BookingID); err != nil {
+			return err
+		}
+
+		// Reminders belong to the booker who set them up
+		delete := tx.From("notifications").
+			Where(goqu.Ex{
+				"id_bookings": m.BookingID,
+			}).
+			Delete()
+
+		if _, err := delete.Exec(); err != nil {
+			return errors.New("Could not remove notifications for booking with id %d", m.BookingID).CausedBy(err)
+		}
+	}
+
+	update := tx.From("swaps").
+		Where(goqu.Ex{
+			"id":     s.ID,
+			"status": string(SwapPending),
+		}).
+		Update(goqu.Record{
+			"status":      string(s.Status),
+			"answered_at": s.AnsweredAt.Time,
+		})
+
+	return updatedOne(update, "Swap with id %d is already answered", s.ID)
+}
+
+// answerSwap will set the status of a pending swap request
+func answerSwap(id int, status SwapStatus) (*Swap, *errors.LaundryError) {
+	s, err := pendingSwap(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Status = status
+	s.AnsweredAt.Time, s.AnsweredAt.Valid = time.Now(), true
+
+	db := database.GetGoqu()
+
+	update := db.From("swaps").
+		Where(goqu.Ex{
+			"id":     s.ID,
+			"status": string(SwapPending),
+		}).
+		Update(goqu.Record{
+			"status":      string(s.Status),
+			"answered_at": s.AnsweredAt.Time,
+		})
+
+	if err := updatedOne(update, "Swap with id %d is already answered", s.ID); err != nil {
+		return nil, err
+	}
+
+	swapped(*s)
+
+	return s, nil
+}
+
+// pendingSwap will return the swap request if it's not answered yet
+func pendingSwap(id int) (*Swap, *errors.LaundryError) {
+	s, err := GetSwap(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Status != SwapPending {
+		return nil, errors.New("Swap with id %d is already %s", id, s.Status).WithStatus(http.StatusConflict)
+	}
+
+	return s, nil
+}
+
+// swapBookings returns the two bookings to swap if they may be swapped at the
+// given time
+func swapBookings(fromID, toID int, at time.Time) (*Bookings, *Bookings, *errors.LaundryError) {
+	var (
+		bookings   []*Bookings
+		properties []int
+	)
+
+	for _, id := range []int{fromID, toID} {
+		b, err := GetBooking(id)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		booker, err := GetBooker(b.BookerID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if booker.ErasedAt.Valid {
+			return nil, nil, errors.New("Booker with ID %d is erased", booker.ID).WithStatus(http.StatusGone)
+		}
+
+		slot, err := GetSlot(b.SlotID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !at.Before(slot.StartsAt(b.BookDate)) {
+			return nil, nil, errors.New("Booking with id %d has already started", b.ID).WithStatus(http.StatusConflict)
+		}
+
+		bookings = append(bookings, b)
+		properties = append(properties, booker.PropertyID)
+	}
+
+	if properties[0] != properties[1] {
+		return nil, nil, errors.New("Cannot swap bookings in different properties").WithStatus(http.StatusForbidden)
+	}
+
+	return bookings[0], bookings[1], nil
+}
+
+// updatedOne will execute the update and return an error with the passed
+// message and a conflict status unless exactly one row was updated
+func updatedOne(update *goqu.CrudExec, format string, id int) *errors.LaundryError {
+	result, err := update.Exec()
+	if err != nil {
+		return errors.New(format, id).CausedBy(err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return errors.New(err)
+	}
+
+	if rows != 1 {
+		return errors.New(format, id).WithStatus(http.StatusConflict)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package laundry
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	. "github.com/smartystreets/goconvey/convey"
+	goqu "gopkg.in/doug-martin/goqu.v4"
+)
+
+func TestAcceptSwap(t *testing.T) {
+	if os.Getenv("LAUNDRY_DSN") == "" {
+		t.Skip("LAUNDRY_DSN not set, skipping test against the database")
+	}
+
+	Convey("Given a swap requested between two bookers", t, func() {
+		config.SetConfig(&config.Configuration{
+			TimeZone: "Europe/Stockholm",
+			Database: config.Database{PoolSize: 1},
+		})
+		database.SetupConnection(config.GetConfig().Database)
+
+		p, err := AddProperty(&Property{Name: "Swap test"})
+		So(err, ShouldBeNil)
+
+		defer RemoveProperty(p)
+
+		r, err := AddRoom(&Room{PropertyID: p.ID, Name: "Laundry room"})
+		So(err, ShouldBeNil)
+
+		date := today().AddDate(0, 0, 7)
+
+		ss, err := AddSlotSet(&SlotSet{RoomID: r.ID, Name: "Swap test", ValidFrom: date})
+		So(err, ShouldBeNil)
+
+		var bookings []*Bookings
+
+		for _, row := range []struct{ start, end, identifier string }{
+			{"07:00:00", "10:00:00", "1001"},
+			{"10:00:00", "13:00:00", "1002"},
+		} {
+			slot, err := AddSlot(&Slot{
+				SetID:   NullInt64{sql.NullInt64{Int64: int64(ss.ID), Valid: true}},
+				Weekday: int(date.Weekday()),
+				Start:   row.start,
+				End:     row.end,
+			})
+			So(err, ShouldBeNil)
+
+			booker, err := AddBooker(&Booker{PropertyID: p.ID, Identifier: row.identifier})
+			So(err, ShouldBeNil)
+
+			b, err := AddBooking(&Bookings{BookDate: date, SlotID: slot.ID, BookerID: booker.ID})
+			So(err, ShouldBeNil)
+
+			bookings = append(bookings, b)
+		}
+
+		from, to := bookings[0], bookings[1]
+
+		s, err := AddSwap(&Swap{FromBookingID: from.ID, ToBookingID: to.ID})
+		So(err, ShouldBeNil)
+
+		Convey("Accepting the swap exchanges the bookers", func() {
+			accepted, err := AcceptSwap(s.ID)
+			So(err, ShouldBeNil)
+			So(accepted.Status, ShouldEqual, SwapAccepted)
+
+			swappedFrom, _ := GetBooking(from.ID)
+			swappedTo, _ := GetBooking(to.ID)
+
+			So(swappedFrom.BookerID, ShouldEqual, to.BookerID)
+			So(swappedTo.BookerID, ShouldEqual, from.BookerID)
+		})
+
+		Convey("A booking changed since the request conflicts and nothing is changed", func() {
+			other, err := AddBooker(&Booker{PropertyID: p.ID, Identifier: "1003"})
+			So(err, ShouldBeNil)
+
+			// The second booking changes booker after the swap was requested
+			// so the first booking is moved before the swap fails
+			update := database.GetGoqu().From("bookings").
+				Where(goqu.Ex{"id": to.ID}).
+				Update(goqu.Record{"id_booker": other.ID})
+
+			_, uErr := update.Exec()
+			So(uErr, ShouldBeNil)
+
+			_, err = AcceptSwap(s.ID)
+			So(err, ShouldNotBeNil)
+			So(err.Status, ShouldEqual, http.StatusConflict)
+
+			unchanged, _ := GetBooking(from.ID)
+			So(unchanged.BookerID, ShouldEqual, from.BookerID)
+
+			pending, _ := GetSwap(s.ID)
+			So(pending.Status, ShouldEqual, SwapPending)
+		})
+	})
+}
@@ -0,0 +1,174 @@
+package laundry
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// Tag represents a RFID or NFC tag registered to a booker. The tag is the id
+// read by the reader device, stored in upper case.
+type Tag struct {
+	ID          int        `db:"id"          json:"id"`
+	BookerID    int        `db:"id_booker"   json:"booker_id"`
+	Tag         string     `db:"tag"         json:"tag"`
+	Description NullString `db:"description" json:"description"`
+	CreatedAt   time.Time  `db:"created_at"  json:"created_at"`
+}
+
+// GetBookerTags will return all tags registered to a booker
+func GetBookerTags(bookerID int) ([]Tag, *errors.LaundryError) {
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var tags = []Tag{}
+
+	err := db.From("booker_tags").
+		Where(goqu.Ex{
+			"id_booker": bookerID,
+		}).
+		Order(goqu.I("id").Asc()).
+		ScanStructs(&tags)
+
+	if err != nil {
+		return nil, errors.New("Could not get tags").CausedBy(err)
+	}
+
+	return tags, nil
+}
+
+// GetTag will return a tag based on an id
+func GetTag(id int) (*Tag, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var t Tag
+	found, err := db.From("booker_tags").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&t)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Tag with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	return &t, nil
+}
+
+// AddTag will register a tag to a booker. A tag may only be registered to one
+// booker.
+func AddTag(t *Tag) (*Tag, *errors.LaundryError) {
+	t.Tag = normalizeTag(t.Tag)
+
+	if t.Tag == "" {
+		return nil, errors.New("Missing tag in request").WithStatus(http.StatusBadRequest)
+	}
+
+	b, err := GetBooker(t.BookerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.ErasedAt.Valid {
+		return nil, errors.New("Booker with ID %d is erased", b.ID).WithStatus(http.StatusGone)
+	}
+
+	db := database.GetGoqu()
+
+	registered, cErr := db.From("booker_tags").Where(goqu.Ex{
+		"tag": t.Tag,
+	}).Count()
+
+	if cErr != nil {
+		return nil, errors.New("Could not get tags").CausedBy(cErr)
+	}
+
+	if registered > 0 {
+		return nil, errors.New("Tag %s is already registered", t.Tag).WithStatus(http.StatusConflict)
+	}
+
+	t.CreatedAt = time.Now()
+
+	insert := db.From("booker_tags").Insert(goqu.Record{
+		"id_booker":   t.BookerID,
+		"tag":         t.Tag,
+		"description": t.Description,
+		"created_at":  t.CreatedAt,
+	})
+
+	row, iErr := insert.Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not create tag").CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	t.ID = int(lastID)
+
+	return t, nil
+}
+
+// RemoveTag will remove a tag so it can no longer be used
+func RemoveTag(t *Tag) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("booker_tags").Where(goqu.Ex{
+		"id": t.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove tag with id %d", t.ID).CausedBy(err)
+	}
+
+	return nil
+}
+
+// RemoveTagByID will remove a tag by the tag id
+func RemoveTagByID(id int) *errors.LaundryError {
+	t, err := GetTag(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveTag(t)
+}
+
+// GetBookerByTag will return the booker the tag is registered to
+func GetBookerByTag(tag string) (*Booker, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var t Tag
+	found, err := db.From("booker_tags").Where(goqu.Ex{
+		"tag": normalizeTag(tag),
+	}).ScanStruct(&t)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Unknown tag").WithStatus(http.StatusNotFound)
+	}
+
+	return GetBooker(t.BookerID)
+}
+
+// normalizeTag will format a tag the same way regardless of how the reader
+// device formats it
+func normalizeTag(tag string) string {
+	return strings.ToUpper(strings.TrimSpace(tag))
+}
@@ -0,0 +1,546 @@
+package laundry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bombsimon/laundry/config"
+	"github.com/bombsimon/laundry/database"
+	"github.com/bombsimon/laundry/errors"
+	"github.com/bombsimon/laundry/log"
+	// MySQL driver for goqu
+	goqu "gopkg.in/doug-martin/goqu.v4"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+)
+
+// Waiting represents a booker in line for a booked slot at a given date.
+// When the slot is released the first in line is booked, or if the booker
+// can't be booked right now offered the slot until OfferedUntil. Position is
+// the place in line starting at 1.
+type Waiting struct {
+	ID           int       `db:"id"            json:"id"`
+	SlotID       int       `db:"id_slots"      json:"slot_id"`
+	BookDate     time.Time `db:"book_date"     json:"book_date"`
+	BookerID     int       `db:"id_booker"     json:"booker_id"`
+	CreatedAt    time.Time `db:"created_at"    json:"created_at"`
+	OfferedUntil NullTime  `db:"offered_until" json:"offered_until"`
+	Position     int       `db:"-"             json:"position"`
+}
+
+// waitlistKey identifies the line for a slot at a given date
+type waitlistKey struct {
+	SlotID   int
+	BookDate time.Time
+}
+
+// GetWaiting will return a place in line based on an id
+func GetWaiting(id int) (*Waiting, *errors.LaundryError) {
+	db := database.GetGoqu()
+
+	var w Waiting
+	found, err := db.From("waitlist").Where(goqu.Ex{
+		"id": id,
+	}).ScanStruct(&w)
+
+	if err != nil {
+		return nil, errors.New("Could not get row").CausedBy(err)
+	}
+
+	if !found {
+		return nil, errors.New("Waitlist entry with id %d not found", id).WithStatus(http.StatusNotFound)
+	}
+
+	if err := setWaitlistPosition(&w); err != nil {
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// GetBookerWaitlist will return every line the booker is waiting in for
+// today or later
+func GetBookerWaitlist(bookerID int) ([]Waiting, *errors.LaundryError) {
+	if _, err := GetBooker(bookerID); err != nil {
+		return nil, err
+	}
+
+	db := database.GetGoqu()
+
+	var waitlist = []Waiting{}
+
+	err := db.From("waitlist").
+		Where(
+			goqu.I("id_booker").Eq(bookerID),
+			goqu.I("book_date").Gte(today().Format("2006-01-02")),
+		).
+		Order(goqu.I("book_date").Asc(), goqu.I("id").Asc()).
+		ScanStructs(&waitlist)
+
+	if err != nil {
+		return nil, errors.New("Could not get waitlist").CausedBy(err)
+	}
+
+	for i := range waitlist {
+		if err := setWaitlistPosition(&waitlist[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return waitlist, nil
+}
+
+// AddWaiting will put a booker last in line for a booked slot. A booker may
+// only wait once for each slot and date and never for its own booking.
+func AddWaiting(w *Waiting) (*Waiting, *errors.LaundryError) {
+	if w.BookDate.IsZero() {
+		return nil, errors.New("Missing book date in request").WithStatus(http.StatusBadRequest)
+	}
+
+	w.BookDate = civilDate(w.BookDate)
+
+	if w.BookDate.Before(today()) {
+		return nil, errors.New("Cannot wait for a slot in the past").WithStatus(http.StatusBadRequest)
+	}
+
+	booker, err := GetBooker(w.BookerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if booker.ErasedAt.Valid {
+		return nil, errors.New("Booker with ID %d is erased", booker.ID).WithStatus(http.StatusGone)
+	}
+
+	slot, err := GetSlot(w.SlotID)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := GetRoom(slot.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	if room.PropertyID != booker.PropertyID {
+		return nil, errors.New("Slot with id %d is not in the property of booker with id %d", slot.ID, booker.ID).WithStatus(http.StatusForbidden)
+	}
+
+	db := database.GetGoqu()
+
+	var bookings []Bookings
+	bErr := db.From("bookings").
+		Where(goqu.Ex{
+			"book_date": w.BookDate.Format("2006-01-02"),
+			"id_slots":  w.SlotID,
+		}).
+		ScanStructs(&bookings)
+
+	if bErr != nil {
+		return nil, errors.New("Could not get bookings").CausedBy(bErr)
+	}
+
+	if len(bookings) == 0 {
+		return nil, errors.New("Slot with id %d is not booked, book it instead", slot.ID).WithStatus(http.StatusConflict)
+	}
+
+	for _, b := range bookings {
+		if b.BookerID == w.BookerID {
+			return nil, errors.New("Booker with id %d has already booked the slot", w.BookerID).WithStatus(http.StatusConflict)
+		}
+	}
+
+	waiting, cErr := db.From("waitlist").Where(goqu.Ex{
+		"id_slots":  w.SlotID,
+		"book_date": w.BookDate.Format("2006-01-02"),
+		"id_booker": w.BookerID,
+	}).Count()
+
+	if cErr != nil {
+		return nil, errors.New("Could not get waitlist").CausedBy(cErr)
+	}
+
+	if waiting > 0 {
+		return nil, errors.New("Booker with id %d is already waiting for the slot", w.BookerID).WithStatus(http.StatusConflict)
+	}
+
+	w.CreatedAt = time.Now()
+	w.OfferedUntil = NullTime{}
+
+	insert := db.From("waitlist").Insert(goqu.Record{
+		"id_slots":   w.SlotID,
+		"book_date":  w.BookDate.Format("2006-01-02"),
+		"id_booker":  w.BookerID,
+		"created_at": w.CreatedAt,
+	})
+
+	row, iErr := insert.Exec()
+	if iErr != nil {
+		return nil, errors.New("Could not add booker to the waitlist").CausedBy(iErr)
+	}
+
+	lastID, iErr := row.LastInsertId()
+	if iErr != nil {
+		return nil, errors.New(iErr)
+	}
+
+	w.ID = int(lastID)
+
+	if err := setWaitlistPosition(w); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// RemoveWaiting will remove a booker from the line. If the booker was offered
+// the slot it's passed to the next in line.
+func RemoveWaiting(w *Waiting) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	delete := db.From("waitlist").Where(goqu.Ex{
+		"id": w.ID,
+	}).Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove waitlist entry with id %d", w.ID).CausedBy(err)
+	}
+
+	if w.OfferedUntil.Valid {
+		return processWaitlistKey(waitlistKey{SlotID: w.SlotID, BookDate: w.BookDate}, time.Now())
+	}
+
+	return nil
+}
+
+// RemoveWaitingByID will remove a booker from the line by the waitlist id
+func RemoveWaitingByID(id int) *errors.LaundryError {
+	w, err := GetWaiting(id)
+	if err != nil {
+		return err
+	}
+
+	return RemoveWaiting(w)
+}
+
+// AcceptWaitlistOffer will book the slot offered to the booker waiting
+func AcceptWaitlistOffer(id int) (*Bookings, *errors.LaundryError) {
+	w, err := GetWaiting(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !w.OfferedUntil.Valid || !time.Now().Before(w.OfferedUntil.Time) {
+		return nil, errors.New("Waitlist entry with id %d has no offer", id).WithStatus(http.StatusConflict)
+	}
+
+	b, err := AddBooking(&Bookings{
+		BookDate: w.BookDate,
+		SlotID:   w.SlotID,
+		BookerID: w.BookerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeWaitlist([]Waiting{*w}); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// WaitlistRelease is a release hook which passes the released slot to the
+// first in line
+func WaitlistRelease(r Release) {
+	key := waitlistKey{SlotID: r.Slot.ID, BookDate: civilDate(r.BookDate)}
+
+	if err := processWaitlistKey(key, r.ReleasedAt); err != nil {
+		log.GetLogger().Errorf("Could not pass released slot %d to the waitlist: %s", r.Slot.ID, err)
+	}
+}
+
+// ProcessWaitlist will pass every free slot with bookers waiting to the first
+// in line and expire offers not accepted in time
+func ProcessWaitlist(at time.Time) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	var waitlist []Waiting
+	err := db.From("waitlist").
+		Where(
+			goqu.I("book_date").Gte(civilDate(at.In(buildingLocation())).AddDate(0, 0, -1).Format("2006-01-02")),
+		).
+		Order(goqu.I("id").Asc()).
+		ScanStructs(&waitlist)
+
+	if err != nil {
+		return errors.New("Could not get waitlist").CausedBy(err)
+	}
+
+	var keys []waitlistKey
+	var seen = make(map[waitlistKey]bool)
+
+	for _, w := range waitlist {
+		key := waitlistKey{SlotID: w.SlotID, BookDate: civilDate(w.BookDate)}
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if err := processWaitlistKey(key, at); err != nil {
+			return err
+		}
+	}
+
+	// Lines for days already passed are never processed
+	delete := db.From("waitlist").
+		Where(
+			goqu.I("book_date").Lt(civilDate(at.In(buildingLocation())).AddDate(0, 0, -1).Format("2006-01-02")),
+		).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove passed waitlist entries").CausedBy(err)
+	}
+
+	return nil
+}
+
+// WatchWaitlist will process the waitlist every interval until the program
+// exits
+func WatchWaitlist(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := ProcessWaitlist(time.Now()); err != nil {
+			log.GetLogger().Errorf("Could not process waitlist: %s", err)
+		}
+	}
+}
+
+// processWaitlistKey will pass the slot to the first in line if it's free.
+// Bookers blocked due to penalties are passed over. A booker who can't be
+// booked due to quotas is offered the slot for the configured number of minutes
+// or if offers are disabled skipped. If the slot itself can't be booked, i.e.
+// it's closed or held, nobody in line is booked. Any other error is returned so
+// the line is processed again later.
+func processWaitlistKey(key waitlistKey, at time.Time) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	var waitlist []Waiting
+	sErr := db.From("waitlist").
+		Where(goqu.Ex{
+			"id_slots":  key.SlotID,
+			"book_date": key.BookDate.Format("2006-01-02"),
+		}).
+		Order(goqu.I("id").Asc()).
+		ScanStructs(&waitlist)
+
+	if sErr != nil {
+		return errors.New("Could not get waitlist").CausedBy(sErr)
+	}
+
+	if len(waitlist) == 0 {
+		return nil
+	}
+
+	slot, err := GetSlot(key.SlotID)
+	if err != nil {
+		return err
+	}
+
+	if !at.Before(slot.EndsAt(key.BookDate)) {
+		return removeWaitlist(waitlist)
+	}
+
+	offered, expired, waiting := waitlistQueue(waitlist, at)
+
+	if err := removeWaitlist(expired); err != nil {
+		return err
+	}
+
+	if offered != nil {
+		return nil
+	}
+
+	booked, cErr := db.From("bookings").
+		Where(goqu.Ex{
+			"id_slots":  key.SlotID,
+			"book_date": key.BookDate.Format("2006-01-02"),
+		}).
+		Count()
+
+	if cErr != nil {
+		return errors.New("Could not get bookings").CausedBy(cErr)
+	}
+
+	if booked > 0 {
+		return nil
+	}
+
+	minutes := config.GetConfig().Bookings.WaitlistOfferMinutes
+
+	for _, w := range waiting {
+		if pErr := mayBook(w.BookerID); pErr != nil {
+			if !isValidationError(pErr) {
+				return pErr
+			}
+
+			continue
+		}
+
+		b, bErr := AddBooking(&Bookings{
+			BookDate: key.BookDate,
+			SlotID:   key.SlotID,
+			BookerID: w.BookerID,
+		})
+
+		if bErr == nil {
+			log.GetLogger().Infof("Booked slot %d at %s for booker %d on the waitlist", b.SlotID, key.BookDate.Format("2006-01-02"), b.BookerID)
+			return removeWaitlist([]Waiting{w})
+		}
+
+		if !isValidationError(bErr) {
+			return bErr
+		}
+
+		// Only a booker exceeding a quota may resolve the conflict by
+		// cancelling another booking, any other conflict is about the slot
+		qErr := validMachineTypeLimits(&Bookings{
+			BookDate: key.BookDate,
+			SlotID:   key.SlotID,
+			BookerID: w.BookerID,
+		}, slot)
+
+		if qErr == nil {
+			return nil
+		}
+
+		if !isValidationError(qErr) {
+			return qErr
+		}
+
+		if minutes > 0 {
+			update := db.From("waitlist").
+				Where(goqu.Ex{
+					"id": w.ID,
+				}).
+				Update(goqu.Record{
+					"offered_until": at.Add(time.Duration(minutes) * time.Minute),
+				})
+
+			if _, err := update.Exec(); err != nil {
+				return errors.New("Could not offer slot to waitlist entry with id %d", w.ID).CausedBy(err)
+			}
+
+			log.GetLogger().Infof("Offered slot %d at %s to booker %d on the waitlist", key.SlotID, key.BookDate.Format("2006-01-02"), w.BookerID)
+
+			return nil
+		}
+
+		if err := removeWaitlist([]Waiting{w}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitlistQueue splits a line ordered by id into the entry currently offered
+// the slot if any, entries with expired offers and entries still waiting in
+// order
+func waitlistQueue(waitlist []Waiting, at time.Time) (*Waiting, []Waiting, []Waiting) {
+	var (
+		offered *Waiting
+		expired []Waiting
+		waiting []Waiting
+	)
+
+	for i, w := range waitlist {
+		switch {
+		case !w.OfferedUntil.Valid:
+			waiting = append(waiting, w)
+		case at.Before(w.OfferedUntil.Time):
+			if offered == nil {
+				offered = &waitlist[i]
+			}
+		default:
+			expired = append(expired, w)
+		}
+	}
+
+	return offered, expired, waiting
+}
+
+// offeredToOther returns an error if the slot is offered to someone else on
+// the waitlist than the booker
+func offeredToOther(b *Bookings) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	offered, err := db.From("waitlist").
+		Where(
+			goqu.I("id_slots").Eq(b.SlotID),
+			goqu.I("book_date").Eq(b.BookDate.Format("2006-01-02")),
+			goqu.I("id_booker").Neq(b.BookerID),
+			goqu.I("offered_until").Gt(time.Now()),
+		).
+		Count()
+
+	if err != nil {
+		return errors.New("Could not get waitlist").CausedBy(err)
+	}
+
+	if offered > 0 {
+		return errors.New("Slot with id %d is offered to someone on the waitlist", b.SlotID).WithStatus(http.StatusConflict)
+	}
+
+	return nil
+}
+
+// removeWaitlist will remove the waitlist entries
+func removeWaitlist(waitlist []Waiting) *errors.LaundryError {
+	if len(waitlist) == 0 {
+		return nil
+	}
+
+	var ids []interface{}
+	for _, w := range waitlist {
+		ids = append(ids, w.ID)
+	}
+
+	db := database.GetGoqu()
+
+	delete := db.From("waitlist").
+		Where(
+			goqu.I("id").In(ids...),
+		).
+		Delete()
+
+	if _, err := delete.Exec(); err != nil {
+		return errors.New("Could not remove waitlist entries").CausedBy(err)
+	}
+
+	return nil
+}
+
+// setWaitlistPosition will set the place in line for the waitlist entry
+func setWaitlistPosition(w *Waiting) *errors.LaundryError {
+	db := database.GetGoqu()
+
+	before, err := db.From("waitlist").
+		Where(
+			goqu.I("id_slots").Eq(w.SlotID),
+			goqu.I("book_date").Eq(w.BookDate.Format("2006-01-02")),
+			goqu.I("id").Lt(w.ID),
+		).
+		Count()
+
+	if err != nil {
+		return errors.New("Could not get waitlist").CausedBy(err)
+	}
+
+	w.Position = int(before) + 1
+
+	return nil
+}
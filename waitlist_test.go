@@ -0,0 +1,50 @@
+package laundry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWaitlistQueue(t *testing.T) {
+	Convey("Given a line for a slot", t, func() {
+		at := time.Date(2018, 5, 7, 12, 0, 0, 0, time.UTC)
+
+		offeredUntil := func(t time.Time) NullTime {
+			return NullTime{mysql.NullTime{Time: t, Valid: true}}
+		}
+
+		ids := func(wl []Waiting) []int {
+			var ids []int
+			for _, w := range wl {
+				ids = append(ids, w.ID)
+			}
+
+			return ids
+		}
+
+		Convey("Nobody is offered the slot before it's released", func() {
+			offered, expired, waiting := waitlistQueue([]Waiting{{ID: 1}, {ID: 2}}, at)
+
+			So(offered, ShouldBeNil)
+			So(expired, ShouldBeEmpty)
+			So(ids(waiting), ShouldResemble, []int{1, 2})
+		})
+
+		Convey("An offer not accepted in time expires", func() {
+			waitlist := []Waiting{
+				{ID: 1, OfferedUntil: offeredUntil(at)},
+				{ID: 2, OfferedUntil: offeredUntil(at.Add(time.Minute))},
+				{ID: 3},
+			}
+
+			offered, expired, waiting := waitlistQueue(waitlist, at)
+
+			So(offered.ID, ShouldEqual, 2)
+			So(ids(expired), ShouldResemble, []int{1})
+			So(ids(waiting), ShouldResemble, []int{3})
+		})
+	})
+}